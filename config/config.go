@@ -2,10 +2,14 @@ package config
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -34,6 +38,14 @@ func GetLogger() *zap.Logger {
 	return logger
 }
 
+// SetLogger replaces the logger GetLogger returns, such as with an observer
+// in tests. Middleware take the logger when they are created, so set it
+// before creating them.
+func SetLogger(l *zap.Logger) {
+	once.Do(func() {})
+	logger = l
+}
+
 // CloseLogger properly syncs the logger when the application shuts down
 func CloseLogger() {
 	if logger != nil {
@@ -111,35 +123,267 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvDuration gets an environment variable as a duration such as "720h"
+// with a default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
+// getEnvFloat gets an environment variable as a float with a default value
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvList gets an environment variable as a list separated by commas or
+// spaces. Unlike the other getters, a variable set to the empty string yields
+// an empty list rather than the default.
+func getEnvList(key string, defaultValue []string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return defaultValue
+	}
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// TrashConfig holds how long deleted content is kept before it is purged
+type TrashConfig struct {
+	Retention     time.Duration // age at which deleted content is purged, 0 keeps it forever
+	PurgeInterval time.Duration // how often the purge job runs
+}
+
+// LoadTrashConfig reads TRASH_RETENTION (default 30 days) and
+// TRASH_PURGE_INTERVAL (default one hour)
+func LoadTrashConfig() *TrashConfig {
+	cfg := &TrashConfig{
+		Retention:     getEnvDuration("TRASH_RETENTION", 30*24*time.Hour),
+		PurgeInterval: getEnvDuration("TRASH_PURGE_INTERVAL", time.Hour),
+	}
+	if cfg.PurgeInterval <= 0 {
+		cfg.PurgeInterval = time.Hour
+	}
+	return cfg
+}
+
+// SchedulerConfig holds how often scheduled publishing and expiry are applied
+type SchedulerConfig struct {
+	Interval time.Duration // how often the scheduler runs, 0 disables it
+}
+
+// LoadSchedulerConfig reads SCHEDULER_INTERVAL (default 30 seconds)
+func LoadSchedulerConfig() *SchedulerConfig {
+	return &SchedulerConfig{
+		Interval: getEnvDuration("SCHEDULER_INTERVAL", 30*time.Second),
+	}
+}
+
+// IdempotencyConfig holds how long idempotency keys are remembered
+type IdempotencyConfig struct {
+	TTL           time.Duration // how long a key replays its response
+	PurgeInterval time.Duration // how often expired keys are removed
+}
+
+// LoadIdempotencyConfig reads IDEMPOTENCY_KEY_TTL (default 24 hours) and
+// IDEMPOTENCY_PURGE_INTERVAL (default one hour)
+func LoadIdempotencyConfig() *IdempotencyConfig {
+	cfg := &IdempotencyConfig{
+		TTL:           getEnvDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+		PurgeInterval: getEnvDuration("IDEMPOTENCY_PURGE_INTERVAL", time.Hour),
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 24 * time.Hour
+	}
+	if cfg.PurgeInterval <= 0 {
+		cfg.PurgeInterval = time.Hour
+	}
+	return cfg
+}
+
+// ContentIDConfig holds which client-supplied IDs content may be created under
+// with PUT, besides lowercase ULIDs
+type ContentIDConfig struct {
+	Pattern *regexp.Regexp // IDs matching it in full are accepted, nil for none
+}
+
+// LoadContentIDConfig reads CONTENT_ID_PATTERN, a regular expression that
+// client-supplied IDs must match in full, such as "legacy-[0-9]+"
+func LoadContentIDConfig() (*ContentIDConfig, error) {
+	cfg := &ContentIDConfig{}
+	if pattern := os.Getenv("CONTENT_ID_PATTERN"); pattern != "" {
+		re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CONTENT_ID_PATTERN: %w", err)
+		}
+		cfg.Pattern = re
+	}
+	return cfg, nil
+}
+
+// AuthConfig holds how callers are authenticated
+type AuthConfig struct {
+	AnonymousScopes []string      // scopes granted to requests without credentials
+	KeyCacheTTL     time.Duration // how long API keys are cached, 0 looks them up on every request
+}
+
+// LoadAuthConfig reads AUTH_ANONYMOUS_SCOPES (default content:read; set it
+// empty to require credentials everywhere) and AUTH_KEY_CACHE_TTL (default
+// 30 seconds), which also bounds how long a revoked key keeps working
+func LoadAuthConfig() *AuthConfig {
+	return &AuthConfig{
+		AnonymousScopes: getEnvList("AUTH_ANONYMOUS_SCOPES", []string{"content:read"}),
+		KeyCacheTTL:     getEnvDuration("AUTH_KEY_CACHE_TTL", 30*time.Second),
+	}
+}
+
+// JWTConfig holds how bearer tokens are verified
+type JWTConfig struct {
+	Secret   []byte        // HS256 shared secret, empty disables HS256
+	JWKSFile string        // JWKS file with RS256 and ES256 keys, empty disables them
+	Issuer   string        // required iss claim, empty accepts any issuer
+	Audience string        // required aud claim, empty accepts any audience
+	Leeway   time.Duration // clock skew allowed when checking exp and nbf
+}
+
+// LoadJWTConfig reads JWT_SECRET, JWT_JWKS_FILE, JWT_ISSUER, JWT_AUDIENCE and
+// JWT_LEEWAY (default 30 seconds). Bearer tokens are rejected unless a secret
+// or a JWKS file is configured.
+func LoadJWTConfig() *JWTConfig {
+	return &JWTConfig{
+		Secret:   []byte(os.Getenv("JWT_SECRET")),
+		JWKSFile: os.Getenv("JWT_JWKS_FILE"),
+		Issuer:   os.Getenv("JWT_ISSUER"),
+		Audience: os.Getenv("JWT_AUDIENCE"),
+		Leeway:   getEnvDuration("JWT_LEEWAY", 30*time.Second),
+	}
+}
+
+// Enabled reports whether bearer tokens can be verified at all
+func (c *JWTConfig) Enabled() bool {
+	return len(c.Secret) > 0 || c.JWKSFile != ""
+}
+
+// PolicyConfig holds where the authorization policy is loaded from
+type PolicyConfig struct {
+	File string // path of the policy file, empty allows every caller everything their scopes permit
+}
+
+// LoadPolicyConfig reads POLICY_FILE
+func LoadPolicyConfig() *PolicyConfig {
+	return &PolicyConfig{File: os.Getenv("POLICY_FILE")}
+}
+
+// AccessLogConfig holds which requests are left out of the access log
+type AccessLogConfig struct {
+	SkipPaths []string // paths whose requests are not logged, such as health probes
+}
+
+// LoadAccessLogConfig reads ACCESS_LOG_SKIP_PATHS (default "/healthz /readyz",
+// set it to the empty string to log every request)
+func LoadAccessLogConfig() *AccessLogConfig {
+	return &AccessLogConfig{SkipPaths: getEnvList("ACCESS_LOG_SKIP_PATHS", []string{"/healthz", "/readyz"})}
+}
+
+// ShutdownConfig holds how the server drains when it is stopped
+type ShutdownConfig struct {
+	Delay   time.Duration // how long readiness fails before the server stops accepting connections
+	Timeout time.Duration // how long in-flight requests may take to finish before they are canceled
+}
+
+// LoadShutdownConfig reads SHUTDOWN_DELAY (default 0, set it to a few
+// seconds behind a load balancer that polls readiness) and SHUTDOWN_TIMEOUT
+// (default 30 seconds)
+func LoadShutdownConfig() *ShutdownConfig {
+	cfg := &ShutdownConfig{
+		Delay:   getEnvDuration("SHUTDOWN_DELAY", 0),
+		Timeout: getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+	}
+	if cfg.Delay < 0 {
+		cfg.Delay = 0
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	return cfg
+}
+
+// TracingConfig holds where spans are exported and which traces are sampled
+type TracingConfig struct {
+	Exporter    string  // "otlp", "file", or empty to only propagate trace IDs
+	File        string  // file the file exporter appends to
+	ServiceName string  // service.name of exported spans
+	SampleRatio float64 // share of new traces sampled; the sampled flag of a traceparent is respected
+}
+
+// LoadTracingConfig reads TRACING_EXPORTER, TRACING_FILE (default
+// traces.jsonl), TRACING_SAMPLE_RATIO (default 1) and the standard
+// OTEL_SERVICE_NAME (default content-api). The otlp exporter reads the
+// standard OTEL_EXPORTER_OTLP_* variables itself.
+func LoadTracingConfig() *TracingConfig {
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "content-api"
+	}
+	file := os.Getenv("TRACING_FILE")
+	if file == "" {
+		file = "traces.jsonl"
+	}
+
+	return &TracingConfig{
+		Exporter:    os.Getenv("TRACING_EXPORTER"),
+		File:        file,
+		ServiceName: serviceName,
+		SampleRatio: getEnvFloat("TRACING_SAMPLE_RATIO", 1),
+	}
+}
+
 // GetConnectionString returns the database connection string
 func (c *DatabaseConfig) GetConnectionString() string {
 	return c.ConnectionString
 }
 
-// GetDatabaseEngine returns the database engine ("sqlite" or "postgres") based on the DATABASE_ENGINE env var.
+// GetDatabaseEngine returns the database engine ("sqlite", "postgres" or "memory") based on the DATABASE_ENGINE env var.
+// Unknown values are returned as-is so that the caller can reject them.
 func GetDatabaseEngine() string {
-	log := GetLogger()
 	engine := os.Getenv("DATABASE_ENGINE")
-	switch engine {
-	case "postgres":
-		return "postgres"
-	case "sqlite", "":
-		return "sqlite"
-	default:
-		log.Warn("Unknown DATABASE_ENGINE, defaulting to sqlite",
-			zap.String("engine", engine),
-		)
+	if engine == "" {
 		return "sqlite"
 	}
+	return engine
 }
 
-// GetLoggerWithRequestID returns a logger with request ID from context if available
+// GetLoggerWithRequestID returns a logger with request ID, trace ID and, for
+// authenticated requests, API key ID or token subject from context if available
 func GetLoggerWithRequestID(ctx context.Context) *zap.Logger {
 	logger := GetLogger()
 
 	// Try to get request ID from context
 	if requestID := GetRequestIDFromContext(ctx); requestID != "" {
-		return logger.With(zap.String("request_id", requestID))
+		logger = logger.With(zap.String("request_id", requestID))
+	}
+
+	// Try to get trace ID, API key ID and token subject from context using the
+	// middleware TraceIDKey, APIKeyIDKey and SubjectKey
+	if ctx != nil {
+		if traceID, ok := ctx.Value("trace_id").(string); ok {
+			logger = logger.With(zap.String("trace_id", traceID))
+		}
+		if keyID, ok := ctx.Value("api_key_id").(string); ok {
+			logger = logger.With(zap.String("api_key_id", keyID))
+		}
+		if subject, ok := ctx.Value("subject").(string); ok {
+			logger = logger.With(zap.String("subject", subject))
+		}
 	}
 
 	return logger
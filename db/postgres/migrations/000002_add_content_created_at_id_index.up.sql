@@ -0,0 +1,2 @@
+-- Composite index backing keyset pagination on (created_at, id)
+CREATE INDEX idx_content_created_at_id ON content(created_at DESC, id DESC);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_content_updated_at;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_content_search_vector;
+ALTER TABLE content DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,8 @@
+-- Full-text search vector over title (weight A) and body (weight B), kept in
+-- sync by Postgres as a generated column
+ALTER TABLE content ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(body, '')), 'B')
+) STORED;
+
+CREATE INDEX idx_content_search_vector ON content USING GIN (search_vector);
@@ -0,0 +1,2 @@
+-- Row version for optimistic concurrency, incremented on every update
+ALTER TABLE content ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
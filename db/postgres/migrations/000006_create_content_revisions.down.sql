@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS content_revisions ON content;
+DROP FUNCTION IF EXISTS record_content_revision();
+DROP TABLE IF EXISTS content_revisions;
@@ -0,0 +1,50 @@
+-- Snapshot of content after every create, update and delete, numbered per
+-- content from 1. Written by a trigger so that it is part of the same
+-- transaction as the write, and kept after the content is deleted.
+CREATE TABLE IF NOT EXISTS content_revisions (
+    content_id VARCHAR(26) NOT NULL,
+    revision INTEGER NOT NULL,
+    operation TEXT NOT NULL CHECK (operation IN ('create', 'update', 'delete')),
+    version INTEGER NOT NULL, -- content version the revision captured
+    title TEXT NOT NULL,
+    body TEXT NOT NULL,
+    author TEXT NOT NULL,
+    status TEXT NOT NULL,
+    data JSONB NOT NULL DEFAULT '{}',
+    recorded_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (content_id, revision)
+);
+
+CREATE FUNCTION record_content_revision() RETURNS trigger AS $$
+DECLARE
+    snapshot content%ROWTYPE;
+    recorded TIMESTAMP WITH TIME ZONE;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        snapshot := OLD;
+        recorded := clock_timestamp();
+    ELSE
+        snapshot := NEW;
+        recorded := NEW.updated_at;
+    END IF;
+
+    INSERT INTO content_revisions (content_id, revision, operation, version, title, body, author, status, data, recorded_at)
+    VALUES (
+        snapshot.id,
+        (SELECT coalesce(max(revision), 0) + 1 FROM content_revisions WHERE content_id = snapshot.id),
+        lower(TG_OP), snapshot.version, snapshot.title, snapshot.body, snapshot.author, coalesce(snapshot.status, 'draft'),
+        snapshot.data, recorded
+    );
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER content_revisions AFTER INSERT OR UPDATE OR DELETE ON content
+    FOR EACH ROW EXECUTE FUNCTION record_content_revision();
+
+-- Start the history of existing rows with their current state
+INSERT INTO content_revisions (content_id, revision, operation, version, title, body, author, status, data, recorded_at)
+SELECT id, 1, CASE WHEN version = 1 THEN 'create' ELSE 'update' END, version, title, body, author,
+    coalesce(status, 'draft'), data, coalesce(updated_at, now())
+FROM content;
@@ -0,0 +1,40 @@
+-- Deleted content cannot be represented without deleted_at
+DELETE FROM content_revisions WHERE content_id IN (SELECT id FROM content WHERE deleted_at IS NOT NULL);
+DELETE FROM content WHERE deleted_at IS NOT NULL;
+
+UPDATE content_revisions SET operation = 'update' WHERE operation = 'undelete';
+ALTER TABLE content_revisions DROP CONSTRAINT content_revisions_operation_check;
+ALTER TABLE content_revisions ADD CONSTRAINT content_revisions_operation_check
+    CHECK (operation IN ('create', 'update', 'delete'));
+
+CREATE OR REPLACE FUNCTION record_content_revision() RETURNS trigger AS $$
+DECLARE
+    snapshot content%ROWTYPE;
+    recorded TIMESTAMP WITH TIME ZONE;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        snapshot := OLD;
+        recorded := clock_timestamp();
+    ELSE
+        snapshot := NEW;
+        recorded := NEW.updated_at;
+    END IF;
+
+    INSERT INTO content_revisions (content_id, revision, operation, version, title, body, author, status, data, recorded_at)
+    VALUES (
+        snapshot.id,
+        (SELECT coalesce(max(revision), 0) + 1 FROM content_revisions WHERE content_id = snapshot.id),
+        lower(TG_OP), snapshot.version, snapshot.title, snapshot.body, snapshot.author, coalesce(snapshot.status, 'draft'),
+        snapshot.data, recorded
+    );
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER content_revisions ON content;
+CREATE TRIGGER content_revisions AFTER INSERT OR UPDATE OR DELETE ON content
+    FOR EACH ROW EXECUTE FUNCTION record_content_revision();
+
+DROP INDEX IF EXISTS idx_content_deleted_at;
+ALTER TABLE content DROP COLUMN deleted_at;
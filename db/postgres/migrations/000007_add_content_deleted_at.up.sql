@@ -0,0 +1,40 @@
+-- Soft delete: deleted content keeps its row with deleted_at set until the
+-- purge job removes it for good
+ALTER TABLE content ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_content_deleted_at ON content(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Deleting and undeleting are now updates of deleted_at, recorded as their own
+-- revision operations. Purging removes the history along with the content, so
+-- hard deletes are no longer recorded.
+ALTER TABLE content_revisions DROP CONSTRAINT content_revisions_operation_check;
+ALTER TABLE content_revisions ADD CONSTRAINT content_revisions_operation_check
+    CHECK (operation IN ('create', 'update', 'delete', 'undelete'));
+
+CREATE OR REPLACE FUNCTION record_content_revision() RETURNS trigger AS $$
+DECLARE
+    op TEXT := 'create';
+BEGIN
+    IF TG_OP = 'UPDATE' THEN
+        op := CASE
+            WHEN OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN 'delete'
+            WHEN OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN 'undelete'
+            ELSE 'update'
+        END;
+    END IF;
+
+    INSERT INTO content_revisions (content_id, revision, operation, version, title, body, author, status, data, recorded_at)
+    VALUES (
+        NEW.id,
+        (SELECT coalesce(max(revision), 0) + 1 FROM content_revisions WHERE content_id = NEW.id),
+        op, NEW.version, NEW.title, NEW.body, NEW.author, coalesce(NEW.status, 'draft'),
+        NEW.data, NEW.updated_at
+    );
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER content_revisions ON content;
+CREATE TRIGGER content_revisions AFTER INSERT OR UPDATE ON content
+    FOR EACH ROW EXECUTE FUNCTION record_content_revision();
@@ -0,0 +1,5 @@
+-- When and by whom content was last published, set by the publishing
+-- workflow and cleared when content goes back to draft. Unknown for content
+-- published before the workflow existed.
+ALTER TABLE content ADD COLUMN published_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE content ADD COLUMN published_by TEXT;
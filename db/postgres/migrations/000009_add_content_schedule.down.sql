@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_content_expire_at;
+DROP INDEX IF EXISTS idx_content_publish_at;
+
+ALTER TABLE content DROP COLUMN expire_at;
+ALTER TABLE content DROP COLUMN publish_at;
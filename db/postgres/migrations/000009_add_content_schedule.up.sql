@@ -0,0 +1,9 @@
+-- Scheduled publishing: a draft is published by the scheduler once
+-- publish_at has passed, and published content is archived once expire_at
+-- has passed. Outside that window published content is not listed as such.
+-- Server instances take turns running the scheduler using advisory locks.
+ALTER TABLE content ADD COLUMN publish_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE content ADD COLUMN expire_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_content_publish_at ON content(publish_at) WHERE publish_at IS NOT NULL;
+CREATE INDEX idx_content_expire_at ON content(expire_at) WHERE expire_at IS NOT NULL;
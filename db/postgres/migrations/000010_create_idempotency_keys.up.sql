@@ -0,0 +1,13 @@
+-- Idempotency keys sent with POST /content, and the response each produced,
+-- so that a retried request is answered with the original response instead of
+-- creating the content twice. A key whose expires_at has passed may be reused.
+CREATE TABLE idempotency_keys (
+    key TEXT PRIMARY KEY,
+    request_hash TEXT NOT NULL,
+    content_id TEXT NOT NULL,
+    response JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
@@ -0,0 +1,10 @@
+-- API keys authenticate callers through the X-API-Key header. Only a SHA-256
+-- hash of each key is stored; the key itself is shown once when minted.
+CREATE TABLE api_keys (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
@@ -0,0 +1,4 @@
+-- Postgres stores timestamps as timestamptz, which compare by time whatever
+-- offset they were written with, so only the SQLite migration of this version
+-- rewrites them. It keeps the migration versions of both engines in step.
+SELECT 1;
@@ -0,0 +1,9 @@
+-- Keys of different callers may share a key, so only the newest of each is
+-- kept.
+DELETE FROM idempotency_keys k
+USING idempotency_keys newer
+WHERE newer.key = k.key AND (newer.created_at, newer.caller) > (k.created_at, k.caller);
+
+ALTER TABLE idempotency_keys DROP CONSTRAINT idempotency_keys_pkey;
+ALTER TABLE idempotency_keys DROP COLUMN caller;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (key);
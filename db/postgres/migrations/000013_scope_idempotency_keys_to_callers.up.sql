@@ -0,0 +1,8 @@
+-- Scope idempotency keys to the caller that sent them, so that callers
+-- sharing a key neither replay each other's responses nor clash. Keys saved
+-- before get an empty caller, which no request has; they are no longer
+-- replayed and are purged once they expire.
+ALTER TABLE idempotency_keys ADD COLUMN caller TEXT NOT NULL DEFAULT '';
+ALTER TABLE idempotency_keys ALTER COLUMN caller DROP DEFAULT;
+ALTER TABLE idempotency_keys DROP CONSTRAINT idempotency_keys_pkey;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (caller, key);
@@ -0,0 +1 @@
+CREATE INDEX idx_content_created_at_id ON content(created_at DESC, id DESC);
@@ -0,0 +1 @@
+CREATE INDEX idx_content_updated_at ON content(updated_at);
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS content_fts_update;
+DROP TRIGGER IF EXISTS content_fts_delete;
+DROP TRIGGER IF EXISTS content_fts_insert;
+DROP TABLE IF EXISTS content_fts;
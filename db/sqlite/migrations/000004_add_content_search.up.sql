@@ -0,0 +1,29 @@
+-- Full-text index over title and body, stored as an external content table so
+-- the text itself is not duplicated. Requires SQLite built with FTS5
+-- (go build -tags sqlite_fts5).
+--
+-- The index is keyed by the implicit rowid of content. VACUUM may renumber
+-- rowids, so run INSERT INTO content_fts(content_fts) VALUES('rebuild') after it.
+CREATE VIRTUAL TABLE content_fts USING fts5(
+    title,
+    body,
+    content='content',
+    content_rowid='rowid',
+    tokenize='porter unicode61'
+);
+
+CREATE TRIGGER content_fts_insert AFTER INSERT ON content BEGIN
+    INSERT INTO content_fts(rowid, title, body) VALUES (new.rowid, new.title, new.body);
+END;
+
+CREATE TRIGGER content_fts_delete AFTER DELETE ON content BEGIN
+    INSERT INTO content_fts(content_fts, rowid, title, body) VALUES ('delete', old.rowid, old.title, old.body);
+END;
+
+CREATE TRIGGER content_fts_update AFTER UPDATE OF title, body ON content BEGIN
+    INSERT INTO content_fts(content_fts, rowid, title, body) VALUES ('delete', old.rowid, old.title, old.body);
+    INSERT INTO content_fts(rowid, title, body) VALUES (new.rowid, new.title, new.body);
+END;
+
+-- Index existing rows
+INSERT INTO content_fts(content_fts) VALUES ('rebuild');
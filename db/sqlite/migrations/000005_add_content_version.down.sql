@@ -0,0 +1 @@
+ALTER TABLE content DROP COLUMN version;
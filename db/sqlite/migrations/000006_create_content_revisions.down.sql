@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS content_revisions_delete;
+DROP TRIGGER IF EXISTS content_revisions_update;
+DROP TRIGGER IF EXISTS content_revisions_insert;
+DROP TABLE IF EXISTS content_revisions;
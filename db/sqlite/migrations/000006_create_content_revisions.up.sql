@@ -0,0 +1,53 @@
+-- Snapshot of content after every create, update and delete, numbered per
+-- content from 1. Written by triggers so that it is part of the same
+-- transaction as the write, and kept after the content is deleted.
+CREATE TABLE IF NOT EXISTS content_revisions (
+    content_id TEXT NOT NULL,
+    revision INTEGER NOT NULL,
+    operation TEXT NOT NULL CHECK (operation IN ('create', 'update', 'delete')),
+    version INTEGER NOT NULL, -- content version the revision captured
+    title TEXT NOT NULL,
+    body TEXT NOT NULL,
+    author TEXT NOT NULL,
+    status TEXT NOT NULL,
+    data TEXT NOT NULL DEFAULT '{}',
+    recorded_at TEXT NOT NULL,
+    PRIMARY KEY (content_id, revision)
+) STRICT;
+
+CREATE TRIGGER content_revisions_insert AFTER INSERT ON content BEGIN
+    INSERT INTO content_revisions (content_id, revision, operation, version, title, body, author, status, data, recorded_at)
+    VALUES (
+        new.id,
+        (SELECT coalesce(max(revision), 0) + 1 FROM content_revisions WHERE content_id = new.id),
+        'create', new.version, new.title, new.body, new.author, coalesce(new.status, 'draft'),
+        coalesce(new.data, '{}'), new.updated_at
+    );
+END;
+
+CREATE TRIGGER content_revisions_update AFTER UPDATE ON content BEGIN
+    INSERT INTO content_revisions (content_id, revision, operation, version, title, body, author, status, data, recorded_at)
+    VALUES (
+        new.id,
+        (SELECT coalesce(max(revision), 0) + 1 FROM content_revisions WHERE content_id = new.id),
+        'update', new.version, new.title, new.body, new.author, coalesce(new.status, 'draft'),
+        coalesce(new.data, '{}'), new.updated_at
+    );
+END;
+
+-- Timestamps use the fixed width format the application writes
+CREATE TRIGGER content_revisions_delete AFTER DELETE ON content BEGIN
+    INSERT INTO content_revisions (content_id, revision, operation, version, title, body, author, status, data, recorded_at)
+    VALUES (
+        old.id,
+        (SELECT coalesce(max(revision), 0) + 1 FROM content_revisions WHERE content_id = old.id),
+        'delete', old.version, old.title, old.body, old.author, coalesce(old.status, 'draft'),
+        coalesce(old.data, '{}'), strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')
+    );
+END;
+
+-- Start the history of existing rows with their current state
+INSERT INTO content_revisions (content_id, revision, operation, version, title, body, author, status, data, recorded_at)
+SELECT id, 1, CASE WHEN version = 1 THEN 'create' ELSE 'update' END, version, title, body, author,
+    coalesce(status, 'draft'), coalesce(data, '{}'), coalesce(updated_at, strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now'))
+FROM content;
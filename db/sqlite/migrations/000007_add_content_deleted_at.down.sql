@@ -0,0 +1,60 @@
+-- Deleted content cannot be represented without deleted_at
+DELETE FROM content_revisions WHERE content_id IN (SELECT id FROM content WHERE deleted_at IS NOT NULL);
+DELETE FROM content WHERE deleted_at IS NOT NULL;
+
+DROP TRIGGER IF EXISTS content_revisions_update;
+DROP TRIGGER IF EXISTS content_revisions_insert;
+
+CREATE TABLE content_revisions_old (
+    content_id TEXT NOT NULL,
+    revision INTEGER NOT NULL,
+    operation TEXT NOT NULL CHECK (operation IN ('create', 'update', 'delete')),
+    version INTEGER NOT NULL, -- content version the revision captured
+    title TEXT NOT NULL,
+    body TEXT NOT NULL,
+    author TEXT NOT NULL,
+    status TEXT NOT NULL,
+    data TEXT NOT NULL DEFAULT '{}',
+    recorded_at TEXT NOT NULL,
+    PRIMARY KEY (content_id, revision)
+) STRICT;
+
+INSERT INTO content_revisions_old
+SELECT content_id, revision, CASE WHEN operation = 'undelete' THEN 'update' ELSE operation END,
+    version, title, body, author, status, data, recorded_at
+FROM content_revisions;
+DROP TABLE content_revisions;
+ALTER TABLE content_revisions_old RENAME TO content_revisions;
+
+CREATE TRIGGER content_revisions_insert AFTER INSERT ON content BEGIN
+    INSERT INTO content_revisions (content_id, revision, operation, version, title, body, author, status, data, recorded_at)
+    VALUES (
+        new.id,
+        (SELECT coalesce(max(revision), 0) + 1 FROM content_revisions WHERE content_id = new.id),
+        'create', new.version, new.title, new.body, new.author, coalesce(new.status, 'draft'),
+        coalesce(new.data, '{}'), new.updated_at
+    );
+END;
+
+CREATE TRIGGER content_revisions_update AFTER UPDATE ON content BEGIN
+    INSERT INTO content_revisions (content_id, revision, operation, version, title, body, author, status, data, recorded_at)
+    VALUES (
+        new.id,
+        (SELECT coalesce(max(revision), 0) + 1 FROM content_revisions WHERE content_id = new.id),
+        'update', new.version, new.title, new.body, new.author, coalesce(new.status, 'draft'),
+        coalesce(new.data, '{}'), new.updated_at
+    );
+END;
+
+CREATE TRIGGER content_revisions_delete AFTER DELETE ON content BEGIN
+    INSERT INTO content_revisions (content_id, revision, operation, version, title, body, author, status, data, recorded_at)
+    VALUES (
+        old.id,
+        (SELECT coalesce(max(revision), 0) + 1 FROM content_revisions WHERE content_id = old.id),
+        'delete', old.version, old.title, old.body, old.author, coalesce(old.status, 'draft'),
+        coalesce(old.data, '{}'), strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')
+    );
+END;
+
+DROP INDEX IF EXISTS idx_content_deleted_at;
+ALTER TABLE content DROP COLUMN deleted_at;
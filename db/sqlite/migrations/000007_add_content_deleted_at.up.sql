@@ -0,0 +1,56 @@
+-- Soft delete: deleted content keeps its row with deleted_at set until the
+-- purge job removes it for good
+ALTER TABLE content ADD COLUMN deleted_at TEXT;
+
+CREATE INDEX idx_content_deleted_at ON content(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Deleting and undeleting are now updates of deleted_at, recorded as their own
+-- revision operations. Purging removes the history along with the content, so
+-- hard deletes are no longer recorded. SQLite cannot alter a CHECK constraint,
+-- so the revisions table is rebuilt, with its triggers.
+DROP TRIGGER IF EXISTS content_revisions_delete;
+DROP TRIGGER IF EXISTS content_revisions_update;
+DROP TRIGGER IF EXISTS content_revisions_insert;
+
+CREATE TABLE content_revisions_new (
+    content_id TEXT NOT NULL,
+    revision INTEGER NOT NULL,
+    operation TEXT NOT NULL CHECK (operation IN ('create', 'update', 'delete', 'undelete')),
+    version INTEGER NOT NULL, -- content version the revision captured
+    title TEXT NOT NULL,
+    body TEXT NOT NULL,
+    author TEXT NOT NULL,
+    status TEXT NOT NULL,
+    data TEXT NOT NULL DEFAULT '{}',
+    recorded_at TEXT NOT NULL,
+    PRIMARY KEY (content_id, revision)
+) STRICT;
+
+INSERT INTO content_revisions_new SELECT * FROM content_revisions;
+DROP TABLE content_revisions;
+ALTER TABLE content_revisions_new RENAME TO content_revisions;
+
+CREATE TRIGGER content_revisions_insert AFTER INSERT ON content BEGIN
+    INSERT INTO content_revisions (content_id, revision, operation, version, title, body, author, status, data, recorded_at)
+    VALUES (
+        new.id,
+        (SELECT coalesce(max(revision), 0) + 1 FROM content_revisions WHERE content_id = new.id),
+        'create', new.version, new.title, new.body, new.author, coalesce(new.status, 'draft'),
+        coalesce(new.data, '{}'), new.updated_at
+    );
+END;
+
+CREATE TRIGGER content_revisions_update AFTER UPDATE ON content BEGIN
+    INSERT INTO content_revisions (content_id, revision, operation, version, title, body, author, status, data, recorded_at)
+    VALUES (
+        new.id,
+        (SELECT coalesce(max(revision), 0) + 1 FROM content_revisions WHERE content_id = new.id),
+        CASE
+            WHEN old.deleted_at IS NULL AND new.deleted_at IS NOT NULL THEN 'delete'
+            WHEN old.deleted_at IS NOT NULL AND new.deleted_at IS NULL THEN 'undelete'
+            ELSE 'update'
+        END,
+        new.version, new.title, new.body, new.author, coalesce(new.status, 'draft'),
+        coalesce(new.data, '{}'), new.updated_at
+    );
+END;
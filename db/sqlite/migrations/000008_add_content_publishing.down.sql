@@ -0,0 +1,2 @@
+ALTER TABLE content DROP COLUMN published_by;
+ALTER TABLE content DROP COLUMN published_at;
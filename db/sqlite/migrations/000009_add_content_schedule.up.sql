@@ -0,0 +1,16 @@
+-- Scheduled publishing: a draft is published by the scheduler once
+-- publish_at has passed, and published content is archived once expire_at
+-- has passed. Outside that window published content is not listed as such.
+ALTER TABLE content ADD COLUMN publish_at TEXT;
+ALTER TABLE content ADD COLUMN expire_at TEXT;
+
+CREATE INDEX idx_content_publish_at ON content(publish_at) WHERE publish_at IS NOT NULL;
+CREATE INDEX idx_content_expire_at ON content(expire_at) WHERE expire_at IS NOT NULL;
+
+-- Leases let one of several server processes sharing the database run a
+-- background job at a time. A lease whose expires_at has passed is free.
+CREATE TABLE leases (
+    name TEXT PRIMARY KEY,
+    holder TEXT NOT NULL,
+    expires_at TEXT NOT NULL
+) STRICT;
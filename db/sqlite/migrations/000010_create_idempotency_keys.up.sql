@@ -0,0 +1,13 @@
+-- Idempotency keys sent with POST /content, and the response each produced,
+-- so that a retried request is answered with the original response instead of
+-- creating the content twice. A key whose expires_at has passed may be reused.
+CREATE TABLE idempotency_keys (
+    key TEXT PRIMARY KEY,
+    request_hash TEXT NOT NULL,
+    content_id TEXT NOT NULL,
+    response TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    expires_at TEXT NOT NULL
+) STRICT;
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
@@ -0,0 +1,11 @@
+-- API keys authenticate callers through the X-API-Key header. Only a SHA-256
+-- hash of each key is stored; the key itself is shown once when minted.
+-- scopes is a JSON array of scope names such as "content:write".
+CREATE TABLE api_keys (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT NOT NULL DEFAULT '[]',
+    created_at TEXT NOT NULL,
+    revoked_at TEXT
+) STRICT;
@@ -0,0 +1,2 @@
+-- Normalised timestamps are read like the original ones, so there is nothing
+-- to undo
@@ -0,0 +1,49 @@
+-- Rewrite timestamps stored before the fixed width UTC format into it, so that
+-- comparing the TEXT values orders them by time. Rows written by the original
+-- server use the driver's variable width format with a local offset, such as
+-- 2024-05-01 12:00:00.5+02:00, and column defaults datetime('now'), such as
+-- 2024-05-01 10:00:00. Fractional seconds are kept, as offsets are whole
+-- minutes.
+CREATE TEMP TABLE old_timestamps AS
+WITH old AS (
+    SELECT value, CASE WHEN instr(value, '.') = 0 THEN '' ELSE substr(value, instr(value, '.') + 1) END AS tail
+    FROM (
+        SELECT created_at AS value FROM content
+        UNION SELECT updated_at FROM content
+        UNION SELECT recorded_at FROM content_revisions
+    )
+    WHERE value NOT GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9] [0-9][0-9]:[0-9][0-9]:[0-9][0-9].[0-9][0-9][0-9][0-9][0-9][0-9][0-9][0-9][0-9]+00:00'
+        AND strftime('%s', value) IS NOT NULL
+)
+SELECT
+    value,
+    -- the digits of the fraction, up to the offset, padded to nanoseconds
+    strftime('%Y-%m-%d %H:%M:%S', value) || '.'
+        || substr(substr(tail, 1, length(tail) - length(ltrim(tail, '0123456789'))) || '000000000', 1, 9)
+        || '+00:00' AS normalised
+FROM old;
+
+-- Normalising updated_at must not be recorded as a revision, so the revisions
+-- trigger is recreated afterwards
+DROP TRIGGER IF EXISTS content_revisions_update;
+
+UPDATE content SET created_at = t.normalised FROM old_timestamps t WHERE content.created_at = t.value;
+UPDATE content SET updated_at = t.normalised FROM old_timestamps t WHERE content.updated_at = t.value;
+UPDATE content_revisions SET recorded_at = t.normalised FROM old_timestamps t WHERE content_revisions.recorded_at = t.value;
+
+DROP TABLE old_timestamps;
+
+CREATE TRIGGER content_revisions_update AFTER UPDATE ON content BEGIN
+    INSERT INTO content_revisions (content_id, revision, operation, version, title, body, author, status, data, recorded_at)
+    VALUES (
+        new.id,
+        (SELECT coalesce(max(revision), 0) + 1 FROM content_revisions WHERE content_id = new.id),
+        CASE
+            WHEN old.deleted_at IS NULL AND new.deleted_at IS NOT NULL THEN 'delete'
+            WHEN old.deleted_at IS NOT NULL AND new.deleted_at IS NULL THEN 'undelete'
+            ELSE 'update'
+        END,
+        new.version, new.title, new.body, new.author, coalesce(new.status, 'draft'),
+        coalesce(new.data, '{}'), new.updated_at
+    );
+END;
@@ -0,0 +1,26 @@
+-- Keys of different callers may share a key, so only the newest of each is
+-- kept.
+CREATE TABLE idempotency_keys_old (
+    key TEXT PRIMARY KEY,
+    request_hash TEXT NOT NULL,
+    content_id TEXT NOT NULL,
+    response TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    expires_at TEXT NOT NULL
+) STRICT;
+
+INSERT INTO idempotency_keys_old (key, request_hash, content_id, response, created_at, expires_at)
+SELECT key, request_hash, content_id, response, created_at, expires_at FROM idempotency_keys
+WHERE true
+ORDER BY created_at
+ON CONFLICT (key) DO UPDATE SET
+    request_hash = excluded.request_hash,
+    content_id = excluded.content_id,
+    response = excluded.response,
+    created_at = excluded.created_at,
+    expires_at = excluded.expires_at;
+
+DROP TABLE idempotency_keys;
+ALTER TABLE idempotency_keys_old RENAME TO idempotency_keys;
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
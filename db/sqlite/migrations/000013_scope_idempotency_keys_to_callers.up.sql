@@ -0,0 +1,23 @@
+-- Scope idempotency keys to the caller that sent them, so that callers
+-- sharing a key neither replay each other's responses nor clash. SQLite
+-- cannot change a primary key in place, so the table is rebuilt. Keys saved
+-- before get an empty caller, which no request has; they are no longer
+-- replayed and are purged once they expire.
+CREATE TABLE idempotency_keys_new (
+    caller TEXT NOT NULL,
+    key TEXT NOT NULL,
+    request_hash TEXT NOT NULL,
+    content_id TEXT NOT NULL,
+    response TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    expires_at TEXT NOT NULL,
+    PRIMARY KEY (caller, key)
+) STRICT;
+
+INSERT INTO idempotency_keys_new (caller, key, request_hash, content_id, response, created_at, expires_at)
+SELECT '', key, request_hash, content_id, response, created_at, expires_at FROM idempotency_keys;
+
+DROP TABLE idempotency_keys;
+ALTER TABLE idempotency_keys_new RENAME TO idempotency_keys;
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"go.uber.org/zap"
+
+	"github.com/seenthis-ab/content-api/config"
+	"github.com/seenthis-ab/content-api/models"
+	"github.com/seenthis-ab/content-api/policy"
+)
+
+// BulkItemResult reports the outcome of one item of a bulk request
+type BulkItemResult struct {
+	ID      string           `json:"id"`
+	Status  int              `json:"status" doc:"Status the item would have had as a single request"`
+	Content *models.Content  `json:"content,omitempty" doc:"The content as written, omitted for deletes and failed items"`
+	Error   *huma.ErrorModel `json:"error,omitempty" doc:"Problem details of a failed item"`
+}
+
+// BulkContentOutput represents the response of a bulk request. The status is
+// 207 Multi-Status if any item failed.
+type BulkContentOutput struct {
+	Status int
+	Body   struct {
+		Items []BulkItemResult `json:"items" doc:"One result per requested item, in request order"`
+	}
+}
+
+// newBulkContentOutput builds the response for per-item results, reporting
+// successful items with the given status
+func newBulkContentOutput(logger *zap.Logger, results []models.BulkResult, status int) *BulkContentOutput {
+	output := &BulkContentOutput{Status: status}
+	output.Body.Items = make([]BulkItemResult, len(results))
+	for i, result := range results {
+		item := BulkItemResult{ID: result.ID, Status: status, Content: result.Content}
+		if result.Err != nil {
+			item.Error = problemDetails(logger, result.Err, zap.String("content_id", result.ID))
+			item.Status = item.Error.Status
+			item.Content = nil
+			output.Status = http.StatusMultiStatus
+		}
+		output.Body.Items[i] = item
+	}
+	return output
+}
+
+// problemDetails converts the error of a single bulk item to problem details
+func problemDetails(logger *zap.Logger, err error, fields ...zap.Field) *huma.ErrorModel {
+	var statusErr huma.StatusError
+	if !errors.As(err, &statusErr) {
+		err = storeError(logger, err, fields...)
+	}
+
+	var model *huma.ErrorModel
+	if errors.As(err, &model) {
+		return model
+	}
+	return huma.Error500InternalServerError("Internal server error").(*huma.ErrorModel)
+}
+
+// BulkCreateContentInput represents the request body for creating content in bulk
+type BulkCreateContentInput struct {
+	Body struct {
+		Items []NewContent `json:"items" minItems:"1" maxItems:"1000" doc:"Content to create"`
+	}
+}
+
+// BulkCreateContent handles POST /content/bulk requests. The items are
+// created in a single transaction, either all of them or none.
+func (h *ContentHandlers) BulkCreateContent(ctx context.Context, input *BulkCreateContentInput) (*BulkContentOutput, error) {
+	logger := config.GetLoggerWithRequestID(ctx)
+
+	contents := make([]*models.Content, len(input.Body.Items))
+	for i, item := range input.Body.Items {
+		contents[i] = item.content(newContentID(), publisher(ctx))
+		if err := h.authorizeCreate(ctx, contents[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	logger.Info("Creating content in bulk",
+		zap.Int("count", len(contents)),
+	)
+
+	if err := h.store.CreateMany(ctx, contents); err != nil {
+		return nil, storeError(logger, err)
+	}
+
+	results := make([]models.BulkResult, len(contents))
+	for i, content := range contents {
+		results[i] = models.BulkResult{ID: content.ID, Content: content}
+	}
+
+	return newBulkContentOutput(logger, results, http.StatusCreated), nil
+}
+
+// BulkPatchContentInput represents the request body for patching content in bulk
+type BulkPatchContentInput struct {
+	Body struct {
+		IDs   []string               `json:"ids" minItems:"1" maxItems:"1000" doc:"IDs of the content to patch"`
+		Patch map[string]interface{} `json:"patch" doc:"JSON Merge Patch (RFC 7396) applied to every item, e.g. {\"status\": \"archived\"}"`
+	}
+}
+
+// BulkPatchContent handles PATCH /content/bulk requests, applying one merge
+// patch to every listed item in a single transaction
+func (h *ContentHandlers) BulkPatchContent(ctx context.Context, input *BulkPatchContentInput) (*BulkContentOutput, error) {
+	logger := config.GetLoggerWithRequestID(ctx)
+
+	logger.Info("Patching content in bulk",
+		zap.Int("count", len(input.Body.IDs)),
+	)
+
+	results, err := h.store.UpdateMany(ctx, input.Body.IDs, h.authorizeEdit(ctx, withStatusWorkflow(publisher(ctx), func(content *models.Content) error {
+		return patchContent(content, func(doc interface{}) (interface{}, error) {
+			// Each item gets its own copy, as the merge hands patch values to the document
+			return applyMergePatch(doc, deepCopyJSON(input.Body.Patch)), nil
+		})
+	})))
+	if err != nil {
+		return nil, storeError(logger, err)
+	}
+
+	return newBulkContentOutput(logger, results, http.StatusOK), nil
+}
+
+// BulkDeleteContentInput represents the request body for deleting content in bulk
+type BulkDeleteContentInput struct {
+	Body struct {
+		IDs []string `json:"ids" minItems:"1" maxItems:"1000" doc:"IDs of the content to delete"`
+	}
+}
+
+// BulkDeleteContent handles DELETE /content/bulk requests, moving every
+// listed item to the trash in a single statement. Items the policy does not
+// allow the caller to delete fail with 403 and are left alone, as do items
+// changed after they were authorized, with 412.
+func (h *ContentHandlers) BulkDeleteContent(ctx context.Context, input *BulkDeleteContentInput) (*BulkContentOutput, error) {
+	logger := config.GetLoggerWithRequestID(ctx)
+
+	logger.Info("Deleting content in bulk",
+		zap.Int("count", len(input.Body.IDs)),
+	)
+
+	results, allowed, versions, err := h.authorizeDeletes(ctx, input.Body.IDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(allowed) > 0 {
+		ids := make([]string, len(allowed))
+		for i, index := range allowed {
+			ids[i] = input.Body.IDs[index]
+		}
+		deleted, err := h.store.DeleteMany(ctx, ids, versions)
+		if err != nil {
+			return nil, storeError(logger, err)
+		}
+		for i, index := range allowed {
+			results[index] = deleted[i]
+			if errors.Is(deleted[i].Err, models.ErrVersionConflict) {
+				results[index].Err = huma.Error412PreconditionFailed("Content was modified concurrently")
+			}
+		}
+	}
+
+	return newBulkContentOutput(logger, results, http.StatusOK), nil
+}
+
+// authorizeDeletes checks which of the IDs the caller may delete, returning a
+// result for each ID holding the 403 error of those that may not be deleted,
+// and the indexes of the others with the versions they were authorized at,
+// or nil if nothing was read. Missing content is left for the delete to
+// report.
+func (h *ContentHandlers) authorizeDeletes(ctx context.Context, ids []string) ([]models.BulkResult, []int, []int, error) {
+	results := make([]models.BulkResult, len(ids))
+	for i, id := range ids {
+		results[i].ID = id
+	}
+
+	filter, err := h.policy.Filter(ctx, policy.ActionDelete)
+	if err != nil {
+		denied := forbidden(ctx, err)
+		for i := range results {
+			results[i].Err = denied
+		}
+		return results, nil, nil, nil
+	}
+
+	allowed := make([]int, 0, len(ids))
+	var versions []int
+	for i, id := range ids {
+		// Without a filter everything may be deleted, and nothing needs a read
+		if filter != nil {
+			content, err := h.store.GetByID(ctx, id)
+			if err != nil && !errors.Is(err, models.ErrNotFound) {
+				return nil, nil, nil, storeError(config.GetLoggerWithRequestID(ctx), err, zap.String("content_id", id))
+			}
+			version := 0 // missing content has no version to hold the delete to
+			if err == nil {
+				if err := h.authorize(ctx, policy.ActionDelete, content); err != nil {
+					results[i].Err = err
+					continue
+				}
+				version = content.Version
+			}
+			versions = append(versions, version)
+		}
+		allowed = append(allowed, i)
+	}
+	return results, allowed, versions, nil
+}
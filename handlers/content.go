@@ -2,56 +2,141 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"crypto/rand"
 
 	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/conditional"
 	"github.com/oklog/ulid/v2"
 	"go.uber.org/zap"
 
 	"github.com/seenthis-ab/content-api/config"
+	"github.com/seenthis-ab/content-api/middleware"
 	"github.com/seenthis-ab/content-api/models"
+	"github.com/seenthis-ab/content-api/policy"
 )
 
-// ContentStore interface for dependency injection
-type ContentStore interface {
-	Create(content *models.Content) error
-	GetByID(id string) (*models.Content, error)
-	List() ([]*models.Content, error)
-	Update(content *models.Content) error
-	Delete(id string) error
-	Close() error
+// Store is the part of the content store the content handlers use
+type Store interface {
+	models.ContentReader
+	models.ContentWriter
+	models.BatchWriter
+	models.RevisionReader
+	models.IdempotencyStore
+	ListScheduled(ctx context.Context, due time.Time, limit int) ([]string, error)
 }
 
 // ContentHandlers contains all content-related HTTP handlers
 type ContentHandlers struct {
-	store ContentStore
+	store          Store
+	idempotencyTTL time.Duration
+	idPattern      *regexp.Regexp
+	policy         *policy.Policy // nil allows everything
 }
 
-// NewContentHandlers creates a new ContentHandlers instance
-func NewContentHandlers(store ContentStore) *ContentHandlers {
+// NewContentHandlers creates a new ContentHandlers instance. A nil policy
+// allows every caller to do everything their scopes permit.
+func NewContentHandlers(store Store, idempotency *config.IdempotencyConfig, ids *config.ContentIDConfig, policy *policy.Policy) *ContentHandlers {
 	return &ContentHandlers{
-		store: store,
+		store:          store,
+		idempotencyTTL: idempotency.TTL,
+		idPattern:      ids.Pattern,
+		policy:         policy,
 	}
 }
 
+// NewContent holds the fields of content to be created
+type NewContent struct {
+	Title     string                 `json:"title" required:"true"`
+	Body      string                 `json:"body" required:"true"`
+	Author    string                 `json:"author,omitempty" doc:"Defaults to the subject (sub claim) of the bearer token"`
+	Status    string                 `json:"status" enum:"draft,published" default:"draft" doc:"Initial status; content is archived through POST /content/{id}/archive"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	PublishAt *time.Time             `json:"publish_at,omitempty" doc:"When to publish the draft; published content is not listed as such before"`
+	ExpireAt  *time.Time             `json:"expire_at,omitempty" doc:"When to archive the content once published; it is not listed as published from then on"`
+}
+
+// Resolve records the subject of the bearer token as the author of new
+// content that names none, and checks that its schedule is consistent
+func (n *NewContent) Resolve(ctx huma.Context, prefix *huma.PathBuffer) []error {
+	if n.Author == "" {
+		if claims := middleware.GetClaims(ctx.Context()); claims != nil {
+			n.Author = claims.Subject
+		}
+	}
+	if n.Author == "" {
+		return []error{&huma.ErrorDetail{
+			Message:  "author is required unless the bearer token has a subject",
+			Location: prefix.With("author"),
+			Value:    n.Author,
+		}}
+	}
+	if detail := scheduleError(n.PublishAt, n.ExpireAt); detail != nil {
+		detail.Location = prefix.With("expire_at")
+		return []error{detail}
+	}
+	return nil
+}
+
+// content returns the content to store for n under the given ID. Content
+// created as published is recorded as published by the publisher.
+func (n NewContent) content(id, publisher string) *models.Content {
+	data := n.Data
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	content := &models.Content{
+		ID:        id,
+		Title:     n.Title,
+		Body:      n.Body,
+		Author:    n.Author,
+		Data:      data,
+		PublishAt: n.PublishAt,
+		ExpireAt:  n.ExpireAt,
+	}
+	enterStatus(content, n.Status, publisher)
+	return content
+}
+
+// newContentID generates a lowercase ULID for new content
+func newContentID() string {
+	ts := time.Now().UTC()
+	entropy := ulid.Monotonic(rand.Reader, 0)
+	return strings.ToLower(ulid.MustNew(ulid.Timestamp(ts), entropy).String())
+}
+
+// validClientID reports whether content may be created under an ID chosen by
+// the client: a lowercase ULID like the IDs the server generates, or an ID
+// matching the configured pattern
+func (h *ContentHandlers) validClientID(id string) bool {
+	if _, err := ulid.ParseStrict(id); err == nil && id == strings.ToLower(id) {
+		return true
+	}
+	return h.idPattern != nil && h.idPattern.MatchString(id)
+}
+
 // CreateContentInput represents the request body for creating content
 type CreateContentInput struct {
-	Body struct {
-		Title  string                 `json:"title" required:"true"`
-		Body   string                 `json:"body" required:"true"`
-		Author string                 `json:"author" required:"true"`
-		Status string                 `json:"status" enum:"draft,published,archived" default:"draft"`
-		Data   map[string]interface{} `json:"data,omitempty"`
-	}
+	IdempotencyKey string `header:"Idempotency-Key" maxLength:"255" doc:"Unique key of this request; a retry with the same key and body returns the original response instead of creating the content again"`
+	Body           NewContent
 }
 
 // CreateContentOutput represents the response for creating content
 type CreateContentOutput struct {
-	Body models.Content `json:"body"`
+	ETag     string         `header:"ETag"`
+	Replayed string         `header:"Idempotent-Replayed" doc:"true if this is the saved response of an earlier request with the same Idempotency-Key"`
+	Body     models.Content `json:"body"`
 }
 
 // CreateContent handles POST /content requests
@@ -59,11 +144,16 @@ func (h *ContentHandlers) CreateContent(ctx context.Context, input *CreateConten
 	// Get logger with request ID from context
 	logger := config.GetLoggerWithRequestID(ctx)
 
+	if err := h.authorizeCreate(ctx, input.Body.content("", publisher(ctx))); err != nil {
+		return nil, err
+	}
+
+	if input.IdempotencyKey != "" {
+		return h.createIdempotent(ctx, input)
+	}
+
 	// Generate a ULID for the content ID (lowercase)
-	ts := time.Now().UTC()
-	entropy := ulid.Monotonic(rand.Reader, 0)
-	id := ulid.MustNew(ulid.Timestamp(ts), entropy).String()
-	id = strings.ToLower(id)
+	id := newContentID()
 
 	logger.Info("Creating new content",
 		zap.String("content_id", id),
@@ -71,42 +161,31 @@ func (h *ContentHandlers) CreateContent(ctx context.Context, input *CreateConten
 		zap.String("author", input.Body.Author),
 	)
 
-	if input.Body.Data == nil {
-		input.Body.Data = map[string]interface{}{}
-	}
+	content := input.Body.content(id, publisher(ctx))
 
-	content := &models.Content{
-		ID:     id,
-		Title:  input.Body.Title,
-		Body:   input.Body.Body,
-		Author: input.Body.Author,
-		Status: input.Body.Status,
-		Data:   input.Body.Data,
-	}
-
-	if err := h.store.Create(content); err != nil {
-		logger.Error("Failed to create content",
-			zap.String("content_id", id),
-			zap.Error(err),
-		)
-		return nil, fmt.Errorf("failed to create content: %w", err)
+	if err := h.store.Create(ctx, content); err != nil {
+		return nil, storeError(logger, err, zap.String("content_id", id))
 	}
 
 	logger.Info("Successfully created content",
 		zap.String("content_id", id),
 	)
 
-	return &CreateContentOutput{Body: *content}, nil
+	return &CreateContentOutput{ETag: quoteETag(contentETag(content)), Body: *content}, nil
 }
 
 // GetContentInput represents the request parameters for getting content by ID
 type GetContentInput struct {
+	conditional.Params
 	ID string `path:"id"`
 }
 
 // GetContentOutput represents the response for getting content by ID
 type GetContentOutput struct {
-	Body models.Content `json:"body"`
+	Status       int
+	ETag         string         `header:"ETag"`
+	LastModified time.Time      `header:"Last-Modified"`
+	Body         models.Content `json:"body"`
 }
 
 // GetContent handles GET /content/{id} requests
@@ -118,13 +197,26 @@ func (h *ContentHandlers) GetContent(ctx context.Context, input *GetContentInput
 		zap.String("content_id", input.ID),
 	)
 
-	content, err := h.store.GetByID(input.ID)
+	content, err := h.store.GetByID(ctx, input.ID)
 	if err != nil {
-		logger.Warn("Content not found",
+		return nil, storeError(logger, err, zap.String("content_id", input.ID))
+	}
+	if err := h.authorize(ctx, policy.ActionRead, content); err != nil {
+		return nil, err
+	}
+
+	output := &GetContentOutput{
+		Status:       http.StatusOK,
+		ETag:         quoteETag(contentETag(content)),
+		LastModified: lastModified(content.UpdatedAt),
+	}
+
+	if notModified(&input.Params, contentETag(content), output.LastModified) {
+		logger.Info("Content not modified",
 			zap.String("content_id", input.ID),
-			zap.Error(err),
 		)
-		return nil, huma.Error404NotFound("Content not found")
+		output.Status = http.StatusNotModified
+		return output, nil
 	}
 
 	logger.Info("Successfully retrieved content",
@@ -132,78 +224,520 @@ func (h *ContentHandlers) GetContent(ctx context.Context, input *GetContentInput
 		zap.String("title", content.Title),
 	)
 
-	return &GetContentOutput{Body: *content}, nil
+	output.Body = *content
+	return output, nil
+}
+
+// ListContentInput represents the query parameters for listing content
+type ListContentInput struct {
+	ListConditionalParams
+	Limit         int       `query:"limit" minimum:"1" maximum:"1000" default:"100" doc:"Maximum number of items to return"`
+	Cursor        string    `query:"cursor" doc:"Opaque cursor from next_cursor of the previous page"`
+	Sort          string    `query:"sort" enum:"created_at,-created_at,updated_at,-updated_at,title,-title,author,-author,status,-status" default:"-created_at" doc:"Sort field, prefixed with - for descending order"`
+	Status        string    `query:"status" enum:"draft,published,archived" doc:"Only return content with this status"`
+	Author        string    `query:"author" doc:"Only return content by this author"`
+	CreatedAfter  time.Time `query:"created_after" doc:"Only return content created after this time"`
+	CreatedBefore time.Time `query:"created_before" doc:"Only return content created before this time"`
+	UpdatedSince  time.Time `query:"updated_since" doc:"Only return content updated at or after this time"`
+
+	// Filters on the JSON data column, collected from data.* query parameters
+	// by Resolve since their names are not known up front
+	dataQuery   url.Values
+	dataFilters []models.DataFilter
+}
+
+// Resolve parses data.* query parameters such as data.category=programming or
+// data.tags=contains:go into data filters
+func (i *ListContentInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+	u := ctx.URL()
+	for key, values := range u.Query() {
+		if !strings.HasPrefix(key, models.DataFilterPrefix) {
+			continue
+		}
+		for _, value := range values {
+			filter, err := models.ParseDataFilter(key, value)
+			if err != nil {
+				errs = append(errs, &huma.ErrorDetail{
+					Message:  err.Error(),
+					Location: "query." + key,
+					Value:    value,
+				})
+				continue
+			}
+			if i.dataQuery == nil {
+				i.dataQuery = url.Values{}
+			}
+			i.dataQuery.Add(key, value)
+			i.dataFilters = append(i.dataFilters, filter)
+		}
+	}
+	return errs
+}
+
+// listOptions converts the query parameters into store list options
+func (i *ListContentInput) listOptions() (models.ListOptions, error) {
+	sort, err := models.ParseSort(i.Sort)
+	if err != nil {
+		return models.ListOptions{}, huma.Error400BadRequest("Invalid sort", err)
+	}
+
+	opts := models.ListOptions{
+		Limit:       i.Limit,
+		Sort:        sort,
+		Status:      i.Status,
+		Author:      i.Author,
+		DataFilters: i.dataFilters,
+	}
+	if !i.CreatedAfter.IsZero() {
+		opts.CreatedAfter = &i.CreatedAfter
+	}
+	if !i.CreatedBefore.IsZero() {
+		opts.CreatedBefore = &i.CreatedBefore
+	}
+	if !i.UpdatedSince.IsZero() {
+		opts.UpdatedSince = &i.UpdatedSince
+	}
+
+	if i.Cursor != "" {
+		cursor, err := models.DecodeCursor(i.Cursor, sort)
+		if err != nil {
+			return models.ListOptions{}, huma.Error400BadRequest("Invalid cursor", err)
+		}
+		opts.After = cursor
+	}
+
+	return opts, nil
+}
+
+// nextLink returns the relative URL of the page of path following the given
+// cursor, carrying over the filters and sort of the current request
+func (i *ListContentInput) nextLink(path, cursor string) string {
+	query := url.Values{}
+	for key, values := range i.dataQuery {
+		query[key] = values
+	}
+	query.Set("limit", strconv.Itoa(i.Limit))
+	query.Set("cursor", cursor)
+	if i.Sort != "" {
+		query.Set("sort", i.Sort)
+	}
+	if i.Status != "" {
+		query.Set("status", i.Status)
+	}
+	if i.Author != "" {
+		query.Set("author", i.Author)
+	}
+	if !i.CreatedAfter.IsZero() {
+		query.Set("created_after", i.CreatedAfter.Format(time.RFC3339Nano))
+	}
+	if !i.CreatedBefore.IsZero() {
+		query.Set("created_before", i.CreatedBefore.Format(time.RFC3339Nano))
+	}
+	if !i.UpdatedSince.IsZero() {
+		query.Set("updated_since", i.UpdatedSince.Format(time.RFC3339Nano))
+	}
+	return path + "?" + query.Encode()
 }
 
 // ListContentOutput represents the response for listing content
 type ListContentOutput struct {
-	Body []models.Content `json:"body"`
+	Status int
+	ETag   string `header:"ETag"`
+	Link   string `header:"Link" doc:"Link to the next page with rel=\"next\""`
+	Body   struct {
+		Items      []models.Content `json:"items"`
+		NextCursor string           `json:"next_cursor,omitempty" doc:"Cursor for the next page, omitted on the last page"`
+	}
 }
 
 // ListContent handles GET /content requests
-func (h *ContentHandlers) ListContent(ctx context.Context, input *struct{}) (*ListContentOutput, error) {
-	contents, err := h.store.List()
+func (h *ContentHandlers) ListContent(ctx context.Context, input *ListContentInput) (*ListContentOutput, error) {
+	return h.listContent(ctx, input, "/content", false)
+}
+
+// listContent lists a page of live content, or of the trash if deleted is
+// set, linking the next page relative to path
+func (h *ContentHandlers) listContent(ctx context.Context, input *ListContentInput, path string, deleted bool) (*ListContentOutput, error) {
+	logger := config.GetLoggerWithRequestID(ctx)
+
+	opts, err := input.listOptions()
 	if err != nil {
-		return nil, fmt.Errorf("failed to list content: %w", err)
+		return nil, err
 	}
+	opts.Deleted = deleted
 
-	result := make([]models.Content, len(contents))
-	for i, c := range contents {
-		result[i] = *c
+	// Callers only see the content they may read, or for the trash undelete
+	action := policy.ActionRead
+	if deleted {
+		action = policy.ActionDelete
+	}
+	if opts.Access, err = h.accessFilter(ctx, action); err != nil {
+		return nil, err
 	}
 
-	return &ListContentOutput{Body: result}, nil
+	// Published content outside its publish_at/expire_at window is not
+	// listed as published, even before the scheduler has caught up
+	if opts.Status == statusPublished && !deleted {
+		now := time.Now()
+		opts.VisibleAt = &now
+	}
+
+	page, err := h.store.List(ctx, opts)
+	if err != nil {
+		return nil, storeError(logger, err)
+	}
+
+	output := &ListContentOutput{
+		Status: http.StatusOK,
+		ETag:   quoteETag(listETag(page)),
+	}
+	output.Body.Items = make([]models.Content, len(page.Items))
+	for i, c := range page.Items {
+		output.Body.Items[i] = *c
+	}
+
+	if page.Next != nil {
+		output.Body.NextCursor = page.Next.Encode()
+		output.Link = fmt.Sprintf(`<%s>; rel="next"`, input.nextLink(path, output.Body.NextCursor))
+	}
+
+	if input.notModified(listETag(page)) {
+		output.Status = http.StatusNotModified
+		output.Body.Items = nil
+		output.Body.NextCursor = ""
+	}
+
+	return output, nil
+}
+
+// SearchContentInput represents the query parameters for searching content
+type SearchContentInput struct {
+	Q     string `query:"q" required:"true" minLength:"1" doc:"Words to search for in title and body, all must match"`
+	Limit int    `query:"limit" minimum:"1" maximum:"100" default:"20" doc:"Maximum number of results to return"`
+}
+
+// SearchHit is a single search result with its relevance and highlighted snippets
+type SearchHit struct {
+	Content  models.Content `json:"content"`
+	Rank     float64        `json:"rank" doc:"Relevance score, higher is better; only comparable within one search"`
+	Snippets struct {
+		Title string `json:"title" doc:"Title with matched words wrapped in <mark> tags"`
+		Body  string `json:"body" doc:"Excerpt of the body around the matches, with matched words wrapped in <mark> tags"`
+	} `json:"snippets"`
+}
+
+// SearchContentOutput represents the response for searching content
+type SearchContentOutput struct {
+	Body struct {
+		Items []SearchHit `json:"items"`
+	}
+}
+
+// SearchContent handles GET /content/search requests
+func (h *ContentHandlers) SearchContent(ctx context.Context, input *SearchContentInput) (*SearchContentOutput, error) {
+	logger := config.GetLoggerWithRequestID(ctx)
+
+	access, err := h.accessFilter(ctx, policy.ActionRead)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := h.store.Search(ctx, models.SearchOptions{Query: input.Q, Limit: input.Limit, Access: access})
+	if err != nil {
+		return nil, storeError(logger, err)
+	}
+
+	output := &SearchContentOutput{}
+	output.Body.Items = make([]SearchHit, len(results))
+	for i, r := range results {
+		output.Body.Items[i].Content = *r.Content
+		output.Body.Items[i].Rank = r.Rank
+		output.Body.Items[i].Snippets.Title = r.TitleSnippet
+		output.Body.Items[i].Snippets.Body = r.BodySnippet
+	}
+
+	logger.Info("Searched content",
+		zap.String("query", input.Q),
+		zap.Int("results", len(results)),
+	)
+
+	return output, nil
 }
 
-// UpdateContentInput represents the request body and parameters for updating content
+// UpdateContentInput represents the request body and parameters for replacing content
 type UpdateContentInput struct {
+	conditional.Params
 	ID   string `path:"id"`
 	Body struct {
-		Title  *string                `json:"title"`
-		Body   *string                `json:"body"`
-		Author *string                `json:"author"`
-		Status *string                `json:"status" enum:"draft,published,archived"`
-		Data   map[string]interface{} `json:"data,omitempty"`
+		Title     string                 `json:"title" required:"true"`
+		Body      string                 `json:"body" required:"true"`
+		Author    string                 `json:"author" required:"true"`
+		Status    string                 `json:"status,omitempty" enum:"draft,published,archived" doc:"Left unchanged if omitted; changes must be allowed by the publishing workflow"`
+		Data      map[string]interface{} `json:"data,omitempty"`
+		PublishAt *time.Time             `json:"publish_at,omitempty" doc:"When to publish the draft; published content is not listed as such before"`
+		ExpireAt  *time.Time             `json:"expire_at,omitempty" doc:"When to archive the content once published; it is not listed as published from then on"`
 	}
 }
 
 // UpdateContentOutput represents the response for updating content
 type UpdateContentOutput struct {
+	ETag string         `header:"ETag"`
 	Body models.Content `json:"body"`
 }
 
-// UpdateContent handles PUT /content/{id} requests
-func (h *ContentHandlers) UpdateContent(ctx context.Context, input *UpdateContentInput) (*UpdateContentOutput, error) {
-	content, err := h.store.GetByID(input.ID)
+// ReplaceContentOutput represents the response for replacing content, which
+// PUT may have created
+type ReplaceContentOutput struct {
+	Status   int
+	ETag     string         `header:"ETag"`
+	Location string         `header:"Location" doc:"URL of the content, if it was created"`
+	Body     models.Content `json:"body"`
+}
+
+// maxUpdateAttempts bounds how often an unconditional update is retried when
+// a concurrent writer bumps the version between our read and write
+const maxUpdateAttempts = 3
+
+// UpdateContent handles PUT /content/{id} requests. The body replaces the
+// editable fields of the content entirely; an omitted data becomes {} while
+// an omitted status is left unchanged. Content that does not exist is created
+// under the ID if the client may choose it.
+func (h *ContentHandlers) UpdateContent(ctx context.Context, input *UpdateContentInput) (*ReplaceContentOutput, error) {
+	content, err := h.replaceContent(ctx, input)
+	var statusErr huma.StatusError
+	if errors.As(err, &statusErr) && statusErr.GetStatus() == http.StatusNotFound {
+		return h.createUnderID(ctx, input)
+	}
 	if err != nil {
-		return nil, huma.Error404NotFound("Content not found")
+		return nil, err
 	}
 
-	if input.Body.Title != nil {
-		content.Title = *input.Body.Title
+	return &ReplaceContentOutput{Status: http.StatusOK, ETag: quoteETag(contentETag(content)), Body: *content}, nil
+}
+
+// replaceContent replaces the fields of existing content with those of a PUT
+// request, subject to the policy and the publishing workflow
+func (h *ContentHandlers) replaceContent(ctx context.Context, input *UpdateContentInput) (*models.Content, error) {
+	return h.updateContent(ctx, input.ID, &input.Params, withStatusWorkflow(publisher(ctx), func(content *models.Content) error {
+		content.Title = input.Body.Title
+		content.Body = input.Body.Body
+		content.Author = input.Body.Author
+		if input.Body.Status != "" {
+			content.Status = input.Body.Status
+		}
+		content.Data = input.Body.Data
+		if content.Data == nil {
+			content.Data = map[string]interface{}{}
+		}
+		content.PublishAt = input.Body.PublishAt
+		content.ExpireAt = input.Body.ExpireAt
+		return nil
+	}))
+}
+
+// createUnderID handles a PUT /content/{id} request for content that does not
+// exist by creating it under the ID, answering 201. If a concurrent PUT
+// created the same ID first, the request replaces that content instead, going
+// through the same policy, workflow and version checks as any other replace;
+// If-None-Match: * makes the create fail with 412 instead.
+func (h *ContentHandlers) createUnderID(ctx context.Context, input *UpdateContentInput) (*ReplaceContentOutput, error) {
+	logger := config.GetLoggerWithRequestID(ctx)
+
+	if !h.validClientID(input.ID) {
+		message := "content can only be created under a lowercase ULID"
+		if h.idPattern != nil {
+			message += " or an ID matching " + h.idPattern.String()
+		}
+		return nil, huma.Error404NotFound("Content not found", &huma.ErrorDetail{
+			Message:  message,
+			Location: "path.id",
+			Value:    input.ID,
+		})
 	}
-	if input.Body.Body != nil {
-		content.Body = *input.Body.Body
+	if len(input.IfMatch) > 0 {
+		return nil, huma.Error412PreconditionFailed("Content does not exist")
 	}
-	if input.Body.Author != nil {
-		content.Author = *input.Body.Author
+
+	status := input.Body.Status
+	if status == "" {
+		status = statusDraft
 	}
-	if input.Body.Status != nil {
-		content.Status = *input.Body.Status
+	if status == statusArchived {
+		return nil, huma.Error422UnprocessableEntity("validation failed", &huma.ErrorDetail{
+			Message:  "content is created as draft or published",
+			Location: "body.status",
+			Value:    status,
+		})
 	}
-	if input.Body.Data != nil {
-		content.Data = input.Body.Data
+	if detail := scheduleError(input.Body.PublishAt, input.Body.ExpireAt); detail != nil {
+		detail.Location = "body.expire_at"
+		return nil, huma.Error422UnprocessableEntity("validation failed", detail)
+	}
+
+	content := NewContent{
+		Title:     input.Body.Title,
+		Body:      input.Body.Body,
+		Author:    input.Body.Author,
+		Status:    status,
+		Data:      input.Body.Data,
+		PublishAt: input.Body.PublishAt,
+		ExpireAt:  input.Body.ExpireAt,
+	}.content(input.ID, publisher(ctx))
+	if err := h.authorizeCreate(ctx, content); err != nil {
+		return nil, err
 	}
 
-	if err := h.store.Update(content); err != nil {
-		return nil, fmt.Errorf("failed to update content: %w", err)
+	err := h.store.Create(ctx, content)
+	if errors.Is(err, models.ErrConflict) {
+		if slices.Contains(input.IfNoneMatch, "*") {
+			return nil, huma.Error412PreconditionFailed("Content already exists")
+		}
+		return h.replaceCreated(ctx, input)
+	}
+	if err != nil {
+		return nil, storeError(logger, err, zap.String("content_id", input.ID))
 	}
 
-	return &UpdateContentOutput{Body: *content}, nil
+	logger.Info("Created content under client ID", zap.String("content_id", input.ID))
+	return &ReplaceContentOutput{
+		Status:   http.StatusCreated,
+		ETag:     quoteETag(contentETag(content)),
+		Location: "/content/" + url.PathEscape(input.ID),
+		Body:     *content,
+	}, nil
+}
+
+// replaceCreated handles a PUT /content/{id} request whose create found the ID
+// taken since the content was found missing: live content created
+// concurrently is replaced, while content in the trash answers 409 until it is
+// undeleted
+func (h *ContentHandlers) replaceCreated(ctx context.Context, input *UpdateContentInput) (*ReplaceContentOutput, error) {
+	logger := config.GetLoggerWithRequestID(ctx)
+
+	_, err := h.store.GetByID(ctx, input.ID)
+	if errors.Is(err, models.ErrNotFound) {
+		logger.Info("Content to replace is in the trash", zap.String("content_id", input.ID))
+		return nil, huma.Error409Conflict("Content with this ID is in the trash",
+			&huma.ErrorDetail{
+				Message:  "undelete it with POST /content/{id}/undelete first",
+				Location: "path.id",
+				Value:    input.ID,
+			})
+	}
+	if err != nil {
+		return nil, storeError(logger, err, zap.String("content_id", input.ID))
+	}
+
+	content, err := h.replaceContent(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return &ReplaceContentOutput{Status: http.StatusOK, ETag: quoteETag(contentETag(content)), Body: *content}, nil
+}
+
+// PatchContentInput represents the request body and parameters for patching content
+type PatchContentInput struct {
+	conditional.Params
+	ID          string `path:"id"`
+	ContentType string `header:"Content-Type"`
+	RawBody     []byte
+}
+
+// PatchContentOutput represents the response for patching content
+type PatchContentOutput struct {
+	ETag string         `header:"ETag"`
+	Body models.Content `json:"body"`
+}
+
+// PatchContent handles PATCH /content/{id} requests with either a JSON Merge
+// Patch or a JSON Patch document, both of which can edit keys deep inside data
+func (h *ContentHandlers) PatchContent(ctx context.Context, input *PatchContentInput) (*PatchContentOutput, error) {
+	mediaType, _, _ := mime.ParseMediaType(input.ContentType)
+
+	var apply func(doc interface{}) (interface{}, error)
+	switch mediaType {
+	case MergePatchContentType:
+		var patch interface{}
+		if err := json.Unmarshal(input.RawBody, &patch); err != nil {
+			return nil, huma.Error400BadRequest("Invalid merge patch", err)
+		}
+		apply = func(doc interface{}) (interface{}, error) {
+			return applyMergePatch(doc, deepCopyJSON(patch)), nil
+		}
+	case JSONPatchContentType:
+		var ops []JSONPatchOperation
+		if err := json.Unmarshal(input.RawBody, &ops); err != nil {
+			return nil, huma.Error400BadRequest("Invalid JSON patch", err)
+		}
+		apply = func(doc interface{}) (interface{}, error) {
+			return applyJSONPatch(doc, ops)
+		}
+	default:
+		return nil, huma.Error415UnsupportedMediaType(
+			fmt.Sprintf("Content-Type must be %s or %s", MergePatchContentType, JSONPatchContentType))
+	}
+
+	content, err := h.updateContent(ctx, input.ID, &input.Params, withStatusWorkflow(publisher(ctx), func(content *models.Content) error {
+		return patchContent(content, apply)
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	return &PatchContentOutput{ETag: quoteETag(contentETag(content)), Body: *content}, nil
+}
+
+// updateContent performs a versioned read-modify-write of the content with
+// the given ID, if the policy allows the edit. If a concurrent writer wins the
+// race the whole cycle is retried, unless the client made the request
+// conditional, in which case the preconditions no longer hold and 412 is
+// returned.
+func (h *ContentHandlers) updateContent(ctx context.Context, id string, params *conditional.Params, mutate func(*models.Content) error) (*models.Content, error) {
+	logger := config.GetLoggerWithRequestID(ctx)
+	mutate = h.authorizeEdit(ctx, mutate)
+
+	for attempt := 1; ; attempt++ {
+		content, err := h.store.GetByID(ctx, id)
+		if err != nil {
+			return nil, storeError(logger, err, zap.String("content_id", id))
+		}
+
+		if params.HasConditionalParams() {
+			if err := params.PreconditionFailed(contentETag(content), content.UpdatedAt); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := mutate(content); err != nil {
+			return nil, err
+		}
+
+		err = h.store.Update(ctx, content)
+		if errors.Is(err, models.ErrVersionConflict) {
+			logger.Warn("Concurrent update of content",
+				zap.String("content_id", id),
+				zap.Int("attempt", attempt),
+			)
+			if params.HasConditionalParams() {
+				return nil, huma.Error412PreconditionFailed("Content was modified concurrently")
+			}
+			if attempt < maxUpdateAttempts {
+				continue
+			}
+			return nil, huma.Error409Conflict("Content was modified concurrently, please retry")
+		}
+		if err != nil {
+			return nil, storeError(logger, err, zap.String("content_id", id))
+		}
+
+		return content, nil
+	}
 }
 
 // DeleteContentInput represents the request parameters for deleting content
 type DeleteContentInput struct {
+	conditional.Params
 	ID string `path:"id"`
 }
 
@@ -212,10 +746,37 @@ type DeleteContentOutput struct {
 	Body struct{} `json:"body"`
 }
 
-// DeleteContent handles DELETE /content/{id} requests
+// DeleteContent handles DELETE /content/{id} requests. The content is moved
+// to the trash, after which it is reported as missing like any other.
 func (h *ContentHandlers) DeleteContent(ctx context.Context, input *DeleteContentInput) (*DeleteContentOutput, error) {
-	if err := h.store.Delete(input.ID); err != nil {
-		return nil, huma.Error404NotFound("Content not found")
+	logger := config.GetLoggerWithRequestID(ctx)
+
+	// Without preconditions or a policy the delete is unconditional and needs
+	// no read. The policy is checked against the version read, so that the
+	// delete fails if the content changes in between.
+	expectedVersion := 0
+	if input.HasConditionalParams() || h.policy != nil {
+		content, err := h.store.GetByID(ctx, input.ID)
+		if err != nil {
+			return nil, storeError(logger, err, zap.String("content_id", input.ID))
+		}
+		if input.HasConditionalParams() {
+			if err := input.PreconditionFailed(contentETag(content), content.UpdatedAt); err != nil {
+				return nil, err
+			}
+		}
+		if err := h.authorize(ctx, policy.ActionDelete, content); err != nil {
+			return nil, err
+		}
+		expectedVersion = content.Version
+	}
+
+	err := h.store.Delete(ctx, input.ID, expectedVersion)
+	if errors.Is(err, models.ErrVersionConflict) && input.HasConditionalParams() {
+		return nil, huma.Error412PreconditionFailed("Content was modified concurrently")
+	}
+	if err != nil {
+		return nil, storeError(logger, err, zap.String("content_id", input.ID))
 	}
 	return &DeleteContentOutput{}, nil
 }
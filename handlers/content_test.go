@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/adapters/humachi"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+
+	"github.com/seenthis-ab/content-api/config"
+	"github.com/seenthis-ab/content-api/middleware"
+	"github.com/seenthis-ab/content-api/models"
+	"github.com/seenthis-ab/content-api/policy"
+)
+
+// testSecret signs the bearer tokens of test callers
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// testAPI serves the content endpoints as main does, over a memory store.
+// Anonymous callers may read, callers with a bearer token from testSecret
+// may also write.
+type testAPI struct {
+	store    *models.MemoryContentStore
+	handlers *ContentHandlers
+	handler  http.Handler
+}
+
+// newTestAPI creates the API with the policy, nil allowing everything
+func newTestAPI(t *testing.T, contentPolicy *policy.Policy) *testAPI {
+	t.Helper()
+
+	previous := config.GetLogger()
+	config.SetLogger(zap.NewNop())
+	t.Cleanup(func() { config.SetLogger(previous) })
+
+	verifier, err := middleware.NewTokenVerifier(&config.JWTConfig{Secret: testSecret})
+	if err != nil {
+		t.Fatalf("NewTokenVerifier: %v", err)
+	}
+
+	store := models.NewMemoryContentStore()
+	router := chi.NewMux()
+	router.Use(middleware.AuthMiddleware(store, &config.AuthConfig{AnonymousScopes: []string{middleware.ScopeContentRead}}, verifier))
+	router.Use(middleware.LoggingMiddleware(&config.AccessLogConfig{}))
+	api := humachi.New(router, huma.DefaultConfig("Content API", "1.0.0"))
+	api.UseMiddleware(middleware.RequireScopes(api))
+	read := middleware.Scope(middleware.ScopeContentRead)
+	write := middleware.Scope(middleware.ScopeContentWrite)
+
+	h := NewContentHandlers(store, &config.IdempotencyConfig{TTL: time.Hour}, &config.ContentIDConfig{}, contentPolicy)
+	huma.Post(api, "/content", h.CreateContent, write)
+	huma.Get(api, "/content/search", h.SearchContent, read)
+	huma.Get(api, "/content/{id}", h.GetContent, read)
+	huma.Get(api, "/content", h.ListContent, read)
+	huma.Put(api, "/content/{id}", h.UpdateContent, write)
+	RegisterPatchContent(api, h, write)
+	huma.Delete(api, "/content/{id}", h.DeleteContent, write)
+	huma.Post(api, "/content/{id}/publish", h.PublishContent, write)
+	huma.Post(api, "/content/{id}/unpublish", h.UnpublishContent, write)
+	huma.Post(api, "/content/{id}/archive", h.ArchiveContent, write)
+	huma.Get(api, "/content/trash", h.ListTrash, read)
+	huma.Post(api, "/content/{id}/undelete", h.UndeleteContent, write)
+	huma.Get(api, "/content/{id}/revisions", h.ListRevisions, read)
+	huma.Get(api, "/content/{id}/revisions/{rev}", h.GetRevision, read)
+	huma.Get(api, "/content/{id}/revisions/{rev}/diff", h.DiffRevisions, read)
+	huma.Post(api, "/content/{id}/revisions/{rev}/restore", h.RestoreRevision, write)
+
+	return &testAPI{store: store, handlers: h, handler: router}
+}
+
+// testPolicy loads the example policy of the repository, under which
+// callers are authors of their own content unless their token grants the
+// reader, editor or admin role
+func testPolicy(t *testing.T) *policy.Policy {
+	t.Helper()
+
+	contentPolicy, err := policy.Load("../config/policy.json")
+	if err != nil {
+		t.Fatalf("failed to load policy: %v", err)
+	}
+	return contentPolicy
+}
+
+// testToken returns a bearer token for the subject with the read and write
+// scopes and the given policy roles
+func testToken(t *testing.T, subject string, roles ...string) string {
+	t.Helper()
+
+	claims := jwt.MapClaims{
+		"sub":   subject,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": middleware.ScopeContentRead + " " + middleware.ScopeContentWrite,
+	}
+	if len(roles) > 0 {
+		claims["roles"] = roles
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(testSecret)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return token
+}
+
+// request sends a request with the bearer token, anonymously if it is
+// empty. A string body is sent as is, anything else but nil as JSON. headers
+// are pairs of header names and values.
+func (a *testAPI) request(t *testing.T, token, method, path string, body any, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader io.Reader
+	switch body := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(body)
+	default:
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("failed to encode request body: %v", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	recorder := httptest.NewRecorder()
+	a.handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// create creates content with the fields of body as the caller of the token
+func (a *testAPI) create(t *testing.T, token string, body map[string]any) models.Content {
+	t.Helper()
+
+	fields := map[string]any{"title": "Title", "body": "Body", "author": "alice", "status": "draft"}
+	for name, value := range body {
+		fields[name] = value
+	}
+	resp := a.request(t, token, http.MethodPost, "/content", fields)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("create = %d %s", resp.Code, resp.Body)
+	}
+	return decode[models.Content](t, resp)
+}
+
+// decode decodes a JSON response body
+func decode[T any](t *testing.T, resp *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var body T
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response %q: %v", resp.Body, err)
+	}
+	return body
+}
+
+// TestIfMatch checks that writes with an If-Match header only succeed
+// while the content still has that ETag, answering 412 otherwise
+func TestIfMatch(t *testing.T) {
+	api := newTestAPI(t, nil)
+	token := testToken(t, "alice")
+	put := map[string]any{"title": "Changed", "body": "Body", "author": "alice", "status": "draft"}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string // below /content/{id}
+		body    any
+		headers []string
+	}{
+		{"PUT", http.MethodPut, "", put, nil},
+		{"PATCH", http.MethodPatch, "", `{"title": "Patched"}`, []string{"Content-Type", MergePatchContentType}},
+		{"publish", http.MethodPost, "/publish", nil, nil},
+		{"DELETE", http.MethodDelete, "", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := api.create(t, token, nil)
+			path := "/content/" + content.ID + tt.path
+			stale := api.request(t, token, http.MethodGet, "/content/"+content.ID, nil).Header().Get("ETag")
+
+			// Another caller changes the content after it was read
+			if resp := api.request(t, token, http.MethodPut, "/content/"+content.ID, put); resp.Code != http.StatusOK {
+				t.Fatalf("PUT = %d %s", resp.Code, resp.Body)
+			}
+			current := api.request(t, token, http.MethodGet, "/content/"+content.ID, nil).Header().Get("ETag")
+			if current == stale {
+				t.Fatalf("ETag %s did not change with the content", current)
+			}
+
+			resp := api.request(t, token, tt.method, path, tt.body, append([]string{"If-Match", stale}, tt.headers...)...)
+			if resp.Code != http.StatusPreconditionFailed {
+				t.Errorf("with a stale If-Match = %d %s, want 412", resp.Code, resp.Body)
+			}
+
+			resp = api.request(t, token, tt.method, path, tt.body, append([]string{"If-Match", current}, tt.headers...)...)
+			if resp.Code != http.StatusOK {
+				t.Errorf("with the current If-Match = %d %s, want success", resp.Code, resp.Body)
+			}
+		})
+	}
+}
+
+// TestUnconditionalUpdateVersion checks that writes without preconditions
+// always apply and bump the version and ETag
+func TestUnconditionalUpdateVersion(t *testing.T) {
+	api := newTestAPI(t, nil)
+	token := testToken(t, "alice")
+	content := api.create(t, token, nil)
+
+	resp := api.request(t, token, http.MethodPut, "/content/"+content.ID,
+		map[string]any{"title": "Changed", "body": "Body", "author": "alice", "status": "draft"})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s", resp.Code, resp.Body)
+	}
+	updated := decode[models.Content](t, resp)
+	if updated.Version != content.Version+1 || updated.Title != "Changed" {
+		t.Errorf("got version %d title %q, want version %d title Changed", updated.Version, updated.Title, content.Version+1)
+	}
+	if etag := resp.Header().Get("ETag"); etag != quoteETag(contentETag(&updated)) {
+		t.Errorf("got ETag %s for version %d", etag, updated.Version)
+	}
+}
+
+// TestPutCreates checks that PUT creates missing content under the ID with
+// 201 and replaces existing content with 200, and the cases in which it does
+// neither
+func TestPutCreates(t *testing.T) {
+	api := newTestAPI(t, nil)
+	token := testToken(t, "alice")
+	body := map[string]any{"title": "Title", "body": "Body", "author": "alice"}
+	id := newContentID()
+	path := "/content/" + id
+
+	resp := api.request(t, token, http.MethodPut, path, body)
+	if resp.Code != http.StatusCreated || resp.Header().Get("Location") != path {
+		t.Fatalf("PUT of missing content = %d %s, Location %q, want 201 at %s", resp.Code, resp.Body, resp.Header().Get("Location"), path)
+	}
+	if created := decode[models.Content](t, resp); created.ID != id || created.Version != 1 || created.Status != statusDraft {
+		t.Errorf("created %s version %d status %s, want %s version 1 draft", created.ID, created.Version, created.Status, id)
+	}
+
+	resp = api.request(t, token, http.MethodPut, path, body)
+	if resp.Code != http.StatusOK || resp.Header().Get("Location") != "" {
+		t.Fatalf("PUT of existing content = %d %s, want 200", resp.Code, resp.Body)
+	}
+	if replaced := decode[models.Content](t, resp); replaced.Version != 2 {
+		t.Errorf("replaced content has version %d, want 2", replaced.Version)
+	}
+
+	tests := []struct {
+		name    string
+		id      string
+		body    map[string]any
+		headers []string
+		status  int
+	}{
+		{"only create existing", id, body, []string{"If-None-Match", "*"}, http.StatusPreconditionFailed},
+		{"only create missing", newContentID(), body, []string{"If-None-Match", "*"}, http.StatusCreated},
+		{"replace missing", newContentID(), body, []string{"If-Match", `"1-x"`}, http.StatusPreconditionFailed},
+		{"uppercase ID", strings.ToUpper(newContentID()), body, nil, http.StatusNotFound},
+		{"other ID", "legacy-1234", body, nil, http.StatusNotFound},
+		{"archived", newContentID(), map[string]any{"title": "Title", "body": "Body", "author": "alice", "status": "archived"}, nil, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := api.request(t, token, http.MethodPut, "/content/"+tt.id, tt.body, tt.headers...)
+			if resp.Code != tt.status {
+				t.Errorf("got %d %s, want %d", resp.Code, resp.Body, tt.status)
+			}
+		})
+	}
+
+	// An ID in the trash is not taken over until the content is undeleted
+	if resp := api.request(t, token, http.MethodDelete, path, nil); resp.Code != http.StatusOK {
+		t.Fatalf("DELETE = %d %s", resp.Code, resp.Body)
+	}
+	if resp := api.request(t, token, http.MethodPut, path, body); resp.Code != http.StatusConflict {
+		t.Errorf("PUT of content in the trash = %d %s, want 409", resp.Code, resp.Body)
+	}
+	if resp := api.request(t, token, http.MethodPost, path+"/undelete", nil); resp.Code != http.StatusOK {
+		t.Fatalf("undelete = %d %s", resp.Code, resp.Body)
+	}
+	if resp := api.request(t, token, http.MethodPut, path, body); resp.Code != http.StatusOK {
+		t.Errorf("PUT of undeleted content = %d %s, want 200", resp.Code, resp.Body)
+	}
+}
+
+// TestPutCreatedConcurrently checks that a PUT finding its ID taken when it
+// goes to create the content, because another request created it in the
+// meantime, replaces that content only if the caller may edit it
+func TestPutCreatedConcurrently(t *testing.T) {
+	api := newTestAPI(t, testPolicy(t))
+	alice := testToken(t, "alice")
+
+	put := func(subject string, content models.Content) (*ReplaceContentOutput, error) {
+		caller := &middleware.Caller{Claims: &middleware.Claims{Subject: subject}}
+		ctx := context.WithValue(context.Background(), middleware.CallerKey, caller)
+		input := &UpdateContentInput{ID: content.ID}
+		input.Body.Title = "Replaced"
+		input.Body.Body = "Body"
+		input.Body.Author = subject
+		return api.handlers.createUnderID(ctx, input)
+	}
+
+	content := api.create(t, alice, nil)
+	if _, err := put("bob", content); errorStatus(err) != http.StatusForbidden {
+		t.Errorf("replacing another author's content = %v, want 403", err)
+	}
+	output, err := put("alice", content)
+	if err != nil {
+		t.Fatalf("replacing own content: %v", err)
+	}
+	if output.Status != http.StatusOK || output.Body.Title != "Replaced" || output.Body.Version != 2 {
+		t.Errorf("got %d %q version %d, want 200 Replaced version 2", output.Status, output.Body.Title, output.Body.Version)
+	}
+
+	if resp := api.request(t, testToken(t, "admin", "admin"), http.MethodDelete, "/content/"+content.ID, nil); resp.Code != http.StatusOK {
+		t.Fatalf("DELETE = %d %s", resp.Code, resp.Body)
+	}
+	if _, err := put("alice", content); errorStatus(err) != http.StatusConflict {
+		t.Errorf("replacing content in the trash = %v, want 409", err)
+	}
+}
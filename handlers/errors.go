@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"go.uber.org/zap"
+
+	"github.com/seenthis-ab/content-api/models"
+)
+
+// StatusClientClosedRequest is the non-standard status used when the client
+// went away before the response could be written
+const StatusClientClosedRequest = 499
+
+// unavailableRetryAfter is the Retry-After value, in seconds, sent with 503
+// responses when the database is unavailable
+const unavailableRetryAfter = "1"
+
+// storeError maps an error returned by the content store to an HTTP problem
+// details response (RFC 9457) and logs it at a level matching its cause:
+//
+//   - ErrNotFound: 404
+//   - ErrVersionConflict, ErrConflict and unique violations: 409
+//   - other constraint violations: 422
+//   - ErrUnavailable: 503 with Retry-After
+//   - ErrCanceled: 499, ErrDeadlineExceeded: 504
+//   - anything else: 500, without exposing the underlying error
+//
+// Callers that give version conflicts a different meaning, such as 412 for a
+// failed precondition, must check for them before calling storeError.
+func storeError(logger *zap.Logger, err error, fields ...zap.Field) error {
+	fields = append(fields, zap.Error(err))
+
+	var constraintErr *models.ConstraintError
+	switch {
+	case errors.Is(err, models.ErrCanceled):
+		canceled, _ := models.CancellationStats()
+		logger.Warn("Store operation canceled", append(fields, zap.Int64("canceled_total", canceled))...)
+		return huma.NewError(StatusClientClosedRequest, "Request canceled")
+	case errors.Is(err, models.ErrDeadlineExceeded):
+		_, deadlineExceeded := models.CancellationStats()
+		logger.Warn("Store operation deadline exceeded", append(fields, zap.Int64("deadline_exceeded_total", deadlineExceeded))...)
+		return huma.Error504GatewayTimeout("Request timed out")
+	case errors.Is(err, models.ErrNotFound):
+		logger.Info("Content not found", fields...)
+		return huma.Error404NotFound("Content not found")
+	case errors.Is(err, models.ErrVersionConflict):
+		logger.Warn("Content was modified concurrently", fields...)
+		return huma.Error409Conflict("Content was modified concurrently, please retry")
+	case errors.Is(err, models.ErrConflict):
+		logger.Warn("Content conflicts with existing content", fields...)
+		return huma.Error409Conflict("Content conflicts with existing content", constraintDetails(err)...)
+	case errors.As(err, &constraintErr):
+		logger.Warn("Content violates a constraint", fields...)
+		return huma.Error422UnprocessableEntity("Content violates a constraint", constraintDetails(err)...)
+	case errors.Is(err, models.ErrUnavailable):
+		logger.Error("Database unavailable", fields...)
+		return huma.ErrorWithHeaders(
+			huma.Error503ServiceUnavailable("Database unavailable, please retry"),
+			http.Header{"Retry-After": {unavailableRetryAfter}},
+		)
+	default:
+		logger.Error("Store operation failed", fields...)
+		return huma.Error500InternalServerError("Internal server error")
+	}
+}
+
+// constraintDetails describes the violated constraint, if any, as error
+// details without exposing the driver's message
+func constraintDetails(err error) []error {
+	var constraintErr *models.ConstraintError
+	if !errors.As(err, &constraintErr) {
+		return nil
+	}
+	return []error{&huma.ErrorDetail{
+		Message:  string(constraintErr.Kind) + " constraint violated",
+		Location: constraintErr.Constraint,
+	}}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2/conditional"
+
+	"github.com/seenthis-ab/content-api/models"
+)
+
+// contentETag returns the strong entity tag of a content record, without
+// quotes. It changes whenever the record is updated since it is derived from
+// the version, and differs between content created under the same ID after a
+// purge, whose versions start over, since it includes the creation time. The
+// time is in microseconds, the resolution Postgres stores.
+func contentETag(content *models.Content) string {
+	return strconv.Itoa(content.Version) + "-" + strconv.FormatInt(content.CreatedAt.UnixMicro(), 36)
+}
+
+// listETag returns the strong entity tag of a page of content, without
+// quotes. It is a digest of the id and entity tag of every item and of the
+// next cursor, so it changes when any item changes, appears or disappears.
+func listETag(page *models.ContentPage) string {
+	h := sha256.New()
+	for _, c := range page.Items {
+		h.Write([]byte(c.ID))
+		h.Write([]byte{':'})
+		h.Write([]byte(contentETag(c)))
+		h.Write([]byte{'\n'})
+	}
+	if page.Next != nil {
+		h.Write([]byte(page.Next.Encode()))
+	}
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:16])
+}
+
+// quoteETag formats an entity tag for use in the ETag response header
+func quoteETag(etag string) string {
+	return `"` + etag + `"`
+}
+
+// lastModified converts a modification time to the resolution of the
+// Last-Modified header, so that comparisons with If-Modified-Since round-trip
+func lastModified(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+// notModified reports whether a conditional GET can be answered with 304 Not
+// Modified. As required by RFC 9110, If-Modified-Since is ignored when the
+// request also carries If-None-Match.
+func notModified(params *conditional.Params, etag string, modified time.Time) bool {
+	if !params.HasConditionalParams() {
+		return false
+	}
+	if len(params.IfNoneMatch) > 0 {
+		params.IfModifiedSince = time.Time{}
+	}
+	return params.PreconditionFailed(etag, modified) != nil
+}
+
+// ListConditionalParams holds the conditional request headers of lists. Lists
+// only support If-None-Match: a Last-Modified derived from the items on a page
+// could not move when one of them is deleted, so If-Modified-Since would
+// answer 304 for a page that changed.
+type ListConditionalParams struct {
+	IfNoneMatch []string `header:"If-None-Match" doc:"Succeeds if the page's ETag matches none of the passed values. Send the ETag of a previous response to get 304 Not Modified while the page is unchanged."`
+}
+
+// notModified reports whether a conditional list request can be answered
+// with 304 Not Modified
+func (p *ListConditionalParams) notModified(etag string) bool {
+	params := conditional.Params{IfNoneMatch: p.IfNoneMatch}
+	return notModified(&params, etag, time.Time{})
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/seenthis-ab/content-api/config"
+	"github.com/seenthis-ab/content-api/middleware"
+	"github.com/seenthis-ab/content-api/models"
+)
+
+// readyTimeout bounds the store checks of a readiness probe, so that a hung
+// database fails the probe instead of stalling it
+const readyTimeout = 2 * time.Second
+
+// HealthHandlers serves the liveness and readiness probes
+type HealthHandlers struct {
+	store   models.HealthStore
+	drainer *middleware.Drainer
+}
+
+// NewHealthHandlers creates a new HealthHandlers instance
+func NewHealthHandlers(store models.HealthStore, drainer *middleware.Drainer) *HealthHandlers {
+	return &HealthHandlers{store: store, drainer: drainer}
+}
+
+// HealthCheck is the result of a single readiness check
+type HealthCheck struct {
+	Status string `json:"status" enum:"ok,failing"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// HealthStatus is the result of a probe
+type HealthStatus struct {
+	Status string                 `json:"status" enum:"ok,failing"`
+	Checks map[string]HealthCheck `json:"checks,omitempty" doc:"Readiness checks by name: store, migrations and shutdown"`
+}
+
+// HealthOutput represents the response of a probe
+type HealthOutput struct {
+	Status int
+	Body   HealthStatus
+}
+
+// Healthz handles GET /healthz requests. It only reports that the process is
+// serving requests, so that a failing database does not get it restarted.
+func (h *HealthHandlers) Healthz(ctx context.Context, input *struct{}) (*HealthOutput, error) {
+	return &HealthOutput{Status: http.StatusOK, Body: HealthStatus{Status: "ok"}}, nil
+}
+
+// Readyz handles GET /readyz requests, returning 503 unless the store can be
+// reached, its migrations are at the expected version and the server is not
+// shutting down
+func (h *HealthHandlers) Readyz(ctx context.Context, input *struct{}) (*HealthOutput, error) {
+	logger := config.GetLoggerWithRequestID(ctx)
+
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+
+	checks := map[string]HealthCheck{}
+	if err := h.store.Ping(ctx); err != nil {
+		logger.Warn("Readiness check failed: store unreachable", zap.Error(err))
+		checks["store"] = HealthCheck{Status: "failing", Detail: "database unreachable"}
+	} else {
+		checks["store"] = HealthCheck{Status: "ok"}
+	}
+
+	version, dirty, err := h.store.MigrationVersion(ctx)
+	switch {
+	case err != nil:
+		logger.Warn("Readiness check failed: migration version unknown", zap.Error(err))
+		checks["migrations"] = HealthCheck{Status: "failing", Detail: "migration version unknown"}
+	case dirty:
+		checks["migrations"] = HealthCheck{
+			Status: "failing",
+			Detail: fmt.Sprintf("migration %d failed halfway and must be fixed by hand", version),
+		}
+	case version != models.LatestMigration:
+		checks["migrations"] = HealthCheck{
+			Status: "failing",
+			Detail: fmt.Sprintf("at version %d, expected %d", version, models.LatestMigration),
+		}
+	default:
+		checks["migrations"] = HealthCheck{Status: "ok", Detail: fmt.Sprintf("at version %d", version)}
+	}
+
+	if h.drainer.Draining() {
+		checks["shutdown"] = HealthCheck{Status: "failing", Detail: "server is shutting down"}
+	} else {
+		checks["shutdown"] = HealthCheck{Status: "ok"}
+	}
+
+	output := &HealthOutput{Status: http.StatusOK, Body: HealthStatus{Status: "ok", Checks: checks}}
+	for _, check := range checks {
+		if check.Status != "ok" {
+			output.Status = http.StatusServiceUnavailable
+			output.Body.Status = "failing"
+		}
+	}
+	return output, nil
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/adapters/humachi"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/seenthis-ab/content-api/config"
+	"github.com/seenthis-ab/content-api/middleware"
+	"github.com/seenthis-ab/content-api/models"
+)
+
+// migrationStore is the in-memory store at a given migration version
+type migrationStore struct {
+	*models.MemoryContentStore
+	version int
+	dirty   bool
+}
+
+func (s migrationStore) MigrationVersion(ctx context.Context) (int, bool, error) {
+	return s.version, s.dirty, nil
+}
+
+// newHealthAPI serves the probes as main does, behind the access log, and
+// returns the entries logged
+func newHealthAPI(t *testing.T, store models.HealthStore, drainer *middleware.Drainer) (http.Handler, *observer.ObservedLogs) {
+	t.Helper()
+
+	previous := config.GetLogger()
+	core, logs := observer.New(zap.InfoLevel)
+	config.SetLogger(zap.New(core))
+	t.Cleanup(func() { config.SetLogger(previous) })
+
+	router := chi.NewMux()
+	router.Use(middleware.LoggingMiddleware(&config.AccessLogConfig{SkipPaths: []string{"/healthz", "/readyz"}}))
+	api := humachi.New(router, huma.DefaultConfig("Content API", "1.0.0"))
+
+	health := NewHealthHandlers(store, drainer)
+	huma.Get(api, "/healthz", health.Healthz)
+	huma.Get(api, "/readyz", health.Readyz)
+	return router, logs
+}
+
+// probe calls a probe and decodes its body
+func probe(t *testing.T, handler http.Handler, path string) (int, HealthStatus) {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	var body HealthStatus
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode %s response %q: %v", path, recorder.Body, err)
+	}
+	return recorder.Code, body
+}
+
+func TestReadyz(t *testing.T) {
+	memory := models.NewMemoryContentStore()
+	ok := HealthCheck{Status: "ok"}
+	upToDate := HealthCheck{Status: "ok", Detail: fmt.Sprintf("at version %d", models.LatestMigration)}
+
+	tests := []struct {
+		name     string
+		store    models.HealthStore
+		draining bool
+		status   int
+		checks   map[string]HealthCheck
+	}{
+		{"healthy", memory, false, http.StatusOK, map[string]HealthCheck{
+			"store": ok, "migrations": upToDate, "shutdown": ok,
+		}},
+		{"dirty", migrationStore{memory, models.LatestMigration, true}, false, http.StatusServiceUnavailable, map[string]HealthCheck{
+			"store":      ok,
+			"migrations": {Status: "failing", Detail: fmt.Sprintf("migration %d failed halfway and must be fixed by hand", models.LatestMigration)},
+			"shutdown":   ok,
+		}},
+		{"behind on migrations", migrationStore{memory, models.LatestMigration - 1, false}, false, http.StatusServiceUnavailable, map[string]HealthCheck{
+			"store":      ok,
+			"migrations": {Status: "failing", Detail: fmt.Sprintf("at version %d, expected %d", models.LatestMigration-1, models.LatestMigration)},
+			"shutdown":   ok,
+		}},
+		{"draining", memory, true, http.StatusServiceUnavailable, map[string]HealthCheck{
+			"store":      ok,
+			"migrations": upToDate,
+			"shutdown":   {Status: "failing", Detail: "server is shutting down"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drainer := middleware.NewDrainer()
+			if tt.draining {
+				drainer.Start()
+			}
+			handler, _ := newHealthAPI(t, tt.store, drainer)
+
+			status, body := probe(t, handler, "/readyz")
+			wantStatus := "ok"
+			if tt.status != http.StatusOK {
+				wantStatus = "failing"
+			}
+			if status != tt.status || body.Status != wantStatus {
+				t.Errorf("got %d %q, want %d %q", status, body.Status, tt.status, wantStatus)
+			}
+			if len(body.Checks) != len(tt.checks) {
+				t.Errorf("got checks %v, want %v", body.Checks, tt.checks)
+			}
+			for name, want := range tt.checks {
+				if got := body.Checks[name]; got != want {
+					t.Errorf("check %s = %+v, want %+v", name, got, want)
+				}
+			}
+
+			// Liveness does not depend on the database or shutting down
+			if status, body := probe(t, handler, "/healthz"); status != http.StatusOK || body.Status != "ok" {
+				t.Errorf("healthz = %d %q, want 200 ok", status, body.Status)
+			}
+		})
+	}
+}
+
+// TestProbesNotLogged checks that probes are left out of the access log
+// while other requests are still logged
+func TestProbesNotLogged(t *testing.T) {
+	handler, logs := newHealthAPI(t, models.NewMemoryContentStore(), middleware.NewDrainer())
+
+	for _, path := range []string{"/healthz", "/readyz", "/missing"} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Header().Get("X-Request-Id") == "" {
+			t.Errorf("%s response has no X-Request-Id", path)
+		}
+	}
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		if n := logs.FilterField(zap.String("path", path)).Len(); n != 0 {
+			t.Errorf("got %d access log entries for %s, want none", n, path)
+		}
+	}
+	if n := logs.FilterField(zap.String("path", "/missing")).Len(); n != 2 {
+		t.Errorf("got %d access log entries for /missing, want started and completed", n)
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"go.uber.org/zap"
+
+	"github.com/seenthis-ab/content-api/config"
+	"github.com/seenthis-ab/content-api/middleware"
+	"github.com/seenthis-ab/content-api/models"
+)
+
+// createIdempotent handles POST /content requests with an Idempotency-Key
+// header. The first request with a key creates the content and saves the
+// response together with the key; retries with the same body get that
+// response back until the key expires, and other bodies are rejected. Keys
+// are scoped to the caller, so that a key sent by another caller neither
+// replays its response nor clashes with it. Failed requests save nothing, so
+// they may be retried with the same key.
+func (h *ContentHandlers) createIdempotent(ctx context.Context, input *CreateContentInput) (*CreateContentOutput, error) {
+	logger := config.GetLoggerWithRequestID(ctx).With(zap.String("idempotency_key", input.IdempotencyKey))
+
+	hash, err := requestHash(input.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	caller := middleware.GetCaller(ctx).Identity()
+	output, err := h.savedResponse(ctx, logger, caller, input.IdempotencyKey, hash)
+	if output != nil || err != nil {
+		return output, err
+	}
+
+	id := newContentID()
+
+	logger.Info("Creating new content",
+		zap.String("content_id", id),
+		zap.String("title", input.Body.Title),
+		zap.String("author", input.Body.Author),
+	)
+
+	content := input.Body.content(id, publisher(ctx))
+	key := &models.IdempotencyKey{
+		Caller:      caller,
+		Key:         input.IdempotencyKey,
+		RequestHash: hash,
+		ExpiresAt:   time.Now().Add(h.idempotencyTTL),
+	}
+
+	err = h.store.CreateIdempotent(ctx, content, key)
+	if errors.Is(err, models.ErrConflict) {
+		// A concurrent request with the same key got there first
+		output, err := h.savedResponse(ctx, logger, caller, input.IdempotencyKey, hash)
+		if output != nil || err != nil {
+			return output, err
+		}
+	}
+	if err != nil {
+		return nil, storeError(logger, err, zap.String("content_id", id))
+	}
+
+	logger.Info("Successfully created content",
+		zap.String("content_id", id),
+	)
+
+	return &CreateContentOutput{ETag: quoteETag(contentETag(content)), Body: *content}, nil
+}
+
+// savedResponse returns the saved response of an earlier request of the
+// caller with the given idempotency key, 422 if that request had a different
+// body, or nil if the caller is not using the key
+func (h *ContentHandlers) savedResponse(ctx context.Context, logger *zap.Logger, caller, key, hash string) (*CreateContentOutput, error) {
+	saved, err := h.store.GetIdempotencyKey(ctx, caller, key)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, storeError(logger, err)
+	}
+
+	if saved.RequestHash != hash {
+		return nil, huma.Error422UnprocessableEntity("Idempotency-Key was already used with a different request",
+			&huma.ErrorDetail{
+				Message:  "use a new key for a different request",
+				Location: "header.Idempotency-Key",
+				Value:    key,
+			})
+	}
+
+	var content models.Content
+	if err := json.Unmarshal(saved.Response, &content); err != nil {
+		logger.Error("Failed to decode saved response", zap.Error(err))
+		return nil, huma.Error500InternalServerError("Failed to replay response")
+	}
+
+	logger.Info("Replaying saved response",
+		zap.String("content_id", saved.ContentID),
+	)
+
+	return &CreateContentOutput{
+		ETag:     quoteETag(contentETag(&content)),
+		Replayed: "true",
+		Body:     content,
+	}, nil
+}
+
+// requestHash identifies the body of a create request independently of its
+// formatting, key order and omitted defaults
+func requestHash(body NewContent) (string, error) {
+	canonical, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/seenthis-ab/content-api/middleware"
+	"github.com/seenthis-ab/content-api/models"
+)
+
+// TestIdempotentCreate checks that a retried create with the same
+// Idempotency-Key and body replays the saved response instead of creating
+// the content again, and that the key is rejected with 422 for another body
+func TestIdempotentCreate(t *testing.T) {
+	api := newTestAPI(t, nil)
+	token := testToken(t, "alice")
+	body := map[string]any{"title": "Title", "body": "Body", "author": "alice", "status": "draft"}
+
+	first := api.request(t, token, http.MethodPost, "/content", body, "Idempotency-Key", "order-42")
+	if first.Code != http.StatusOK || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("first create = %d %s, replayed %q", first.Code, first.Body, first.Header().Get("Idempotent-Replayed"))
+	}
+	created := decode[models.Content](t, first)
+
+	retry := api.request(t, token, http.MethodPost, "/content", body, "Idempotency-Key", "order-42")
+	if retry.Code != http.StatusOK || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("retry = %d %s, replayed %q, want a replayed 200", retry.Code, retry.Body, retry.Header().Get("Idempotent-Replayed"))
+	}
+	if replayed := decode[models.Content](t, retry); replayed.ID != created.ID {
+		t.Errorf("retry created %s, want the replayed %s", replayed.ID, created.ID)
+	}
+	if etag := retry.Header().Get("ETag"); etag != first.Header().Get("ETag") {
+		t.Errorf("retry has ETag %s, want %s", etag, first.Header().Get("ETag"))
+	}
+
+	other := map[string]any{"title": "Other", "body": "Body", "author": "alice", "status": "draft"}
+	if resp := api.request(t, token, http.MethodPost, "/content", other, "Idempotency-Key", "order-42"); resp.Code != http.StatusUnprocessableEntity {
+		t.Errorf("same key with another body = %d %s, want 422", resp.Code, resp.Body)
+	}
+
+	page, err := api.store.List(context.Background(), models.ListOptions{Limit: 10})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(page.Items) != 1 {
+		t.Errorf("got %d content records, want 1", len(page.Items))
+	}
+}
+
+// TestIdempotencyKeyScope checks that keys belong to the caller that sent
+// them: other token subjects and API keys using the same key create their
+// own content, even a token whose subject looks like the API key's identity
+func TestIdempotencyKeyScope(t *testing.T) {
+	api := newTestAPI(t, nil)
+	apiKey, secret := models.NewAPIKey("test", []string{middleware.ScopeContentRead, middleware.ScopeContentWrite})
+	if err := api.store.CreateAPIKey(context.Background(), apiKey); err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	body := map[string]any{"title": "Title", "body": "Body", "author": "alice", "status": "draft"}
+
+	callers := []struct {
+		name    string
+		token   string
+		headers []string
+	}{
+		{"token", testToken(t, "alice"), nil},
+		{"other token", testToken(t, "bob"), nil},
+		{"API key", "", []string{middleware.APIKeyHeader, secret}},
+		{"token named like the API key", testToken(t, "api-key:"+apiKey.ID), nil},
+		{"token named anonymous", testToken(t, "anonymous"), nil},
+	}
+	ids := map[string]string{}
+	for _, caller := range callers {
+		headers := append([]string{"Idempotency-Key", "order-42"}, caller.headers...)
+		resp := api.request(t, caller.token, http.MethodPost, "/content", body, headers...)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("create as %s = %d %s", caller.name, resp.Code, resp.Body)
+		}
+		if replayed := resp.Header().Get("Idempotent-Replayed"); replayed != "" {
+			t.Errorf("create as %s replayed another caller's response", caller.name)
+		}
+		id := decode[models.Content](t, resp).ID
+		if other, ok := ids[id]; ok {
+			t.Errorf("%s got the content created by %s", caller.name, other)
+		}
+		ids[id] = caller.name
+	}
+}
+
+// TestIdempotencyKeyExpiry checks that a key is free for a new request once
+// its TTL has passed
+func TestIdempotencyKeyExpiry(t *testing.T) {
+	api := newTestAPI(t, nil)
+	api.handlers.idempotencyTTL = 10 * time.Millisecond
+	token := testToken(t, "alice")
+	body := map[string]any{"title": "Title", "body": "Body", "author": "alice", "status": "draft"}
+
+	first := api.request(t, token, http.MethodPost, "/content", body, "Idempotency-Key", "order-42")
+	if first.Code != http.StatusOK {
+		t.Fatalf("first create = %d %s", first.Code, first.Body)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	retry := api.request(t, token, http.MethodPost, "/content", body, "Idempotency-Key", "order-42")
+	if retry.Code != http.StatusOK || retry.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("create after expiry = %d %s, replayed %q, want a new 200", retry.Code, retry.Body, retry.Header().Get("Idempotent-Replayed"))
+	}
+	if decode[models.Content](t, retry).ID == decode[models.Content](t, first).ID {
+		t.Errorf("create after expiry returned the expired response")
+	}
+}
@@ -0,0 +1,517 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"github.com/seenthis-ab/content-api/models"
+)
+
+const (
+	// MergePatchContentType selects JSON Merge Patch (RFC 7396) semantics
+	MergePatchContentType = "application/merge-patch+json"
+	// JSONPatchContentType selects JSON Patch (RFC 6902) semantics
+	JSONPatchContentType = "application/json-patch+json"
+)
+
+var (
+	// readOnlyContentFields may appear in a patched document but must not change
+	readOnlyContentFields = []string{"id", "created_at", "updated_at", "version", "published_at", "published_by"}
+
+	// requiredContentFields must be strings in a patched document
+	requiredContentFields = []string{"title", "body", "author", "status"}
+
+	// scheduleContentFields may be removed or set to a date-time in a patched document
+	scheduleContentFields = []string{"publish_at", "expire_at"}
+
+	// contentStatuses are the values the status field may take
+	contentStatuses = []string{statusDraft, statusPublished, statusArchived}
+
+	// errJSONPatchTestFailed is returned when a JSON Patch test operation fails
+	errJSONPatchTestFailed = errors.New("test failed, value differs")
+)
+
+// ContentMergePatch documents the shape of a merge patch for content. Every
+// member is optional and null removes data keys.
+type ContentMergePatch struct {
+	Title     string                 `json:"title,omitempty"`
+	Body      string                 `json:"body,omitempty"`
+	Author    string                 `json:"author,omitempty"`
+	Status    string                 `json:"status,omitempty" enum:"draft,published,archived"`
+	Data      map[string]interface{} `json:"data,omitempty" doc:"Merged recursively into the existing data, null removes a key"`
+	PublishAt *time.Time             `json:"publish_at,omitempty" doc:"When to publish the draft, null removes it"`
+	ExpireAt  *time.Time             `json:"expire_at,omitempty" doc:"When to archive the published content, null removes it"`
+}
+
+// RegisterPatchContent registers PATCH /content/{id}. The request body is read
+// raw since its meaning depends on the Content-Type, so the two accepted patch
+// formats are documented on the operation by hand. options modify the
+// operation like those of huma.Patch.
+func RegisterPatchContent(api huma.API, h *ContentHandlers, options ...func(o *huma.Operation)) {
+	registry := api.OpenAPI().Components.Schemas
+
+	op := huma.Operation{
+		OperationID: "patch-content",
+		Method:      http.MethodPatch,
+		Path:        "/content/{id}",
+		Summary:     "Patch content",
+		Description: "Partially updates content. Send a JSON Merge Patch (RFC 7396) as " +
+			MergePatchContentType + " to merge fields and keys inside data, or a JSON Patch " +
+			"(RFC 6902) as " + JSONPatchContentType + " to apply a list of operations such as " +
+			`{"op": "add", "path": "/data/tags/-", "value": "go"}. ` +
+			"id, version, created_at, updated_at, published_at and published_by are read-only. " +
+			"A status change must be allowed by the publishing workflow, otherwise 409 is returned, " +
+			"as it is for a failing JSON Patch test operation.",
+		RequestBody: &huma.RequestBody{
+			Required: true,
+			Content: map[string]*huma.MediaType{
+				MergePatchContentType: {Schema: registry.Schema(reflect.TypeOf(ContentMergePatch{}), true, "ContentMergePatch")},
+				JSONPatchContentType:  {Schema: registry.Schema(reflect.TypeOf([]JSONPatchOperation{}), true, "JSONPatch")},
+			},
+		},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict,
+			http.StatusPreconditionFailed, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity},
+	}
+	for _, option := range options {
+		option(&op)
+	}
+	huma.Register(api, op, h.PatchContent)
+
+	// The raw body adds a generic binary media type, which is not accepted
+	delete(api.OpenAPI().Paths[op.Path].Patch.RequestBody.Content, "application/octet-stream")
+}
+
+// patchContent applies a patch to the JSON representation of content and
+// copies the result back, rejecting changes to read-only fields, unknown
+// fields and invalid values with 422
+func patchContent(content *models.Content, apply func(doc interface{}) (interface{}, error)) error {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return fmt.Errorf("failed to marshal content: %w", err)
+	}
+	var original, doc map[string]interface{}
+	if err := json.Unmarshal(data, &original); err != nil {
+		return fmt.Errorf("failed to unmarshal content: %w", err)
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to unmarshal content: %w", err)
+	}
+
+	result, err := apply(doc)
+	if errors.Is(err, errJSONPatchTestFailed) {
+		return huma.Error409Conflict("Patch test operation failed", err)
+	}
+	if err != nil {
+		return huma.Error422UnprocessableEntity("Patch could not be applied", err)
+	}
+
+	patched, ok := result.(map[string]interface{})
+	if !ok {
+		return huma.Error422UnprocessableEntity("Patched content must be an object")
+	}
+
+	var details []error
+	invalid := func(field, message string) {
+		details = append(details, &huma.ErrorDetail{
+			Message:  message,
+			Location: "body." + field,
+			Value:    patched[field],
+		})
+	}
+
+	for _, field := range slices.Sorted(maps.Keys(patched)) {
+		known := slices.Contains(readOnlyContentFields, field) || slices.Contains(requiredContentFields, field) ||
+			slices.Contains(scheduleContentFields, field) || field == "data"
+		if !known {
+			invalid(field, "unknown field")
+		}
+	}
+	for _, field := range readOnlyContentFields {
+		if !reflect.DeepEqual(patched[field], original[field]) {
+			invalid(field, "field is read-only")
+		}
+	}
+	for _, field := range requiredContentFields {
+		if _, ok := patched[field].(string); !ok {
+			invalid(field, "expected a string")
+		}
+	}
+	if status, ok := patched["status"].(string); ok && !slices.Contains(contentStatuses, status) {
+		invalid("status", "expected one of "+strings.Join(contentStatuses, ", "))
+	}
+	patchedData, ok := patched["data"].(map[string]interface{})
+	if !ok && patched["data"] != nil {
+		invalid("data", "expected an object")
+	}
+	schedule := make(map[string]*time.Time, len(scheduleContentFields))
+	for _, field := range scheduleContentFields {
+		if patched[field] == nil {
+			continue
+		}
+		value, ok := patched[field].(string)
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if !ok || err != nil {
+			invalid(field, "expected an RFC 3339 date-time")
+			continue
+		}
+		schedule[field] = &t
+	}
+
+	if len(details) > 0 {
+		return huma.Error422UnprocessableEntity("validation failed", details...)
+	}
+
+	content.Title = patched["title"].(string)
+	content.Body = patched["body"].(string)
+	content.Author = patched["author"].(string)
+	content.Status = patched["status"].(string)
+	content.Data = patchedData
+	if content.Data == nil {
+		content.Data = map[string]interface{}{}
+	}
+	content.PublishAt = schedule["publish_at"]
+	content.ExpireAt = schedule["expire_at"]
+
+	return nil
+}
+
+// JSONPatchOperation is a single operation of a JSON Patch document. Value is
+// kept raw so that a missing value can be told apart from null.
+type JSONPatchOperation struct {
+	Op    string          `json:"op" enum:"add,remove,replace,move,copy,test" doc:"Operation name"`
+	Path  string          `json:"path" doc:"JSON Pointer to the target location, e.g. /data/tags/0"`
+	From  string          `json:"from,omitempty" doc:"JSON Pointer to the source location of move and copy"`
+	Value json.RawMessage `json:"value,omitempty" doc:"Value for add, replace and test, required by them"`
+}
+
+// value decodes the value of an add, replace or test operation, which RFC
+// 6902 requires to be present. Every call returns a fresh copy.
+func (op JSONPatchOperation) value() (interface{}, error) {
+	if op.Value == nil {
+		return nil, fmt.Errorf("missing value")
+	}
+	var value interface{}
+	if err := json.Unmarshal(op.Value, &value); err != nil {
+		return nil, fmt.Errorf("invalid value: %w", err)
+	}
+	return value, nil
+}
+
+// applyMergePatch applies a JSON Merge Patch (RFC 7396) to a decoded JSON
+// document and returns the result. Objects are merged recursively, null
+// removes a member and any other value replaces the target.
+func applyMergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = applyMergePatch(targetObject[key], value)
+		}
+	}
+
+	return targetObject
+}
+
+// applyJSONPatch applies a JSON Patch (RFC 6902) to a decoded JSON document
+// and returns the result. Operations are applied in order and the patch fails
+// as a whole if any operation fails.
+func applyJSONPatch(doc interface{}, ops []JSONPatchOperation) (interface{}, error) {
+	for i, op := range ops {
+		var err error
+		doc, err = applyJSONPatchOperation(doc, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+// applyJSONPatchOperation applies a single JSON Patch operation
+func applyJSONPatchOperation(doc interface{}, op JSONPatchOperation) (interface{}, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, path, value)
+	case "remove":
+		return jsonPointerRemove(doc, path)
+	case "replace":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := jsonPointerGet(doc, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		if doc, err = jsonPointerRemove(doc, path); err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, path, value)
+	case "move", "copy":
+		from, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := jsonPointerGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "copy" {
+			return jsonPointerAdd(doc, path, deepCopyJSON(value))
+		}
+		if isProperPrefix(from, path) {
+			return nil, fmt.Errorf("cannot move a value into one of its children")
+		}
+		if doc, err = jsonPointerRemove(doc, from); err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, path, value)
+	case "test":
+		expected, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		value, err := jsonPointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(value, expected) {
+			return nil, errJSONPatchTestFailed
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op.Op)
+	}
+}
+
+// parseJSONPointer splits a JSON Pointer (RFC 6901) into unescaped tokens
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// isProperPrefix reports whether prefix points to an ancestor of path
+func isProperPrefix(prefix, path []string) bool {
+	if len(prefix) >= len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// arrayIndex parses an array index token, allowing "-" (one past the end)
+// and len(array) only when adding
+func arrayIndex(token string, length int, adding bool) (int, error) {
+	if adding && token == "-" {
+		return length, nil
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	limit := length - 1
+	if adding {
+		limit = length
+	}
+	if index > limit {
+		return 0, fmt.Errorf("array index %d out of bounds", index)
+	}
+	return index, nil
+}
+
+// jsonPointerGet returns the value the path points to
+func jsonPointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			doc = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[index]
+		default:
+			return nil, fmt.Errorf("cannot traverse into a scalar at %q", token)
+		}
+	}
+	return doc, nil
+}
+
+// jsonPointerUpdate replaces the parent container of the path's last token
+// with the result of fn, returning the updated document. Arrays may be
+// reallocated by fn, which is why containers are rebuilt on the way up.
+func jsonPointerUpdate(doc interface{}, path []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	child, err := jsonPointerGet(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = jsonPointerUpdate(child, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		node[path[0]] = child
+	case []interface{}:
+		index, _ := arrayIndex(path[0], len(node), false)
+		node[index] = child
+	}
+	return doc, nil
+}
+
+// jsonPointerAdd adds value at the path, inserting into arrays
+func jsonPointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return jsonPointerUpdate(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			index, err := arrayIndex(token, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[index+1:], node[index:])
+			node[index] = value
+			return node, nil
+		default:
+			return nil, fmt.Errorf("cannot add a member to a scalar")
+		}
+	})
+}
+
+// jsonPointerRemove removes the value at the path, which must exist
+func jsonPointerRemove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("cannot remove the whole document")
+	}
+
+	return jsonPointerUpdate(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := node[token]; !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			delete(node, token)
+			return node, nil
+		case []interface{}:
+			index, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(node[:index], node[index+1:]...), nil
+		default:
+			return nil, fmt.Errorf("cannot remove a member from a scalar")
+		}
+	})
+}
+
+// deepCopyJSON copies a decoded JSON value so that it can be placed in a
+// second location without aliasing
+func deepCopyJSON(value interface{}) interface{} {
+	data, _ := json.Marshal(value)
+	var copied interface{}
+	_ = json.Unmarshal(data, &copied)
+	return copied
+}
+
+// rawJSON encodes a decoded JSON value, which cannot fail
+func rawJSON(value interface{}) json.RawMessage {
+	data, _ := json.Marshal(value)
+	return data
+}
+
+// diffJSON returns the JSON Patch operations that turn the decoded JSON
+// document from into to. Objects are compared member by member; arrays and
+// scalars that differ are replaced as a whole.
+func diffJSON(path string, from, to interface{}) []JSONPatchOperation {
+	if reflect.DeepEqual(from, to) {
+		return nil
+	}
+
+	fromObject, fromOK := from.(map[string]interface{})
+	toObject, toOK := to.(map[string]interface{})
+	if !fromOK || !toOK {
+		return []JSONPatchOperation{{Op: "replace", Path: path, Value: rawJSON(to)}}
+	}
+
+	var ops []JSONPatchOperation
+	for _, key := range slices.Sorted(maps.Keys(fromObject)) {
+		if _, ok := toObject[key]; !ok {
+			ops = append(ops, JSONPatchOperation{Op: "remove", Path: path + "/" + escapeJSONPointer(key)})
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(toObject)) {
+		child := path + "/" + escapeJSONPointer(key)
+		if value, ok := fromObject[key]; ok {
+			ops = append(ops, diffJSON(child, value, toObject[key])...)
+		} else {
+			ops = append(ops, JSONPatchOperation{Op: "add", Path: child, Value: rawJSON(toObject[key])})
+		}
+	}
+	return ops
+}
+
+// escapeJSONPointer escapes a member name for use as a JSON Pointer token
+func escapeJSONPointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"github.com/seenthis-ab/content-api/models"
+)
+
+// decodeJSON decodes a JSON literal of a test case
+func decodeJSON(t *testing.T, data string) interface{} {
+	t.Helper()
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		t.Fatalf("invalid JSON %s: %v", data, err)
+	}
+	return value
+}
+
+// errorStatus returns the HTTP status of a huma error, or 0 for other errors
+func errorStatus(err error) int {
+	var statusErr huma.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.GetStatus()
+	}
+	return 0
+}
+
+// TestApplyJSONPatch runs the examples of RFC 6902 Appendix A, followed by
+// operations on the whole document
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		doc        string
+		patch      string
+		want       string // empty if the patch fails
+		testFailed bool   // whether it fails with errJSONPatchTestFailed
+	}{
+		{"A.1 adding an object member", `{"foo": "bar"}`,
+			`[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			`{"baz": "qux", "foo": "bar"}`, false},
+		{"A.2 adding an array element", `{"foo": ["bar", "baz"]}`,
+			`[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			`{"foo": ["bar", "qux", "baz"]}`, false},
+		{"A.3 removing an object member", `{"baz": "qux", "foo": "bar"}`,
+			`[{"op": "remove", "path": "/baz"}]`,
+			`{"foo": "bar"}`, false},
+		{"A.4 removing an array element", `{"foo": ["bar", "qux", "baz"]}`,
+			`[{"op": "remove", "path": "/foo/1"}]`,
+			`{"foo": ["bar", "baz"]}`, false},
+		{"A.5 replacing a value", `{"baz": "qux", "foo": "bar"}`,
+			`[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+			`{"baz": "boo", "foo": "bar"}`, false},
+		{"A.6 moving a value", `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+			`[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+			`{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`, false},
+		{"A.7 moving an array element", `{"foo": ["all", "grass", "cows", "eat"]}`,
+			`[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+			`{"foo": ["all", "cows", "eat", "grass"]}`, false},
+		{"A.8 testing a value: success", `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+			`[{"op": "test", "path": "/baz", "value": "qux"}, {"op": "test", "path": "/foo/1", "value": 2}]`,
+			`{"baz": "qux", "foo": ["a", 2, "c"]}`, false},
+		{"A.9 testing a value: error", `{"baz": "qux"}`,
+			`[{"op": "test", "path": "/baz", "value": "bar"}]`,
+			``, true},
+		{"A.10 adding a nested member object", `{"foo": "bar"}`,
+			`[{"op": "add", "path": "/child", "value": {"grandchild": {}}}]`,
+			`{"foo": "bar", "child": {"grandchild": {}}}`, false},
+		{"A.11 ignoring unrecognized elements", `{"foo": "bar"}`,
+			`[{"op": "add", "path": "/baz", "value": "qux", "xyz": 123}]`,
+			`{"foo": "bar", "baz": "qux"}`, false},
+		{"A.12 adding to a nonexistent target", `{"foo": "bar"}`,
+			`[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+			``, false},
+		{"A.13 invalid JSON Patch document", `{"foo": "bar"}`,
+			`[{"op": "add", "path": "/baz", "value": "qux", "op": "remove"}]`,
+			``, false},
+		{"A.14 ~ escape ordering", `{"/": 9, "~1": 10}`,
+			`[{"op": "test", "path": "/~01", "value": 10}]`,
+			`{"/": 9, "~1": 10}`, false},
+		{"A.15 comparing strings and numbers", `{"/": 9, "~1": 10}`,
+			`[{"op": "test", "path": "/~01", "value": "10"}]`,
+			``, true},
+		{"A.16 adding an array value", `{"foo": ["bar"]}`,
+			`[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+			`{"foo": ["bar", ["abc", "def"]]}`, false},
+		{"replacing the whole document", `{"foo": "bar"}`,
+			`[{"op": "replace", "path": "", "value": {"baz": "qux"}}]`,
+			`{"baz": "qux"}`, false},
+		{"adding the whole document", `{"foo": "bar"}`,
+			`[{"op": "add", "path": "", "value": [1]}]`,
+			`[1]`, false},
+		{"testing the whole document", `{"foo": "bar"}`,
+			`[{"op": "test", "path": "", "value": {"foo": "bar"}}]`,
+			`{"foo": "bar"}`, false},
+		{"removing the whole document", `{"foo": "bar"}`,
+			`[{"op": "remove", "path": ""}]`,
+			``, false},
+		{"moving a value into its child", `{"foo": {"bar": 1}}`,
+			`[{"op": "move", "from": "/foo", "path": "/foo/bar/baz"}]`,
+			``, false},
+		{"replacing without a value", `{"foo": "bar"}`,
+			`[{"op": "replace", "path": "/foo"}]`,
+			``, false},
+		{"failing as a whole", `{"foo": "bar"}`,
+			`[{"op": "add", "path": "/baz", "value": 1}, {"op": "remove", "path": "/missing"}]`,
+			``, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []JSONPatchOperation
+			if err := json.Unmarshal([]byte(tt.patch), &ops); err != nil {
+				t.Fatalf("invalid patch %s: %v", tt.patch, err)
+			}
+
+			got, err := applyJSONPatch(decodeJSON(t, tt.doc), ops)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+				if errors.Is(err, errJSONPatchTestFailed) != tt.testFailed {
+					t.Errorf("got error %v, test failed = %v", err, tt.testFailed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyJSONPatch: %v", err)
+			}
+			if want := decodeJSON(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// TestApplyMergePatch runs the examples of RFC 7396 Appendix A
+func TestApplyMergePatch(t *testing.T) {
+	tests := []struct {
+		target string
+		patch  string
+		want   string
+	}{
+		{`{"a": "b"}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "b"}`, `{"b": "c"}`, `{"a": "b", "b": "c"}`},
+		{`{"a": "b"}`, `{"a": null}`, `{}`},
+		{`{"a": "b", "b": "c"}`, `{"a": null}`, `{"b": "c"}`},
+		{`{"a": ["b"]}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "c"}`, `{"a": ["b"]}`, `{"a": ["b"]}`},
+		{`{"a": {"b": "c"}}`, `{"a": {"b": "d", "c": null}}`, `{"a": {"b": "d"}}`},
+		{`{"a": [{"b": "c"}]}`, `{"a": [1]}`, `{"a": [1]}`},
+		{`["a", "b"]`, `["c", "d"]`, `["c", "d"]`},
+		{`{"a": "b"}`, `["c"]`, `["c"]`},
+		{`{"a": "foo"}`, `null`, `null`},
+		{`{"a": "foo"}`, `"bar"`, `"bar"`},
+		{`{"e": null}`, `{"a": 1}`, `{"e": null, "a": 1}`},
+		{`[1, 2]`, `{"a": "b", "c": null}`, `{"a": "b"}`},
+		{`{}`, `{"a": {"bb": {"ccc": null}}}`, `{"a": {"bb": {}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target+" "+tt.patch, func(t *testing.T) {
+			got := applyMergePatch(decodeJSON(t, tt.target), decodeJSON(t, tt.patch))
+			if want := decodeJSON(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// TestPatchContent checks that patches are copied back onto the content,
+// null removing data keys and schedules, and that patches changing
+// read-only or unknown fields are rejected with 422 and failing tests with
+// 409, leaving the content alone
+func TestPatchContent(t *testing.T) {
+	publishAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	newContent := func() *models.Content {
+		return &models.Content{
+			ID:        "01HZZZZZZZZZZZZZZZZZZZZZZZ",
+			Title:     "Title",
+			Body:      "Body",
+			Author:    "alice",
+			Status:    statusDraft,
+			Data:      map[string]interface{}{"tags": []interface{}{"go"}, "views": 1.0},
+			PublishAt: &publishAt,
+			CreatedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			UpdatedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			Version:   3,
+		}
+	}
+	mergePatch := func(patch string) func(doc interface{}) (interface{}, error) {
+		return func(doc interface{}) (interface{}, error) {
+			return applyMergePatch(doc, decodeJSON(t, patch)), nil
+		}
+	}
+	jsonPatch := func(patch string) func(doc interface{}) (interface{}, error) {
+		return func(doc interface{}) (interface{}, error) {
+			var ops []JSONPatchOperation
+			if err := json.Unmarshal([]byte(patch), &ops); err != nil {
+				t.Fatalf("invalid patch %s: %v", patch, err)
+			}
+			return applyJSONPatch(doc, ops)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		apply  func(doc interface{}) (interface{}, error)
+		status int // 0 if the patch applies
+		check  func(t *testing.T, content *models.Content)
+	}{
+		{"merge fields", mergePatch(`{"title": "New", "data": {"lang": "en"}}`), 0, func(t *testing.T, c *models.Content) {
+			if c.Title != "New" || c.Data["lang"] != "en" || c.Data["views"] != 1.0 {
+				t.Errorf("got title %q data %v", c.Title, c.Data)
+			}
+		}},
+		{"null removes a data key", mergePatch(`{"data": {"views": null}}`), 0, func(t *testing.T, c *models.Content) {
+			if _, ok := c.Data["views"]; ok || c.Data["tags"] == nil {
+				t.Errorf("got data %v, want views removed", c.Data)
+			}
+		}},
+		{"null removes the data", mergePatch(`{"data": null}`), 0, func(t *testing.T, c *models.Content) {
+			if c.Data == nil || len(c.Data) != 0 {
+				t.Errorf("got data %v, want empty", c.Data)
+			}
+		}},
+		{"null removes the schedule", mergePatch(`{"publish_at": null}`), 0, func(t *testing.T, c *models.Content) {
+			if c.PublishAt != nil {
+				t.Errorf("got publish_at %v, want none", c.PublishAt)
+			}
+		}},
+		{"set the schedule", mergePatch(`{"expire_at": "2031-01-01T00:00:00Z"}`), 0, func(t *testing.T, c *models.Content) {
+			if c.ExpireAt == nil || !c.ExpireAt.Equal(time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("got expire_at %v", c.ExpireAt)
+			}
+		}},
+		{"JSON Patch", jsonPatch(`[{"op": "add", "path": "/data/tags/-", "value": "api"}]`), 0, func(t *testing.T, c *models.Content) {
+			if !reflect.DeepEqual(c.Data["tags"], []interface{}{"go", "api"}) {
+				t.Errorf("got tags %v", c.Data["tags"])
+			}
+		}},
+		{"read-only version", mergePatch(`{"version": 1}`), http.StatusUnprocessableEntity, nil},
+		{"read-only id", jsonPatch(`[{"op": "replace", "path": "/id", "value": "other"}]`), http.StatusUnprocessableEntity, nil},
+		{"unchanged read-only fields", mergePatch(`{"id": "01HZZZZZZZZZZZZZZZZZZZZZZZ", "version": 3}`), 0, nil},
+		{"unknown field", mergePatch(`{"summary": "New"}`), http.StatusUnprocessableEntity, nil},
+		{"removed required field", mergePatch(`{"title": null}`), http.StatusUnprocessableEntity, nil},
+		{"invalid status", mergePatch(`{"status": "deleted"}`), http.StatusUnprocessableEntity, nil},
+		{"invalid data", mergePatch(`{"data": [1]}`), http.StatusUnprocessableEntity, nil},
+		{"invalid schedule", mergePatch(`{"publish_at": "tomorrow"}`), http.StatusUnprocessableEntity, nil},
+		{"replaced by a non-object", jsonPatch(`[{"op": "replace", "path": "", "value": [1]}]`), http.StatusUnprocessableEntity, nil},
+		{"failing operation", jsonPatch(`[{"op": "remove", "path": "/data/missing"}]`), http.StatusUnprocessableEntity, nil},
+		{"failing test", jsonPatch(`[{"op": "test", "path": "/title", "value": "Other"}, {"op": "replace", "path": "/title", "value": "New"}]`), http.StatusConflict, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := newContent()
+			err := patchContent(content, tt.apply)
+			if tt.status != 0 {
+				if status := errorStatus(err); status != tt.status {
+					t.Fatalf("got error %v, want status %d", err, tt.status)
+				}
+				if !reflect.DeepEqual(content, newContent()) {
+					t.Errorf("rejected patch changed the content to %+v", content)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("patchContent: %v", err)
+			}
+			if tt.check != nil {
+				tt.check(t, content)
+			}
+		})
+	}
+}
+
+// TestPatchContentHandler checks the status codes of PATCH by content type
+func TestPatchContentHandler(t *testing.T) {
+	api := newTestAPI(t, nil)
+	token := testToken(t, "alice")
+	content := api.create(t, token, map[string]any{"data": map[string]any{"views": 1}})
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"merge patch", MergePatchContentType, `{"title": "Merged", "data": {"views": null}}`, http.StatusOK},
+		{"JSON Patch", JSONPatchContentType, `[{"op": "replace", "path": "/title", "value": "Patched"}]`, http.StatusOK},
+		{"failing test", JSONPatchContentType, `[{"op": "test", "path": "/title", "value": "Merged"}]`, http.StatusConflict},
+		{"read-only field", MergePatchContentType, `{"created_at": "2020-01-01T00:00:00Z"}`, http.StatusUnprocessableEntity},
+		{"unknown field", JSONPatchContentType, `[{"op": "add", "path": "/summary", "value": "New"}]`, http.StatusUnprocessableEntity},
+		{"invalid JSON", MergePatchContentType, `{"title":`, http.StatusBadRequest},
+		{"other content type", "text/plain", `title=New`, http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := api.request(t, token, http.MethodPatch, "/content/"+content.ID, tt.body, "Content-Type", tt.contentType)
+			if resp.Code != tt.status {
+				t.Fatalf("got %d %s, want %d", resp.Code, resp.Body, tt.status)
+			}
+		})
+	}
+
+	resp := api.request(t, token, http.MethodGet, "/content/"+content.ID, nil)
+	patched := decode[models.Content](t, resp)
+	if patched.Title != "Patched" || len(patched.Data) != 0 || patched.Version != 3 {
+		t.Errorf("got title %q data %v version %d, want Patched, no data, version 3", patched.Title, patched.Data, patched.Version)
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"go.uber.org/zap"
+
+	"github.com/seenthis-ab/content-api/config"
+	"github.com/seenthis-ab/content-api/models"
+	"github.com/seenthis-ab/content-api/policy"
+)
+
+// authorize answers 403 unless the policy allows the action on the content
+func (h *ContentHandlers) authorize(ctx context.Context, action policy.Action, content *models.Content) error {
+	if err := h.policy.Authorize(ctx, action, content); err != nil {
+		return forbidden(ctx, err, zap.String("content_id", content.ID))
+	}
+	return nil
+}
+
+// authorizeCreate answers 403 unless the caller may create the content, and
+// publish it if it is created published or with a publishing schedule
+func (h *ContentHandlers) authorizeCreate(ctx context.Context, content *models.Content) error {
+	if err := h.authorize(ctx, policy.ActionCreate, content); err != nil {
+		return err
+	}
+	if content.Status != statusDraft || content.PublishAt != nil || content.ExpireAt != nil {
+		return h.authorize(ctx, policy.ActionPublish, content)
+	}
+	return nil
+}
+
+// accessFilter returns the filter selecting the content the caller may
+// perform the action on, nil for all content, answering 403 if there is none
+func (h *ContentHandlers) accessFilter(ctx context.Context, action policy.Action) (*models.AccessFilter, error) {
+	filter, err := h.policy.Filter(ctx, action)
+	if err != nil {
+		return nil, forbidden(ctx, err)
+	}
+	return filter, nil
+}
+
+// authorizeEdit wraps an edit so that it is only applied if the caller may
+// make it: update for changes to title, body, author or data, on the content
+// both before and after the edit so that authors cannot give their content
+// away, and publish for changes to the status or publishing schedule
+func (h *ContentHandlers) authorizeEdit(ctx context.Context, edit func(*models.Content) error) func(*models.Content) error {
+	return func(content *models.Content) error {
+		before := *content
+		before.PublishAt = copyTime(content.PublishAt)
+		before.ExpireAt = copyTime(content.ExpireAt)
+		beforeData := dataJSON(content.Data)
+
+		if err := edit(content); err != nil {
+			return err
+		}
+
+		edited := before.Title != content.Title || before.Body != content.Body ||
+			before.Author != content.Author || !bytes.Equal(beforeData, dataJSON(content.Data))
+		if edited {
+			if err := h.authorize(ctx, policy.ActionUpdate, &before); err != nil {
+				return err
+			}
+			if err := h.authorize(ctx, policy.ActionUpdate, content); err != nil {
+				return err
+			}
+		}
+
+		published := before.Status != content.Status ||
+			!sameTime(before.PublishAt, content.PublishAt) || !sameTime(before.ExpireAt, content.ExpireAt)
+		if published {
+			return h.authorize(ctx, policy.ActionPublish, &before)
+		}
+		return nil
+	}
+}
+
+// revisionContent returns the content as captured by a revision, for
+// authorizing access to the revision
+func revisionContent(revision *models.Revision) *models.Content {
+	return &models.Content{
+		ID:     revision.ContentID,
+		Title:  revision.Title,
+		Body:   revision.Body,
+		Author: revision.Author,
+		Status: revision.Status,
+		Data:   revision.Data,
+	}
+}
+
+// forbidden logs a policy denial and converts it to a 403 problem details
+// response
+func forbidden(ctx context.Context, err error, fields ...zap.Field) error {
+	config.GetLoggerWithRequestID(ctx).Info("Access denied", append(fields, zap.Error(err))...)
+	return huma.Error403Forbidden("Access denied", &huma.ErrorDetail{Message: err.Error()})
+}
+
+// dataJSON encodes content data for comparison, with nil and empty alike
+func dataJSON(data map[string]interface{}) []byte {
+	if len(data) == 0 {
+		return []byte("{}")
+	}
+	encoded, _ := json.Marshal(data)
+	return encoded
+}
+
+// copyTime returns a copy of an optional time
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	copied := *t
+	return &copied
+}
+
+// sameTime reports whether two optional times are both unset or equal
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/seenthis-ab/content-api/models"
+)
+
+// TestPolicyEdits checks that the policy is enforced on every kind of write:
+// authors may only update their own content and not give it away, and
+// publishing and deleting need the editor and admin roles
+func TestPolicyEdits(t *testing.T) {
+	api := newTestAPI(t, testPolicy(t))
+	alice := testToken(t, "alice")
+	bob := testToken(t, "bob")
+	editor := testToken(t, "editor", "editor")
+	admin := testToken(t, "admin", "admin")
+
+	content := api.create(t, alice, nil)
+	path := "/content/" + content.ID
+	put := func(author, status string) map[string]any {
+		return map[string]any{"title": "Changed", "body": "Body", "author": author, "status": status}
+	}
+	mergePatch := []string{"Content-Type", MergePatchContentType}
+
+	tests := []struct {
+		name    string
+		token   string
+		method  string
+		path    string
+		body    any
+		headers []string
+		status  int
+	}{
+		{"anonymous update", "", http.MethodPut, path, put("alice", statusDraft), nil, http.StatusUnauthorized},
+		{"update other's", bob, http.MethodPut, path, put("alice", statusDraft), nil, http.StatusForbidden},
+		{"patch other's", bob, http.MethodPatch, path, `{"title": "Changed"}`, mergePatch, http.StatusForbidden},
+		{"take over other's", bob, http.MethodPut, path, put("bob", statusDraft), nil, http.StatusForbidden},
+		{"give away own", alice, http.MethodPut, path, put("bob", statusDraft), nil, http.StatusForbidden},
+		{"publish own by edit", alice, http.MethodPut, path, put("alice", statusPublished), nil, http.StatusForbidden},
+		{"publish own", alice, http.MethodPost, path + "/publish", nil, nil, http.StatusForbidden},
+		{"schedule own", alice, http.MethodPatch, path, `{"publish_at": "2099-01-01T00:00:00Z"}`, mergePatch, http.StatusForbidden},
+		{"delete own", alice, http.MethodDelete, path, nil, nil, http.StatusForbidden},
+		{"delete as editor", editor, http.MethodDelete, path, nil, nil, http.StatusForbidden},
+		{"create for other", alice, http.MethodPost, "/content", put("bob", statusDraft), nil, http.StatusForbidden},
+		{"update own", alice, http.MethodPut, path, put("alice", statusDraft), nil, http.StatusOK},
+		{"patch own", alice, http.MethodPatch, path, `{"title": "Patched"}`, mergePatch, http.StatusOK},
+		{"update as editor", editor, http.MethodPut, path, put("alice", statusDraft), nil, http.StatusOK},
+		{"publish as editor", editor, http.MethodPost, path + "/publish", nil, nil, http.StatusOK},
+		{"delete as admin", admin, http.MethodDelete, path, nil, nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := api.request(t, tt.token, tt.method, tt.path, tt.body, tt.headers...)
+			if resp.Code != tt.status {
+				t.Errorf("got %d %s, want %d", resp.Code, resp.Body, tt.status)
+			}
+		})
+	}
+}
+
+// TestPolicyReads checks that lists and searches only include the content
+// the caller may read: published content for everyone, plus their own
+// drafts for authors and everything for editors
+func TestPolicyReads(t *testing.T) {
+	api := newTestAPI(t, testPolicy(t))
+	alice := testToken(t, "alice")
+	bob := testToken(t, "bob")
+	editor := testToken(t, "editor", "editor")
+
+	titles := map[string]string{} // content ID -> title
+	for _, item := range []struct {
+		token, author, title string
+		publish              bool
+	}{
+		{alice, "alice", "alice draft", false},
+		{alice, "alice", "alice published", true},
+		{bob, "bob", "bob draft", false},
+	} {
+		content := api.create(t, item.token, map[string]any{"title": item.title + " searchable", "author": item.author})
+		titles[content.ID] = item.title
+		if item.publish {
+			if resp := api.request(t, editor, http.MethodPost, "/content/"+content.ID+"/publish", nil); resp.Code != http.StatusOK {
+				t.Fatalf("publish = %d %s", resp.Code, resp.Body)
+			}
+		}
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  []string
+	}{
+		{"anonymous", "", []string{"alice published"}},
+		{"author", bob, []string{"alice published", "bob draft"}},
+		{"other author", alice, []string{"alice draft", "alice published"}},
+		{"editor", editor, []string{"alice draft", "alice published", "bob draft"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := api.request(t, tt.token, http.MethodGet, "/content", nil)
+			if resp.Code != http.StatusOK {
+				t.Fatalf("list = %d %s", resp.Code, resp.Body)
+			}
+			var got []string
+			for _, content := range decode[struct{ Items []models.Content }](t, resp).Items {
+				got = append(got, titles[content.ID])
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("list got %v, want %v", got, tt.want)
+			}
+
+			resp = api.request(t, tt.token, http.MethodGet, "/content/search?q=searchable", nil)
+			if resp.Code != http.StatusOK {
+				t.Fatalf("search = %d %s", resp.Code, resp.Body)
+			}
+			got = nil
+			for _, hit := range decode[struct{ Items []SearchHit }](t, resp).Items {
+				got = append(got, titles[hit.Content.ID])
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("search got %v, want %v", got, tt.want)
+			}
+
+			for id, title := range titles {
+				allowed := slices.Contains(tt.want, title)
+				resp := api.request(t, tt.token, http.MethodGet, "/content/"+id, nil)
+				if allowed && resp.Code != http.StatusOK || !allowed && resp.Code != http.StatusForbidden {
+					t.Errorf("GET %s = %d, want it readable: %v", title, resp.Code, allowed)
+				}
+			}
+		})
+	}
+}
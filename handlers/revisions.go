@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/conditional"
+	"go.uber.org/zap"
+
+	"github.com/seenthis-ab/content-api/config"
+	"github.com/seenthis-ab/content-api/models"
+	"github.com/seenthis-ab/content-api/policy"
+)
+
+// ListRevisionsInput represents the request parameters for listing revisions
+type ListRevisionsInput struct {
+	ID string `path:"id"`
+}
+
+// ListRevisionsOutput represents the response for listing revisions
+type ListRevisionsOutput struct {
+	Body struct {
+		Items []models.Revision `json:"items" doc:"Revisions, oldest first"`
+	}
+}
+
+// ListRevisions handles GET /content/{id}/revisions requests. The history of
+// content in the trash remains available. Callers need the policy's
+// permission to read the content, checked against its last revision while it
+// is in the trash, and are then shown every revision.
+func (h *ContentHandlers) ListRevisions(ctx context.Context, input *ListRevisionsInput) (*ListRevisionsOutput, error) {
+	logger := config.GetLoggerWithRequestID(ctx)
+
+	revisions, err := h.store.ListRevisions(ctx, input.ID)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		return nil, storeError(logger, err, zap.String("content_id", input.ID))
+	}
+	if len(revisions) == 0 {
+		return nil, huma.Error404NotFound("Content not found")
+	}
+	if err := h.authorizeHistory(ctx, input.ID, revisions); err != nil {
+		return nil, err
+	}
+
+	output := &ListRevisionsOutput{}
+	output.Body.Items = make([]models.Revision, len(revisions))
+	for i, revision := range revisions {
+		output.Body.Items[i] = *revision
+	}
+	return output, nil
+}
+
+// RevisionInput represents the request parameters selecting one revision
+type RevisionInput struct {
+	ID       string `path:"id"`
+	Revision int    `path:"rev" minimum:"1" doc:"Revision number"`
+}
+
+// GetRevisionOutput represents the response for getting a revision
+type GetRevisionOutput struct {
+	Body models.Revision
+}
+
+// GetRevision handles GET /content/{id}/revisions/{rev} requests
+func (h *ContentHandlers) GetRevision(ctx context.Context, input *RevisionInput) (*GetRevisionOutput, error) {
+	revision, err := h.getRevision(ctx, input.ID, input.Revision)
+	if err != nil {
+		return nil, err
+	}
+	return &GetRevisionOutput{Body: *revision}, nil
+}
+
+// getRevision reads a revision, reporting a missing one as 404 and 403 if the
+// caller may not read the history of the content, as for ListRevisions
+func (h *ContentHandlers) getRevision(ctx context.Context, id string, rev int) (*models.Revision, error) {
+	logger := config.GetLoggerWithRequestID(ctx)
+
+	revision, err := h.store.GetRevision(ctx, id, rev)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, huma.Error404NotFound("Revision not found")
+	}
+	if err != nil {
+		return nil, storeError(logger, err, zap.String("content_id", id), zap.Int("revision", rev))
+	}
+	if err := h.authorizeHistory(ctx, id, nil); err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
+
+// authorizeHistory answers 403 unless the caller may read the content as it
+// is now, or as its last revision left it while it is in the trash, so that
+// every revision is as readable as the content it belongs to. revisions are
+// those of the content if already listed, otherwise they are listed when the
+// content is in the trash.
+func (h *ContentHandlers) authorizeHistory(ctx context.Context, id string, revisions []*models.Revision) error {
+	if h.policy == nil {
+		return nil
+	}
+	logger := config.GetLoggerWithRequestID(ctx)
+
+	content, err := h.store.GetByID(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
+		if revisions == nil {
+			revisions, err = h.store.ListRevisions(ctx, id)
+			if err != nil && !errors.Is(err, models.ErrNotFound) {
+				return storeError(logger, err, zap.String("content_id", id))
+			}
+		}
+		if len(revisions) == 0 {
+			return huma.Error404NotFound("Content not found")
+		}
+		content, err = revisionContent(revisions[len(revisions)-1]), nil
+	}
+	if err != nil {
+		return storeError(logger, err, zap.String("content_id", id))
+	}
+	return h.authorize(ctx, policy.ActionRead, content)
+}
+
+// DiffRevisionsInput represents the request parameters for diffing revisions
+type DiffRevisionsInput struct {
+	RevisionInput
+	From int `query:"from" minimum:"0" doc:"Revision to compare against, the previous revision by default; 0 compares against an empty document"`
+
+	fromSet bool
+}
+
+// DiffRevisionsOutput represents the difference between two revisions
+type DiffRevisionsOutput struct {
+	Body struct {
+		From       int                  `json:"from"`
+		To         int                  `json:"to"`
+		Operations []JSONPatchOperation `json:"operations" doc:"JSON Patch (RFC 6902) turning revision from into revision to"`
+	}
+}
+
+// DiffRevisions handles GET /content/{id}/revisions/{rev}/diff requests
+func (h *ContentHandlers) DiffRevisions(ctx context.Context, input *DiffRevisionsInput) (*DiffRevisionsOutput, error) {
+	to, err := h.getRevision(ctx, input.ID, input.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	from := input.From
+	if from == 0 && !input.fromSet {
+		from = input.Revision - 1
+	}
+
+	fromDoc := map[string]interface{}{}
+	if from > 0 {
+		revision, err := h.getRevision(ctx, input.ID, from)
+		if err != nil {
+			return nil, err
+		}
+		fromDoc = revisionDocument(revision)
+	}
+
+	output := &DiffRevisionsOutput{}
+	output.Body.From = from
+	output.Body.To = to.Revision
+	output.Body.Operations = diffJSON("", fromDoc, revisionDocument(to))
+	if output.Body.Operations == nil {
+		output.Body.Operations = []JSONPatchOperation{}
+	}
+	return output, nil
+}
+
+// Resolve records whether the from parameter was given, since 0 is a valid value
+func (i *DiffRevisionsInput) Resolve(ctx huma.Context) []error {
+	u := ctx.URL()
+	i.fromSet = u.Query().Has("from")
+	return nil
+}
+
+// revisionDocument returns the editable fields of a revision as a JSON document
+func revisionDocument(revision *models.Revision) map[string]interface{} {
+	return map[string]interface{}{
+		"title":  revision.Title,
+		"body":   revision.Body,
+		"author": revision.Author,
+		"status": revision.Status,
+		"data":   revision.Data,
+	}
+}
+
+// RestoreRevisionInput represents the request parameters for restoring a revision
+type RestoreRevisionInput struct {
+	conditional.Params
+	RevisionInput
+}
+
+// RestoreRevisionOutput represents the response for restoring a revision
+type RestoreRevisionOutput struct {
+	ETag string         `header:"ETag"`
+	Body models.Content `json:"body"`
+}
+
+// RestoreRevision handles POST /content/{id}/revisions/{rev}/restore requests.
+// The content is updated to the fields of the revision, which itself adds a
+// new revision; the history is never rewritten. The status is left to the
+// publishing workflow and not restored, nor is the author, so that restoring
+// a revision never hands the content back to a previous author.
+func (h *ContentHandlers) RestoreRevision(ctx context.Context, input *RestoreRevisionInput) (*RestoreRevisionOutput, error) {
+	revision, err := h.getRevision(ctx, input.ID, input.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := h.updateContent(ctx, input.ID, &input.Params, func(content *models.Content) error {
+		content.Title = revision.Title
+		content.Body = revision.Body
+		content.Data = revision.Data
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	config.GetLoggerWithRequestID(ctx).Info("Restored content revision",
+		zap.String("content_id", input.ID),
+		zap.Int("revision", input.Revision),
+	)
+
+	return &RestoreRevisionOutput{ETag: quoteETag(contentETag(content)), Body: *content}, nil
+}
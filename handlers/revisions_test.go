@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/seenthis-ab/content-api/models"
+)
+
+// TestRevisionAccess checks that single revisions are as readable as the
+// content they belong to, as the revision list is: after an editor hands
+// content over to another author, the new author may read, diff and restore
+// its old revisions and the previous author may not, both while the content
+// is live and once it is in the trash
+func TestRevisionAccess(t *testing.T) {
+	api := newTestAPI(t, testPolicy(t))
+	alice := testToken(t, "alice")
+	bob := testToken(t, "bob")
+	editor := testToken(t, "editor", "editor")
+	admin := testToken(t, "admin", "admin")
+
+	content := api.create(t, alice, nil)
+	path := "/content/" + content.ID
+	resp := api.request(t, editor, http.MethodPut, path,
+		map[string]any{"title": "Handed over", "body": "Body", "author": "bob", "status": "draft"})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s", resp.Code, resp.Body)
+	}
+
+	reads := []string{"/revisions", "/revisions/1", "/revisions/2/diff", "/revisions/2/diff?from=0"}
+	for _, read := range reads {
+		if resp := api.request(t, bob, http.MethodGet, path+read, nil); resp.Code != http.StatusOK {
+			t.Errorf("GET %s as the current author = %d %s, want 200", read, resp.Code, resp.Body)
+		}
+		if resp := api.request(t, alice, http.MethodGet, path+read, nil); resp.Code != http.StatusForbidden {
+			t.Errorf("GET %s as the previous author = %d %s, want 403", read, resp.Code, resp.Body)
+		}
+	}
+
+	if resp := api.request(t, alice, http.MethodPost, path+"/revisions/1/restore", nil); resp.Code != http.StatusForbidden {
+		t.Errorf("restore as the previous author = %d %s, want 403", resp.Code, resp.Body)
+	}
+	resp = api.request(t, bob, http.MethodPost, path+"/revisions/1/restore", nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("restore as the current author = %d %s, want 200", resp.Code, resp.Body)
+	}
+	if restored := decode[models.Content](t, resp); restored.Title != content.Title || restored.Author != "bob" {
+		t.Errorf("restored %q by %q, want %q still by bob", restored.Title, restored.Author, content.Title)
+	}
+
+	// In the trash, access follows the last revision
+	if resp := api.request(t, admin, http.MethodDelete, path, nil); resp.Code != http.StatusOK {
+		t.Fatalf("DELETE = %d %s", resp.Code, resp.Body)
+	}
+	for _, read := range reads {
+		if resp := api.request(t, bob, http.MethodGet, path+read, nil); resp.Code != http.StatusOK {
+			t.Errorf("GET %s in the trash as the current author = %d %s, want 200", read, resp.Code, resp.Body)
+		}
+		if resp := api.request(t, alice, http.MethodGet, path+read, nil); resp.Code != http.StatusForbidden {
+			t.Errorf("GET %s in the trash as the previous author = %d %s, want 403", read, resp.Code, resp.Body)
+		}
+	}
+
+	if resp := api.request(t, bob, http.MethodGet, path+"/revisions/9", nil); resp.Code != http.StatusNotFound {
+		t.Errorf("GET a missing revision = %d %s, want 404", resp.Code, resp.Body)
+	}
+}
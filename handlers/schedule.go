@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/seenthis-ab/content-api/config"
+	"github.com/seenthis-ab/content-api/models"
+)
+
+// scheduleActor is recorded as the publisher of content published on schedule
+const scheduleActor = "scheduler"
+
+// scheduleBatchSize bounds the content changed by one run of the schedule;
+// any remainder is left to the next run
+const scheduleBatchSize = models.MaxBulkItems
+
+// errNotDue skips content whose schedule changed since it was found due
+var errNotDue = errors.New("schedule not due")
+
+// RunSchedule publishes drafts whose publish_at has passed and archives
+// published content whose expire_at has passed, through the same workflow
+// transitions as the publish and archive actions. It returns how much content
+// was changed.
+func (h *ContentHandlers) RunSchedule(ctx context.Context, now time.Time) (int, error) {
+	logger := config.GetLogger()
+
+	ids, err := h.store.ListScheduled(ctx, now, scheduleBatchSize)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	results, err := h.store.UpdateMany(ctx, ids, func(content *models.Content) error {
+		return applySchedule(content, now)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			if !errors.Is(result.Err, errNotDue) && !errors.Is(result.Err, models.ErrNotFound) {
+				logger.Warn("Failed to apply content schedule",
+					zap.String("content_id", result.ID),
+					zap.Error(result.Err),
+				)
+			}
+			continue
+		}
+
+		changed++
+		logger.Info("Applied content schedule",
+			zap.String("content_id", result.ID),
+			zap.String("status", result.Content.Status),
+		)
+	}
+
+	return changed, nil
+}
+
+// applySchedule performs the transition of content that is due at now
+func applySchedule(content *models.Content, now time.Time) error {
+	switch {
+	case content.Status == statusDraft && content.PublishAt != nil && !content.PublishAt.After(now):
+		return performAction(content, actionPublish, scheduleActor)
+	case content.Status == statusPublished && content.ExpireAt != nil && !content.ExpireAt.After(now):
+		return performAction(content, actionArchive, scheduleActor)
+	}
+	return errNotDue
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/danielgtaylor/huma/v2"
+	"go.uber.org/zap"
+
+	"github.com/seenthis-ab/content-api/config"
+	"github.com/seenthis-ab/content-api/models"
+	"github.com/seenthis-ab/content-api/policy"
+)
+
+// ListTrash handles GET /content/trash requests, listing deleted content with
+// the same filters, sorting and pagination as GET /content
+func (h *ContentHandlers) ListTrash(ctx context.Context, input *ListContentInput) (*ListContentOutput, error) {
+	return h.listContent(ctx, input, "/content/trash", true)
+}
+
+// UndeleteContentInput represents the request parameters for undeleting content
+type UndeleteContentInput struct {
+	ID string `path:"id"`
+}
+
+// UndeleteContent handles POST /content/{id}/undelete requests, restoring
+// content from the trash. Callers need the policy's permission to delete the
+// content, checked against its last revision as content in the trash cannot
+// be read otherwise.
+func (h *ContentHandlers) UndeleteContent(ctx context.Context, input *UndeleteContentInput) (*UpdateContentOutput, error) {
+	logger := config.GetLoggerWithRequestID(ctx)
+
+	if h.policy != nil {
+		revisions, err := h.store.ListRevisions(ctx, input.ID)
+		if err != nil {
+			return nil, storeError(logger, err, zap.String("content_id", input.ID))
+		}
+		if len(revisions) == 0 {
+			return nil, huma.Error404NotFound("Content not found in trash")
+		}
+		if err := h.authorize(ctx, policy.ActionDelete, revisionContent(revisions[len(revisions)-1])); err != nil {
+			return nil, err
+		}
+	}
+
+	content, err := h.store.Undelete(ctx, input.ID)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, huma.Error404NotFound("Content not found in trash")
+	}
+	if err != nil {
+		return nil, storeError(logger, err, zap.String("content_id", input.ID))
+	}
+
+	logger.Info("Undeleted content",
+		zap.String("content_id", input.ID),
+		zap.Int("version", content.Version),
+	)
+
+	return &UpdateContentOutput{ETag: quoteETag(contentETag(content)), Body: *content}, nil
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/conditional"
+	"go.uber.org/zap"
+
+	"github.com/seenthis-ab/content-api/config"
+	"github.com/seenthis-ab/content-api/middleware"
+	"github.com/seenthis-ab/content-api/models"
+)
+
+// Statuses of the publishing workflow
+const (
+	statusDraft     = "draft"
+	statusPublished = "published"
+	statusArchived  = "archived"
+)
+
+// Actions of the publishing workflow, each exposed as POST /content/{id}/<action>
+const (
+	actionPublish   = "publish"
+	actionUnpublish = "unpublish"
+	actionArchive   = "archive"
+)
+
+// statusTransition is a status change allowed by the publishing workflow
+type statusTransition struct {
+	action   string
+	from, to string
+	explicit bool // only the action may make it, not an edit of the status field
+}
+
+// statusTransitions is the publishing workflow: content is published from
+// draft and archived once published. Archived content only goes back to draft
+// by explicitly unpublishing it.
+var statusTransitions = []statusTransition{
+	{action: actionPublish, from: statusDraft, to: statusPublished},
+	{action: actionUnpublish, from: statusPublished, to: statusDraft},
+	{action: actionArchive, from: statusPublished, to: statusArchived},
+	{action: actionUnpublish, from: statusArchived, to: statusDraft, explicit: true},
+}
+
+// performAction moves content along the workflow by an action, recording
+// actor as the publisher, or returns 409 if the action is not allowed from the
+// current status
+func performAction(content *models.Content, action, actor string) error {
+	for _, t := range statusTransitions {
+		if t.action == action && t.from == content.Status {
+			enterStatus(content, t.to, actor)
+			return nil
+		}
+	}
+	return huma.Error409Conflict(fmt.Sprintf("Cannot %s content with status %s", action, content.Status))
+}
+
+// withStatusWorkflow wraps an edit of content such as PUT or PATCH so that a
+// changed status must be an allowed, non-explicit transition and the schedule
+// must be consistent. Publishing by an edit records the given publisher.
+func withStatusWorkflow(publisher string, edit func(*models.Content) error) func(*models.Content) error {
+	return func(content *models.Content) error {
+		from := content.Status
+		if err := edit(content); err != nil {
+			return err
+		}
+		if detail := scheduleError(content.PublishAt, content.ExpireAt); detail != nil {
+			detail.Location = "body.expire_at"
+			return huma.Error422UnprocessableEntity("validation failed", detail)
+		}
+		if content.Status == from {
+			return nil
+		}
+
+		for _, t := range statusTransitions {
+			if t.from == from && t.to == content.Status && !t.explicit {
+				enterStatus(content, t.to, publisher)
+				return nil
+			}
+		}
+		return huma.Error409Conflict(fmt.Sprintf("Cannot change status from %s to %s", from, content.Status),
+			&huma.ErrorDetail{
+				Message:  "use POST /content/{id}/publish, /unpublish or /archive",
+				Location: "body.status",
+				Value:    content.Status,
+			})
+	}
+}
+
+// enterStatus sets the status of content. Publishing records when and by whom,
+// going back to draft clears it and archiving keeps it. Going back to draft
+// also clears schedule times that have passed, which would otherwise publish
+// or archive the content again right away.
+func enterStatus(content *models.Content, status, actor string) {
+	now := time.Now()
+	content.Status = status
+	switch status {
+	case statusPublished:
+		content.PublishedAt = &now
+		content.PublishedBy = &actor
+	case statusDraft:
+		content.PublishedAt = nil
+		content.PublishedBy = nil
+		if content.PublishAt != nil && !content.PublishAt.After(now) {
+			content.PublishAt = nil
+		}
+		if content.ExpireAt != nil && !content.ExpireAt.After(now) {
+			content.ExpireAt = nil
+		}
+	}
+}
+
+// publisher names the caller of a request as the publisher of the content it
+// publishes
+func publisher(ctx context.Context) string {
+	return middleware.GetCaller(ctx).Identity()
+}
+
+// scheduleError describes an inconsistent schedule, or returns nil
+func scheduleError(publishAt, expireAt *time.Time) *huma.ErrorDetail {
+	if publishAt != nil && expireAt != nil && !expireAt.After(*publishAt) {
+		return &huma.ErrorDetail{
+			Message: "expected a time after publish_at",
+			Value:   *expireAt,
+		}
+	}
+	return nil
+}
+
+// ContentActionInput represents the request parameters of a workflow action
+type ContentActionInput struct {
+	conditional.Params
+	ID string `path:"id"`
+}
+
+// PublishContent handles POST /content/{id}/publish requests, recording the
+// caller as the publisher
+func (h *ContentHandlers) PublishContent(ctx context.Context, input *ContentActionInput) (*UpdateContentOutput, error) {
+	return h.performAction(ctx, input, actionPublish)
+}
+
+// UnpublishContent handles POST /content/{id}/unpublish requests
+func (h *ContentHandlers) UnpublishContent(ctx context.Context, input *ContentActionInput) (*UpdateContentOutput, error) {
+	return h.performAction(ctx, input, actionUnpublish)
+}
+
+// ArchiveContent handles POST /content/{id}/archive requests
+func (h *ContentHandlers) ArchiveContent(ctx context.Context, input *ContentActionInput) (*UpdateContentOutput, error) {
+	return h.performAction(ctx, input, actionArchive)
+}
+
+// performAction applies a workflow action to the content with the given ID
+func (h *ContentHandlers) performAction(ctx context.Context, input *ContentActionInput, action string) (*UpdateContentOutput, error) {
+	var from string
+	content, err := h.updateContent(ctx, input.ID, &input.Params, func(content *models.Content) error {
+		from = content.Status
+		return performAction(content, action, publisher(ctx))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	config.GetLoggerWithRequestID(ctx).Info("Changed content status",
+		zap.String("content_id", input.ID),
+		zap.String("action", action),
+		zap.String("from", from),
+		zap.String("to", content.Status),
+	)
+
+	return &UpdateContentOutput{ETag: quoteETag(contentETag(content)), Body: *content}, nil
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/seenthis-ab/content-api/models"
+)
+
+// TestPerformAction checks every workflow action from every status: allowed
+// ones move the content to the next status, others answer 409 and leave it
+func TestPerformAction(t *testing.T) {
+	tests := []struct {
+		from   string
+		action string
+		to     string // empty if the action is not allowed
+	}{
+		{statusDraft, actionPublish, statusPublished},
+		{statusDraft, actionUnpublish, ""},
+		{statusDraft, actionArchive, ""},
+		{statusPublished, actionPublish, ""},
+		{statusPublished, actionUnpublish, statusDraft},
+		{statusPublished, actionArchive, statusArchived},
+		{statusArchived, actionPublish, ""},
+		{statusArchived, actionUnpublish, statusDraft},
+		{statusArchived, actionArchive, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action+" "+tt.from, func(t *testing.T) {
+			content := &models.Content{Status: tt.from}
+			err := performAction(content, tt.action, "alice")
+			if tt.to == "" {
+				if status := errorStatus(err); status != http.StatusConflict {
+					t.Fatalf("got error %v, want 409", err)
+				}
+				if content.Status != tt.from {
+					t.Errorf("rejected action changed the status to %s", content.Status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("performAction: %v", err)
+			}
+			if content.Status != tt.to {
+				t.Errorf("got status %s, want %s", content.Status, tt.to)
+			}
+		})
+	}
+}
+
+// TestWithStatusWorkflow checks the status changes edits may make: those of
+// the workflow except for the explicit archived to draft, which only the
+// unpublish action makes
+func TestWithStatusWorkflow(t *testing.T) {
+	tests := []struct {
+		from, to string
+		allowed  bool
+	}{
+		{statusDraft, statusDraft, true},
+		{statusDraft, statusPublished, true},
+		{statusDraft, statusArchived, false},
+		{statusPublished, statusDraft, true},
+		{statusPublished, statusArchived, true},
+		{statusArchived, statusDraft, false},
+		{statusArchived, statusPublished, false},
+		{statusArchived, statusArchived, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			content := &models.Content{Status: tt.from}
+			err := withStatusWorkflow("alice", func(content *models.Content) error {
+				content.Status = tt.to
+				return nil
+			})(content)
+			if !tt.allowed {
+				if status := errorStatus(err); status != http.StatusConflict {
+					t.Errorf("got error %v, want 409", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %v, want the change allowed", err)
+			}
+		})
+	}
+}
+
+// TestEnterStatus checks what entering a status records: publishing sets the
+// publisher, archiving keeps it and going back to draft clears it together
+// with schedule times that have passed
+func TestEnterStatus(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	content := &models.Content{Status: statusDraft, ExpireAt: &future}
+
+	enterStatus(content, statusPublished, "alice")
+	if content.PublishedAt == nil || content.PublishedBy == nil || *content.PublishedBy != "alice" {
+		t.Fatalf("published content has published_at %v, published_by %v", content.PublishedAt, content.PublishedBy)
+	}
+
+	enterStatus(content, statusArchived, "bob")
+	if content.PublishedBy == nil || *content.PublishedBy != "alice" {
+		t.Errorf("archiving changed published_by to %v", content.PublishedBy)
+	}
+
+	content.PublishAt = &past
+	enterStatus(content, statusDraft, "bob")
+	if content.PublishedAt != nil || content.PublishedBy != nil {
+		t.Errorf("draft has published_at %v, published_by %v, want none", content.PublishedAt, content.PublishedBy)
+	}
+	if content.PublishAt != nil || content.ExpireAt == nil {
+		t.Errorf("draft has publish_at %v, expire_at %v, want only the future expire_at", content.PublishAt, content.ExpireAt)
+	}
+}
+
+// TestWorkflowEndpoints walks content through the workflow over HTTP: the
+// actions record the publisher, an edit cannot take archived content back to
+// draft and the unpublish action can
+func TestWorkflowEndpoints(t *testing.T) {
+	api := newTestAPI(t, nil)
+	token := testToken(t, "alice")
+	content := api.create(t, token, nil)
+	path := "/content/" + content.ID
+
+	resp := api.request(t, token, http.MethodPost, path+"/publish", nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("publish = %d %s", resp.Code, resp.Body)
+	}
+	published := decode[models.Content](t, resp)
+	if published.Status != statusPublished || published.PublishedBy == nil || *published.PublishedBy != "sub:alice" {
+		t.Errorf("published content has status %s, published_by %v", published.Status, published.PublishedBy)
+	}
+
+	if resp := api.request(t, token, http.MethodPost, path+"/publish", nil); resp.Code != http.StatusConflict {
+		t.Errorf("publish again = %d %s, want 409", resp.Code, resp.Body)
+	}
+	if resp := api.request(t, token, http.MethodPost, path+"/archive", nil); resp.Code != http.StatusOK {
+		t.Fatalf("archive = %d %s", resp.Code, resp.Body)
+	}
+
+	draft := map[string]any{"title": "Title", "body": "Body", "author": "alice", "status": statusDraft}
+	if resp := api.request(t, token, http.MethodPut, path, draft); resp.Code != http.StatusConflict {
+		t.Errorf("PUT archived content as draft = %d %s, want 409", resp.Code, resp.Body)
+	}
+	patch := `{"status": "draft"}`
+	if resp := api.request(t, token, http.MethodPatch, path, patch, "Content-Type", MergePatchContentType); resp.Code != http.StatusConflict {
+		t.Errorf("PATCH archived content to draft = %d %s, want 409", resp.Code, resp.Body)
+	}
+
+	resp = api.request(t, token, http.MethodPost, path+"/unpublish", nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unpublish archived content = %d %s", resp.Code, resp.Body)
+	}
+	if unpublished := decode[models.Content](t, resp); unpublished.Status != statusDraft || unpublished.PublishedBy != nil {
+		t.Errorf("unpublished content has status %s, published_by %v", unpublished.Status, unpublished.PublishedBy)
+	}
+}
@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/seenthis-ab/content-api/config"
+)
+
+// IdempotencyKeyPurger removes idempotency keys that expired before a given time
+type IdempotencyKeyPurger interface {
+	PurgeIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int, error)
+}
+
+// PurgeIdempotencyKeys removes expired idempotency keys once on start and
+// then every purge interval, until ctx is canceled. Expired keys are already
+// ignored by the store; purging only keeps the table from growing.
+func PurgeIdempotencyKeys(ctx context.Context, store IdempotencyKeyPurger, cfg *config.IdempotencyConfig) {
+	logger := config.GetLogger()
+
+	logger.Info("Starting idempotency key purge job",
+		zap.Duration("ttl", cfg.TTL),
+		zap.Duration("interval", cfg.PurgeInterval),
+	)
+
+	ticker := time.NewTicker(cfg.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purgeIdempotencyKeys(ctx, logger, store)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeIdempotencyKeys runs a single purge, logging rather than returning
+// failures so that the next run tries again
+func purgeIdempotencyKeys(ctx context.Context, logger *zap.Logger, store IdempotencyKeyPurger) {
+	purged, err := store.PurgeIdempotencyKeys(ctx, time.Now())
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Error("Failed to purge idempotency keys", zap.Error(err))
+		}
+		return
+	}
+
+	if purged > 0 {
+		logger.Info("Purged idempotency keys",
+			zap.Int("count", purged),
+		)
+	}
+}
@@ -0,0 +1,66 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/seenthis-ab/content-api/config"
+)
+
+// TrashPurger permanently removes content deleted before a given time
+type TrashPurger interface {
+	Purge(ctx context.Context, deletedBefore time.Time) (int, error)
+}
+
+// PurgeTrash purges content that has been in the trash for longer than the
+// configured retention, once on start and then every purge interval, until
+// ctx is canceled. It returns immediately if the retention is zero.
+func PurgeTrash(ctx context.Context, store TrashPurger, cfg *config.TrashConfig) {
+	logger := config.GetLogger()
+
+	if cfg.Retention <= 0 {
+		logger.Info("Trash purge disabled")
+		return
+	}
+
+	logger.Info("Starting trash purge job",
+		zap.Duration("retention", cfg.Retention),
+		zap.Duration("interval", cfg.PurgeInterval),
+	)
+
+	ticker := time.NewTicker(cfg.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purgeTrash(ctx, logger, store, cfg.Retention)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeTrash runs a single purge, logging rather than returning failures so
+// that the next run tries again
+func purgeTrash(ctx context.Context, logger *zap.Logger, store TrashPurger, retention time.Duration) {
+	deletedBefore := time.Now().Add(-retention)
+
+	purged, err := store.Purge(ctx, deletedBefore)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Error("Failed to purge trash", zap.Error(err))
+		}
+		return
+	}
+
+	if purged > 0 {
+		logger.Info("Purged trash",
+			zap.Int("count", purged),
+			zap.Time("deleted_before", deletedBefore),
+		)
+	}
+}
@@ -0,0 +1,78 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/seenthis-ab/content-api/config"
+)
+
+// scheduleLockName names the lock that lets one server instance at a time
+// apply the publishing schedule
+const scheduleLockName = "content-schedule"
+
+// ContentScheduler applies the publishing schedule of content that is due
+type ContentScheduler interface {
+	RunSchedule(ctx context.Context, now time.Time) (int, error)
+}
+
+// ExclusiveRunner runs a function unless another server instance is running
+// one under the same name
+type ExclusiveRunner interface {
+	RunExclusive(ctx context.Context, name string, fn func(context.Context) error) (bool, error)
+}
+
+// RunScheduler applies the publishing schedule every interval until ctx is
+// canceled. Runs are exclusive across server instances sharing the database,
+// so a single instance publishes and archives any given content. It returns
+// immediately if the interval is zero.
+func RunScheduler(ctx context.Context, runner ExclusiveRunner, scheduler ContentScheduler, cfg *config.SchedulerConfig) {
+	logger := config.GetLogger()
+
+	if cfg.Interval <= 0 {
+		logger.Info("Scheduler disabled")
+		return
+	}
+
+	logger.Info("Starting scheduler",
+		zap.Duration("interval", cfg.Interval),
+	)
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		runSchedule(ctx, logger, runner, scheduler)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runSchedule applies the schedule once if no other instance is doing so,
+// logging rather than returning failures so that the next run tries again
+func runSchedule(ctx context.Context, logger *zap.Logger, runner ExclusiveRunner, scheduler ContentScheduler) {
+	var changed int
+	ran, err := runner.RunExclusive(ctx, scheduleLockName, func(ctx context.Context) error {
+		var err error
+		changed, err = scheduler.RunSchedule(ctx, time.Now())
+		return err
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Error("Failed to apply content schedule", zap.Error(err))
+		}
+		return
+	}
+
+	if ran && changed > 0 {
+		logger.Info("Applied content schedule",
+			zap.Int("count", changed),
+		)
+	}
+}
@@ -1,20 +1,32 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
 	"time"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/adapters/humachi"
 	"github.com/danielgtaylor/huma/v2/humacli"
 	"github.com/go-chi/chi/v5"
+	"github.com/spf13/cobra"
 
 	_ "github.com/danielgtaylor/huma/v2/formats/cbor"
 	"github.com/seenthis-ab/content-api/config"
 	"github.com/seenthis-ab/content-api/handlers"
+	"github.com/seenthis-ab/content-api/jobs"
+	"github.com/seenthis-ab/content-api/metrics"
 	"github.com/seenthis-ab/content-api/middleware"
 	"github.com/seenthis-ab/content-api/models"
+	"github.com/seenthis-ab/content-api/policy"
+	"github.com/seenthis-ab/content-api/tracing"
 	"go.uber.org/zap"
 )
 
@@ -23,6 +35,10 @@ type Options struct {
 	Port int `help:"Port to listen on" short:"p" default:"8888"`
 }
 
+// writeTimeout bounds both the HTTP write and the request context, so store
+// queries are canceled when the server gives up on a response
+const writeTimeout = 30 * time.Second
+
 // Use the shared interface and Content struct from models package
 
 func main() {
@@ -34,46 +50,365 @@ func main() {
 		logger.Fatal("Failed to initialize database", zap.Error(err))
 	}
 
+	contentIDConfig, err := config.LoadContentIDConfig()
+	if err != nil {
+		logger.Fatal("Failed to load configuration", zap.Error(err))
+	}
+
+	// Without a policy file every caller may do what their scopes permit
+	contentPolicy, err := policy.Load(config.LoadPolicyConfig().File)
+	if err != nil {
+		logger.Fatal("Failed to load configuration", zap.Error(err))
+	}
+
+	// Bearer tokens are only accepted once a secret or JWKS file is configured
+	var tokenVerifier *middleware.TokenVerifier
+	if jwtConfig := config.LoadJWTConfig(); jwtConfig.Enabled() {
+		tokenVerifier, err = middleware.NewTokenVerifier(jwtConfig)
+		if err != nil {
+			logger.Fatal("Failed to load configuration", zap.Error(err))
+		}
+	}
+
+	// Spans are exported as configured by TRACING_EXPORTER; without it trace
+	// IDs are still propagated and logged
+	tracerProvider, err := tracing.NewTracerProvider(context.Background(), config.LoadTracingConfig())
+	if err != nil {
+		logger.Fatal("Failed to load configuration", zap.Error(err))
+	}
+	defer tracerProvider.Shutdown(context.Background())
+
+	// Tracks whether the server is shutting down
+	drainer := middleware.NewDrainer()
+
 	// Create a CLI app which takes a port option.
 	cli := humacli.New(func(hooks humacli.Hooks, options *Options) {
 		// Create a new router & API
 		router := chi.NewMux()
 
+		// Report database, encoding and other time in a Server-Timing header,
+		// first so that it covers the other middleware
+		router.Use(middleware.ServerTimingMiddleware())
+
+		// Close connections once the server is draining
+		router.Use(drainer.Middleware())
+
+		// Trace every request, early so that the server span covers the other
+		// middleware and logs include the trace ID
+		router.Use(middleware.TracingMiddleware())
+
+		// Identify callers by API key or bearer token, before logging so that
+		// logs include the key ID or token subject
+		router.Use(middleware.AuthMiddleware(contentStore, config.LoadAuthConfig(), tokenVerifier))
+
 		// Add logging middleware
-		router.Use(middleware.LoggingMiddleware())
+		router.Use(middleware.LoggingMiddleware(config.LoadAccessLogConfig()))
+
+		// Cancel in-flight store queries once the write timeout has passed
+		router.Use(middleware.TimeoutMiddleware(writeTimeout))
+
+		humaConfig := huma.DefaultConfig("My API", "1.0.0")
+		humaConfig.Components.SecuritySchemes = map[string]*huma.SecurityScheme{
+			middleware.SecuritySchemeAPIKey: middleware.APIKeySecurityScheme(),
+			middleware.SecuritySchemeBearer: middleware.BearerSecurityScheme(),
+		}
+		humaConfig.Formats = middleware.TimedFormats(humaConfig.Formats)
+		api := humachi.New(router, humaConfig)
+
+		// Record request metrics of every operation, including rejected requests,
+		// and database pool metrics of the selected store
+		registry := metrics.NewRegistry()
+		api.UseMiddleware(metrics.NewHTTP(registry).Middleware)
+		metrics.RegisterDBStats(registry, contentStore)
+		router.Handle("/metrics", metrics.Handler(registry))
 
-		api := humachi.New(router, huma.DefaultConfig("My API", "1.0.0"))
+		// Record a span for every operation, grouping the spans of its queries
+		api.UseMiddleware(middleware.TraceOperations)
+
+		// Time the encoding of response bodies for the Server-Timing header
+		api.UseMiddleware(middleware.TimeEncoding)
+
+		// Reject callers lacking the scope an operation requires
+		api.UseMiddleware(middleware.RequireScopes(api))
+		read := middleware.Scope(middleware.ScopeContentRead)
+		write := middleware.Scope(middleware.ScopeContentWrite)
+
+		// Register probes, which require no scope so that orchestrators can call
+		// them without credentials
+		healthHandlers := handlers.NewHealthHandlers(contentStore, drainer)
+		huma.Get(api, "/healthz", healthHandlers.Healthz, func(o *huma.Operation) {
+			o.Description = "Liveness probe: returns 200 while the process serves requests, without checking the database."
+		})
+		huma.Get(api, "/readyz", healthHandlers.Readyz, func(o *huma.Operation) {
+			o.Description = "Readiness probe: returns 200 if the database can be reached, its migrations are at the " +
+				"version the server expects and the server is not shutting down, otherwise 503. " +
+				"The body reports each check."
+		})
 
 		// Initialize content handlers
-		contentHandlers := handlers.NewContentHandlers(contentStore)
+		idempotencyConfig := config.LoadIdempotencyConfig()
+		contentHandlers := handlers.NewContentHandlers(contentStore, idempotencyConfig, contentIDConfig, contentPolicy)
 
 		// Register content endpoints
-		huma.Post(api, "/content", contentHandlers.CreateContent)
-		huma.Get(api, "/content/{id}", contentHandlers.GetContent)
-		huma.Get(api, "/content", contentHandlers.ListContent)
-		huma.Put(api, "/content/{id}", contentHandlers.UpdateContent)
-		huma.Delete(api, "/content/{id}", contentHandlers.DeleteContent)
+		huma.Post(api, "/content", contentHandlers.CreateContent, write, func(o *huma.Operation) {
+			o.Description = "Creates content. Send an Idempotency-Key header to make retries safe: a retry " +
+				"with the same key and body returns the original response with Idempotent-Replayed: true " +
+				"instead of creating the content again, while the same key with a different body returns 422. " +
+				"Keys are remembered for IDEMPOTENCY_KEY_TTL (24 hours by default)."
+		})
+		huma.Get(api, "/content/search", contentHandlers.SearchContent, read)
+		huma.Get(api, "/content/{id}", contentHandlers.GetContent, read)
+		huma.Get(api, "/content", contentHandlers.ListContent, read, func(o *huma.Operation) {
+			o.Description = "Lists content, newest first by default. " +
+				"The JSON data column can be filtered with data.<key>=<value> query parameters " +
+				"(nested keys separated by dots), e.g. data.category=programming for equality " +
+				"or data.tags=contains:go for array membership. Values that parse as JSON " +
+				"numbers, booleans, null or quoted strings are matched as such, anything else as a string. " +
+				"status=published only lists content inside its publish_at/expire_at window."
+		})
+		huma.Put(api, "/content/{id}", contentHandlers.UpdateContent, write, func(o *huma.Operation) {
+			o.Description = "Replaces content entirely: every editable field is set from the body " +
+				"and an omitted data becomes {}, while an omitted status is left unchanged. Use PATCH to " +
+				"change individual fields or data keys. Status changes must follow the publishing workflow " +
+				"(draft to published to archived, or published back to draft), otherwise 409 is returned; " +
+				"archived content returns to draft only through POST /content/{id}/unpublish. " +
+				"Drafts with a publish_at are published by the scheduler once it passes, and published " +
+				"content with an expire_at is archived once that passes. " +
+				"If no content exists under the ID, it is created there with 201 Created, provided the ID is a " +
+				"lowercase ULID or matches CONTENT_ID_PATTERN; send If-None-Match: * to only create. " +
+				"IDs of content in the trash return 409 until the content is undeleted."
+		})
+		handlers.RegisterPatchContent(api, contentHandlers, write)
+		huma.Delete(api, "/content/{id}", contentHandlers.DeleteContent, write, func(o *huma.Operation) {
+			o.Description = "Moves content to the trash. Deleted content is reported as missing until it is " +
+				"undeleted, and is purged for good once it has been in the trash for the retention period."
+		})
+
+		// Register publishing workflow endpoints
+		huma.Post(api, "/content/{id}/publish", contentHandlers.PublishContent, write, func(o *huma.Operation) {
+			o.Description = "Publishes draft content, recording published_at and the caller as published_by. " +
+				"Returns 409 unless the content is a draft."
+		})
+		huma.Post(api, "/content/{id}/unpublish", contentHandlers.UnpublishContent, write, func(o *huma.Operation) {
+			o.Description = "Returns published or archived content to draft, clearing published_at and " +
+				"published_by. This is the only way out of archived. Returns 409 for drafts."
+		})
+		huma.Post(api, "/content/{id}/archive", contentHandlers.ArchiveContent, write, func(o *huma.Operation) {
+			o.Description = "Archives published content, keeping published_at and published_by. " +
+				"Returns 409 unless the content is published."
+		})
+
+		// Register trash endpoints
+		huma.Get(api, "/content/trash", contentHandlers.ListTrash, read, func(o *huma.Operation) {
+			o.Description = "Lists deleted content that has not been purged yet, with the same filters, " +
+				"sorting and pagination as GET /content."
+		})
+		huma.Post(api, "/content/{id}/undelete", contentHandlers.UndeleteContent, write, func(o *huma.Operation) {
+			o.Description = "Restores content from the trash. The undelete is recorded as a new revision."
+		})
+
+		// Register revision endpoints
+		huma.Get(api, "/content/{id}/revisions", contentHandlers.ListRevisions, read, func(o *huma.Operation) {
+			o.Description = "Lists the revisions recorded by every create, update, delete and undelete of " +
+				"the content, oldest first. The history of content in the trash remains available."
+		})
+		huma.Get(api, "/content/{id}/revisions/{rev}", contentHandlers.GetRevision, read)
+		huma.Get(api, "/content/{id}/revisions/{rev}/diff", contentHandlers.DiffRevisions, read, func(o *huma.Operation) {
+			o.Description = "Returns the difference between two revisions as a JSON Patch that turns " +
+				"revision from (the previous one by default) into revision rev."
+		})
+		huma.Post(api, "/content/{id}/revisions/{rev}/restore", contentHandlers.RestoreRevision, write, func(o *huma.Operation) {
+			o.Description = "Sets the title, body and data of the content back to those of a revision, " +
+				"keeping its author and status. The restore is recorded as a new revision. Supports If-Match like PUT."
+		})
+
+		// Register bulk endpoints
+		huma.Post(api, "/content/bulk", contentHandlers.BulkCreateContent, write, func(o *huma.Operation) {
+			o.Description = "Creates up to 1000 items in a single transaction: either all are created or none."
+		})
+		huma.Patch(api, "/content/bulk", contentHandlers.BulkPatchContent, write, func(o *huma.Operation) {
+			o.Description = "Applies one JSON Merge Patch to up to 1000 items in a single transaction. " +
+				"Items that are missing or fail validation are reported individually with their own " +
+				"status and problem details while the others are updated; the response is then 207."
+		})
+		huma.Delete(api, "/content/bulk", contentHandlers.BulkDeleteContent, write, func(o *huma.Operation) {
+			o.Description = "Moves up to 1000 items to the trash in a single statement. Missing items are reported " +
+				"individually with status 404 while the others are deleted; the response is then 207."
+		})
+
+		// Configure HTTP server for high concurrency. Requests run under a
+		// base context that is canceled if they outlast the shutdown timeout.
+		requestCtx, cancelRequests := context.WithCancel(context.Background())
+		server := &http.Server{
+			Addr:         ":" + strconv.Itoa(options.Port),
+			Handler:      router,
+			ReadTimeout:  30 * time.Second,
+			WriteTimeout: writeTimeout,
+			IdleTimeout:  120 * time.Second,
+			BaseContext:  func(net.Listener) context.Context { return requestCtx },
+		}
+
+		// Background jobs run until the server has drained
+		jobsCtx, stopJobs := context.WithCancel(context.Background())
+		var runningJobs sync.WaitGroup
 
 		// Tell the CLI how to start your router.
 		hooks.OnStart(func() {
-			// Configure HTTP server for high concurrency
-			server := &http.Server{
-				Addr:         ":" + strconv.Itoa(options.Port),
-				Handler:      router,
-				ReadTimeout:  30 * time.Second,
-				WriteTimeout: 30 * time.Second,
-				IdleTimeout:  120 * time.Second,
-			}
+			// Purge expired trash and idempotency keys and apply the publishing
+			// schedule in the background while the server runs
+			runningJobs.Add(3)
+			go func() {
+				defer runningJobs.Done()
+				jobs.PurgeTrash(jobsCtx, contentStore, config.LoadTrashConfig())
+			}()
+			go func() {
+				defer runningJobs.Done()
+				jobs.PurgeIdempotencyKeys(jobsCtx, contentStore, idempotencyConfig)
+			}()
+			go func() {
+				defer runningJobs.Done()
+				jobs.RunScheduler(jobsCtx, contentStore, contentHandlers, config.LoadSchedulerConfig())
+			}()
 
 			logger.Info("Starting server with high concurrency settings",
 				zap.Int("port", options.Port),
 			)
-			if err := server.ListenAndServe(); err != nil {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 				logger.Error("Error starting server", zap.Error(err))
 			}
 		})
+
+		// Shut down gracefully on SIGINT or SIGTERM. The logger is flushed and
+		// remaining spans exported once the CLI returns.
+		hooks.OnStop(func() {
+			shutdownConfig := config.LoadShutdownConfig()
+			logger.Info("Shutting down, draining requests",
+				zap.Duration("delay", shutdownConfig.Delay),
+				zap.Duration("timeout", shutdownConfig.Timeout),
+			)
+
+			// Fail readiness first, so that load balancers stop sending requests
+			// before the server stops accepting them
+			drainer.Start()
+			time.Sleep(shutdownConfig.Delay)
+
+			// Stop accepting connections and wait for in-flight requests,
+			// canceling those that do not finish in time
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownConfig.Timeout)
+			defer cancel()
+			if err := server.Shutdown(ctx); err != nil {
+				logger.Warn("In-flight requests did not finish before the shutdown timeout, canceling them",
+					zap.Error(err),
+				)
+				cancelRequests()
+				server.Close()
+			}
+			cancelRequests()
+
+			// Let a running purge or schedule finish before closing the store,
+			// which checkpoints the SQLite WAL
+			stopJobs()
+			runningJobs.Wait()
+			if err := contentStore.Close(); err != nil {
+				logger.Error("Failed to close database", zap.Error(err))
+			}
+			logger.Info("Server stopped")
+		})
 	})
 
+	// Add commands to manage API keys in the configured database
+	cli.Root().AddCommand(apiKeyCommand(contentStore))
+
 	// Run the CLI. When passed no commands, it starts the server.
 	cli.Run()
 }
+
+// apiKeyCommand creates the api-key command, which mints, lists and revokes
+// API keys in the database of the configured engine
+func apiKeyCommand(store models.APIKeyStore) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "api-key",
+		Short: "Manage API keys",
+	}
+
+	var name string
+	var scopes []string
+	create := &cobra.Command{
+		Use:   "create",
+		Short: "Mint an API key and print it; the key is not shown again",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if config.GetDatabaseEngine() == "memory" {
+				return errors.New("API keys of the in-memory store would be lost on exit")
+			}
+			for _, scope := range scopes {
+				if scope != middleware.ScopeContentRead && scope != middleware.ScopeContentWrite {
+					return fmt.Errorf("unknown scope %q, expected %s or %s", scope,
+						middleware.ScopeContentRead, middleware.ScopeContentWrite)
+				}
+			}
+
+			key, secret := models.NewAPIKey(name, scopes)
+			if err := store.CreateAPIKey(cmd.Context(), key); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "id:     %s\nscopes: %s\nkey:    %s\n",
+				key.ID, strings.Join(key.Scopes, ","), secret)
+			return nil
+		},
+	}
+	create.Flags().StringVar(&name, "name", "", "What or who the key is for")
+	create.Flags().StringSliceVar(&scopes, "scope", []string{middleware.ScopeContentRead},
+		"Scope to grant, repeatable: "+middleware.ScopeContentRead+" or "+middleware.ScopeContentWrite)
+	create.MarkFlagRequired("name")
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List API keys, newest first",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keys, err := store.ListAPIKeys(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tNAME\tSCOPES\tCREATED\tREVOKED")
+			for _, key := range keys {
+				revoked := "-"
+				if key.RevokedAt != nil {
+					revoked = key.RevokedAt.UTC().Format(time.RFC3339)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", key.ID, key.Name, strings.Join(key.Scopes, ","),
+					key.CreatedAt.UTC().Format(time.RFC3339), revoked)
+			}
+			return w.Flush()
+		},
+	}
+
+	revoke := &cobra.Command{
+		Use:   "revoke <id>",
+		Short: "Revoke an API key; servers stop accepting it within AUTH_KEY_CACHE_TTL",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := store.RevokeAPIKey(cmd.Context(), args[0])
+			if errors.Is(err, models.ErrNotFound) {
+				return fmt.Errorf("no unrevoked API key with id %s", args[0])
+			}
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "revoked %s\n", args[0])
+			return nil
+		},
+	}
+
+	// Errors past argument parsing are not usage mistakes
+	for _, sub := range []*cobra.Command{create, list, revoke} {
+		sub.SilenceUsage = true
+	}
+	cmd.AddCommand(create, list, revoke)
+	return cmd
+}
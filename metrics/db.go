@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// PoolStater is a store backed by a pgx connection pool
+type PoolStater interface {
+	PoolStat() *pgxpool.Stat
+}
+
+// SQLStore is a store backed by a database/sql handle
+type SQLStore interface {
+	DB() *sql.DB
+}
+
+// RegisterDBStats registers the connection pool metrics of a store, read
+// from pgxpool.Stat() for Postgres and sql.DB.Stats() for SQLite. Stores
+// without a database, such as the in-memory store, have none.
+func RegisterDBStats(r prometheus.Registerer, store any) {
+	switch store := store.(type) {
+	case PoolStater:
+		r.MustRegister(newPoolCollector(store))
+	case SQLStore:
+		r.MustRegister(collectors.NewDBStatsCollector(store.DB(), "sqlite"))
+	}
+}
+
+// poolMetric is a metric read from a pgxpool.Stat
+type poolMetric struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	value     func(s *pgxpool.Stat) float64
+}
+
+// poolCollector collects the statistics of a pgx pool, reading them once
+// per scrape so that the metrics are consistent with each other
+type poolCollector struct {
+	store   PoolStater
+	metrics []poolMetric
+}
+
+func newPoolCollector(store PoolStater) *poolCollector {
+	gauge := func(name, help string, value func(s *pgxpool.Stat) float64) poolMetric {
+		return poolMetric{prometheus.NewDesc(name, help, nil, nil), prometheus.GaugeValue, value}
+	}
+	counter := func(name, help string, value func(s *pgxpool.Stat) float64) poolMetric {
+		return poolMetric{prometheus.NewDesc(name, help, nil, nil), prometheus.CounterValue, value}
+	}
+
+	return &poolCollector{store: store, metrics: []poolMetric{
+		gauge("pgxpool_acquired_conns", "Connections currently acquired from the pool.",
+			func(s *pgxpool.Stat) float64 { return float64(s.AcquiredConns()) }),
+		gauge("pgxpool_idle_conns", "Idle connections in the pool.",
+			func(s *pgxpool.Stat) float64 { return float64(s.IdleConns()) }),
+		gauge("pgxpool_constructing_conns", "Connections being established.",
+			func(s *pgxpool.Stat) float64 { return float64(s.ConstructingConns()) }),
+		gauge("pgxpool_total_conns", "Connections in the pool, acquired, idle or being established.",
+			func(s *pgxpool.Stat) float64 { return float64(s.TotalConns()) }),
+		gauge("pgxpool_max_conns", "Maximum size of the pool.",
+			func(s *pgxpool.Stat) float64 { return float64(s.MaxConns()) }),
+		counter("pgxpool_acquires_total", "Connections acquired from the pool.",
+			func(s *pgxpool.Stat) float64 { return float64(s.AcquireCount()) }),
+		counter("pgxpool_acquire_duration_seconds_total", "Time spent acquiring connections from the pool.",
+			func(s *pgxpool.Stat) float64 { return s.AcquireDuration().Seconds() }),
+		counter("pgxpool_empty_acquires_total", "Acquires that had to wait because the pool had no idle connection.",
+			func(s *pgxpool.Stat) float64 { return float64(s.EmptyAcquireCount()) }),
+		counter("pgxpool_canceled_acquires_total", "Acquires canceled by their context.",
+			func(s *pgxpool.Stat) float64 { return float64(s.CanceledAcquireCount()) }),
+		counter("pgxpool_new_conns_total", "Connections opened.",
+			func(s *pgxpool.Stat) float64 { return float64(s.NewConnsCount()) }),
+		counter("pgxpool_max_lifetime_destroys_total", "Connections closed for exceeding their maximum lifetime.",
+			func(s *pgxpool.Stat) float64 { return float64(s.MaxLifetimeDestroyCount()) }),
+		counter("pgxpool_max_idle_destroys_total", "Connections closed for exceeding their maximum idle time.",
+			func(s *pgxpool.Stat) float64 { return float64(s.MaxIdleDestroyCount()) }),
+	}}
+}
+
+// Describe implements prometheus.Collector
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c.metrics {
+		ch <- m.desc
+	}
+}
+
+// Collect implements prometheus.Collector
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.store.PoolStat()
+	for _, m := range c.metrics {
+		ch <- prometheus.MustNewConstMetric(m.desc, m.valueType, m.value(stat))
+	}
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// HTTP holds the request metrics of the API operations
+type HTTP struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+}
+
+// NewHTTP creates and registers the request metrics
+func NewHTTP(r prometheus.Registerer) *HTTP {
+	m := &HTTP{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Requests handled, by huma operation, method and status.",
+		}, []string{"operation", "method", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Time spent handling requests, by huma operation, method and status.",
+			Buckets: DefaultBuckets,
+		}, []string{"operation", "method", "status"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Requests currently being handled, by huma operation.",
+		}, []string{"operation"}),
+	}
+	r.MustRegister(m.requests, m.duration, m.inFlight)
+	return m
+}
+
+// Middleware is a huma middleware recording the metrics of every operation.
+// It should be the first huma middleware so that requests rejected by later
+// ones are counted too.
+func (m *HTTP) Middleware(ctx huma.Context, next func(huma.Context)) {
+	operation := ctx.Operation().OperationID
+
+	inFlight := m.inFlight.WithLabelValues(operation)
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	start := time.Now()
+	next(ctx)
+	elapsed := time.Since(start).Seconds()
+
+	status := strconv.Itoa(ctx.Status())
+	m.requests.WithLabelValues(operation, ctx.Method(), status).Inc()
+	m.duration.WithLabelValues(operation, ctx.Method(), status).Observe(elapsed)
+}
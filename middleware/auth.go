@@ -0,0 +1,264 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"go.uber.org/zap"
+
+	"github.com/seenthis-ab/content-api/config"
+	"github.com/seenthis-ab/content-api/models"
+)
+
+// APIKeyHeader is the request header carrying an API key
+const APIKeyHeader = "X-API-Key"
+
+// SecuritySchemeAPIKey names the API key security scheme in the OpenAPI document
+const SecuritySchemeAPIKey = "apiKey"
+
+// Scopes that API keys grant and operations require
+const (
+	ScopeContentRead  = "content:read"
+	ScopeContentWrite = "content:write"
+)
+
+// CallerKey is the context key for storing the caller of a request
+const CallerKey = "caller"
+
+// APIKeyIDKey is the context key for storing the ID of the API key that
+// authenticated a request, which loggers add to every line
+const APIKeyIDKey = "api_key_id"
+
+var (
+	errInvalidAPIKey = errors.New("invalid API key")
+	errAuthFailed    = errors.New("authentication failed")
+)
+
+// Caller identifies who made a request and what it may do
+type Caller struct {
+	APIKeyID string  // empty unless authenticated by API key
+	Claims   *Claims // nil unless authenticated by bearer token
+	Scopes   []string
+	err      error // why the credentials were rejected, if they were
+}
+
+// HasScope reports whether the caller was granted the given scope
+func (c *Caller) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// Anonymous reports whether the caller sent no credentials
+func (c *Caller) Anonymous() bool {
+	return c.APIKeyID == "" && c.Claims == nil
+}
+
+// Identity names the caller for the records it leaves: "sub:" followed by the
+// sub claim of its bearer token, "api-key:" followed by the ID of its API key,
+// or "anonymous", also for a nil caller. The prefixes keep token subjects
+// apart from API keys and from each other's reserved names, so that no token
+// can pass for an API key or the anonymous caller.
+func (c *Caller) Identity() string {
+	switch {
+	case c == nil:
+		return "anonymous"
+	case c.Claims != nil && c.Claims.Subject != "":
+		return "sub:" + c.Claims.Subject
+	case c.APIKeyID != "":
+		return "api-key:" + c.APIKeyID
+	}
+	return "anonymous"
+}
+
+// GetCaller retrieves the caller from the context, or nil outside of requests
+func GetCaller(ctx context.Context) *Caller {
+	caller, _ := ctx.Value(CallerKey).(*Caller)
+	return caller
+}
+
+// APIKeySecurityScheme describes API key authentication for the OpenAPI document
+func APIKeySecurityScheme() *huma.SecurityScheme {
+	return &huma.SecurityScheme{
+		Type:        "apiKey",
+		In:          "header",
+		Name:        APIKeyHeader,
+		Description: "API key minted with `api-key create`. Requests without a key get the anonymous scopes, content:read by default.",
+	}
+}
+
+// Scope declares that an operation requires the given scope, granted by
+// either an API key or a bearer token, which RequireScopes enforces and the
+// OpenAPI document lists
+func Scope(scope string) func(o *huma.Operation) {
+	return func(o *huma.Operation) {
+		o.Security = append(o.Security,
+			map[string][]string{SecuritySchemeAPIKey: {scope}},
+			map[string][]string{SecuritySchemeBearer: {scope}},
+		)
+		o.Errors = append(o.Errors, http.StatusUnauthorized, http.StatusForbidden)
+	}
+}
+
+// APIKeyStore looks up API keys by the hash of the key
+type APIKeyStore interface {
+	GetAPIKey(ctx context.Context, keyHash string) (*models.APIKey, error)
+}
+
+// apiKeyCacheEntry is an API key looked up within the cache TTL
+type apiKeyCacheEntry struct {
+	key     *models.APIKey
+	expires time.Time
+}
+
+// AuthMiddleware creates a middleware that identifies the caller of each
+// request from its X-API-Key header, or else its Authorization bearer token,
+// and stores it in the request context along with the token claims. Requests
+// without credentials get the anonymous scopes, and bearer tokens are all
+// rejected if tokens is nil. It rejects nothing itself: RequireScopes answers
+// operations the caller may not use, so that rejected requests are logged like
+// any other. It must run before LoggingMiddleware for the key ID and token
+// subject to appear in the request logs.
+func AuthMiddleware(store APIKeyStore, cfg *config.AuthConfig, tokens *TokenVerifier) func(http.Handler) http.Handler {
+	anonymous := &Caller{Scopes: cfg.AnonymousScopes}
+
+	// Known keys only, so that guessed keys cannot grow the cache
+	var cache sync.Map // key hash -> apiKeyCacheEntry
+
+	authenticate := func(ctx context.Context, apiKey string) *Caller {
+		keyHash := models.HashAPIKey(apiKey)
+
+		if entry, ok := cache.Load(keyHash); ok && time.Now().Before(entry.(apiKeyCacheEntry).expires) {
+			key := entry.(apiKeyCacheEntry).key
+			return &Caller{APIKeyID: key.ID, Scopes: key.Scopes}
+		}
+
+		key, err := store.GetAPIKey(ctx, keyHash)
+		if errors.Is(err, models.ErrNotFound) {
+			cache.Delete(keyHash)
+			return &Caller{err: errInvalidAPIKey}
+		}
+		if err != nil {
+			// Logged by RequireScopes, where the request ID is known
+			return &Caller{err: fmt.Errorf("%w: failed to look up API key: %w", errAuthFailed, err)}
+		}
+
+		if cfg.KeyCacheTTL > 0 {
+			cache.Store(keyHash, apiKeyCacheEntry{key: key, expires: time.Now().Add(cfg.KeyCacheTTL)})
+		}
+		return &Caller{APIKeyID: key.ID, Scopes: key.Scopes}
+	}
+
+	verify := func(token string) *Caller {
+		if tokens == nil {
+			return &Caller{err: &tokenError{errors.New("bearer tokens are not accepted")}}
+		}
+		claims, err := tokens.Verify(token, time.Now())
+		if err != nil {
+			return &Caller{err: &tokenError{err}}
+		}
+		return &Caller{Claims: claims, Scopes: claims.Scopes}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			caller := anonymous
+			if apiKey := r.Header.Get(APIKeyHeader); apiKey != "" {
+				caller = authenticate(r.Context(), apiKey)
+			} else if token, ok := bearerToken(r); ok {
+				caller = verify(token)
+			}
+
+			ctx := context.WithValue(r.Context(), CallerKey, caller)
+			if caller.APIKeyID != "" {
+				ctx = context.WithValue(ctx, APIKeyIDKey, caller.APIKeyID)
+			}
+			if caller.Claims != nil {
+				ctx = context.WithValue(ctx, ClaimsKey, caller.Claims)
+				if caller.Claims.Subject != "" {
+					ctx = context.WithValue(ctx, SubjectKey, caller.Claims.Subject)
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// bearerToken returns the token of an Authorization header using the Bearer
+// scheme, whose name is case-insensitive
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// RequireScopes creates a huma middleware that answers 401 or 403 unless the
+// caller has a scope the operation requires, as declared with Scope.
+// Operations without a security requirement are open to everyone.
+func RequireScopes(api huma.API) func(ctx huma.Context, next func(huma.Context)) {
+	return func(ctx huma.Context, next func(huma.Context)) {
+		var required []string
+		for _, requirement := range ctx.Operation().Security {
+			for _, scopes := range requirement {
+				for _, scope := range scopes {
+					if !slices.Contains(required, scope) {
+						required = append(required, scope)
+					}
+				}
+			}
+		}
+		if len(required) == 0 {
+			next(ctx)
+			return
+		}
+
+		caller := GetCaller(ctx.Context())
+		var tokenErr *tokenError
+		switch {
+		case caller == nil:
+			huma.WriteErr(api, ctx, http.StatusUnauthorized, "Authentication required")
+		case errors.Is(caller.err, errInvalidAPIKey):
+			huma.WriteErr(api, ctx, http.StatusUnauthorized, "Invalid or revoked API key")
+		case errors.As(caller.err, &tokenErr):
+			ctx.SetHeader("WWW-Authenticate", `Bearer error="invalid_token"`)
+			huma.WriteErr(api, ctx, http.StatusUnauthorized, "Invalid bearer token",
+				&huma.ErrorDetail{
+					Message:  tokenErr.err.Error(),
+					Location: "header.Authorization",
+				})
+		case caller.err != nil:
+			config.GetLoggerWithRequestID(ctx.Context()).Error("Failed to authenticate request", zap.Error(caller.err))
+			huma.WriteErr(api, ctx, http.StatusServiceUnavailable, "Authentication unavailable, please retry")
+		case slices.ContainsFunc(required, caller.HasScope):
+			next(ctx)
+		case caller.Anonymous():
+			huma.WriteErr(api, ctx, http.StatusUnauthorized, "API key or bearer token required",
+				&huma.ErrorDetail{
+					Message:  "send an API key or a bearer token with scope " + required[0],
+					Location: "header." + APIKeyHeader,
+				})
+		case caller.Claims != nil:
+			ctx.SetHeader("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+required[0]+`"`)
+			huma.WriteErr(api, ctx, http.StatusForbidden, "Bearer token lacks the required scope",
+				&huma.ErrorDetail{
+					Message:  "expected scope " + required[0],
+					Location: "header.Authorization",
+				})
+		default:
+			huma.WriteErr(api, ctx, http.StatusForbidden, "API key lacks the required scope",
+				&huma.ErrorDetail{
+					Message:  "expected scope " + required[0],
+					Location: "header." + APIKeyHeader,
+				})
+		}
+	}
+}
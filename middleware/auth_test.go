@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/adapters/humachi"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/seenthis-ab/content-api/config"
+	"github.com/seenthis-ab/content-api/models"
+)
+
+// failingKeyStore fails every API key lookup, as an unreachable database does
+type failingKeyStore struct{}
+
+func (failingKeyStore) GetAPIKey(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	return nil, errors.New("connection refused")
+}
+
+// TestAPIKeyLookupFailure checks that a failed API key lookup answers 503
+// and is logged with the ID of the request, together with the cause
+func TestAPIKeyLookupFailure(t *testing.T) {
+	previous := config.GetLogger()
+	core, logs := observer.New(zap.InfoLevel)
+	config.SetLogger(zap.New(core))
+	t.Cleanup(func() { config.SetLogger(previous) })
+
+	router := chi.NewMux()
+	router.Use(AuthMiddleware(failingKeyStore{}, &config.AuthConfig{}, nil))
+	router.Use(LoggingMiddleware(&config.AccessLogConfig{}))
+	api := humachi.New(router, huma.DefaultConfig("Content API", "1.0.0"))
+	api.UseMiddleware(RequireScopes(api))
+	huma.Get(api, "/content", func(ctx context.Context, input *struct{}) (*struct{}, error) {
+		return nil, nil
+	}, Scope(ScopeContentRead))
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/content", nil)
+	req.Header.Set(APIKeyHeader, "cak_unknown")
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got %d %s, want 503", recorder.Code, recorder.Body)
+	}
+
+	entries := logs.FilterMessage("Failed to authenticate request").AllUntimed()
+	if len(entries) != 1 {
+		t.Fatalf("got %d failure log entries, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if requestID := recorder.Header().Get("X-Request-Id"); requestID == "" || fields["request_id"] != requestID {
+		t.Errorf("logged request_id %v, want the response's %q", fields["request_id"], requestID)
+	}
+	if cause, _ := fields["error"].(string); cause != "authentication failed: failed to look up API key: connection refused" {
+		t.Errorf("logged error %q", cause)
+	}
+}
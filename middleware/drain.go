@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// Drainer tracks whether the server is shutting down. While it drains,
+// readiness fails and responses close their connections, so that load
+// balancers and keep-alive clients move to other instances while requests
+// are still being served.
+type Drainer struct {
+	draining atomic.Bool
+}
+
+// NewDrainer creates a Drainer for a server that is not shutting down
+func NewDrainer() *Drainer {
+	return &Drainer{}
+}
+
+// Start marks the server as shutting down
+func (d *Drainer) Start() {
+	d.draining.Store(true)
+}
+
+// Draining reports whether the server is shutting down
+func (d *Drainer) Draining() bool {
+	return d.draining.Load()
+}
+
+// Middleware creates a middleware that closes the connection after each
+// response once the server is draining
+func (d *Drainer) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if d.Draining() {
+				w.Header().Set("Connection", "close")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/MicahParks/keyfunc/v3"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+
+	"github.com/seenthis-ab/content-api/config"
+)
+
+// SecuritySchemeBearer names the bearer token security scheme in the OpenAPI document
+const SecuritySchemeBearer = "bearer"
+
+// ClaimsKey is the context key for storing the verified claims of a bearer token
+const ClaimsKey = "claims"
+
+// SubjectKey is the context key for storing the sub claim of a bearer token,
+// which loggers add to every line
+const SubjectKey = "subject"
+
+// minSecretLength is the shortest HS256 secret accepted, the size of the hash
+const minSecretLength = 32
+
+// jwksCheckInterval is how often the JWKS file is checked for changes
+const jwksCheckInterval = time.Second
+
+// tokenError is why a bearer token was rejected
+type tokenError struct {
+	err error
+}
+
+func (e *tokenError) Error() string {
+	return "invalid bearer token: " + e.err.Error()
+}
+
+// Claims are the verified claims of a bearer token
+type Claims struct {
+	Subject   string
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time // zero if the token has no nbf claim
+	Scopes    []string  // from the space separated scope claim or the scp claim
+	Raw       map[string]any
+}
+
+// GetClaims retrieves the claims of the bearer token that authenticated the
+// request from the context, or nil
+func GetClaims(ctx context.Context) *Claims {
+	claims, _ := ctx.Value(ClaimsKey).(*Claims)
+	return claims
+}
+
+// BearerSecurityScheme describes bearer token authentication for the OpenAPI document
+func BearerSecurityScheme() *huma.SecurityScheme {
+	return &huma.SecurityScheme{
+		Type:         "http",
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+		Description:  "JWT signed with HS256 using JWT_SECRET, or with RS256 or ES256 using a key in JWT_JWKS_FILE. Scopes are taken from the scope or scp claim.",
+	}
+}
+
+// TokenVerifier verifies JWT bearer tokens
+type TokenVerifier struct {
+	cfg     *config.JWTConfig
+	jwks    *jwksFile // nil without a JWKS file
+	methods []string  // signing algorithms accepted
+}
+
+// NewTokenVerifier creates a verifier for the configured secret and JWKS
+// file, failing if the secret is too short or the JWKS file cannot be loaded
+func NewTokenVerifier(cfg *config.JWTConfig) (*TokenVerifier, error) {
+	if len(cfg.Secret) > 0 && len(cfg.Secret) < minSecretLength {
+		return nil, fmt.Errorf("JWT_SECRET must be at least %d bytes", minSecretLength)
+	}
+
+	verifier := &TokenVerifier{cfg: cfg}
+	if len(cfg.Secret) > 0 {
+		verifier.methods = append(verifier.methods, jwt.SigningMethodHS256.Alg())
+	}
+	if cfg.JWKSFile != "" {
+		verifier.jwks = &jwksFile{path: cfg.JWKSFile}
+		if err := verifier.jwks.load(); err != nil {
+			return nil, err
+		}
+		verifier.methods = append(verifier.methods, jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg())
+	}
+	return verifier, nil
+}
+
+// Verify checks the signature and the exp, nbf, iss and aud claims of a
+// token at the given time and returns its claims
+func (v *TokenVerifier) Verify(token string, now time.Time) (*Claims, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(v.methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(v.cfg.Leeway),
+		jwt.WithTimeFunc(func() time.Time { return now }),
+		jwt.WithJSONNumber(),
+	}
+	if v.cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(v.cfg.Issuer))
+	}
+	if v.cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(v.cfg.Audience))
+	}
+
+	parsed, err := jwt.Parse(token, v.key, options...)
+	if err != nil {
+		return nil, err
+	}
+	return parseClaims(parsed.Claims.(jwt.MapClaims))
+}
+
+// key returns the key to check the signature of a token with: the secret for
+// HS256 and a JWKS key otherwise. The parser has already checked that the
+// algorithm is one of those accepted. Tokens with critical header parameters
+// are rejected, as none are understood.
+func (v *TokenVerifier) key(token *jwt.Token) (any, error) {
+	if _, ok := token.Header["crit"]; ok {
+		return nil, errors.New("token has critical header parameters, which are not supported")
+	}
+	if token.Method == jwt.SigningMethodHS256 {
+		return v.cfg.Secret, nil
+	}
+	return v.jwks.key(token)
+}
+
+// parseClaims extracts the registered claims and scopes from the claims of a
+// token, whose types the parser has already checked
+func parseClaims(raw jwt.MapClaims) (*Claims, error) {
+	claims := &Claims{Raw: raw}
+	claims.Subject, _ = raw.GetSubject()
+	claims.Issuer, _ = raw.GetIssuer()
+	claims.Audience, _ = raw.GetAudience()
+	if exp, _ := raw.GetExpirationTime(); exp != nil {
+		claims.ExpiresAt = exp.Time
+	}
+	if nbf, _ := raw.GetNotBefore(); nbf != nil {
+		claims.NotBefore = nbf.Time
+	}
+
+	// OAuth 2.0 puts scopes space separated in scope; some issuers use a scp list instead
+	if scope, ok := raw["scope"].(string); ok {
+		claims.Scopes = strings.Fields(scope)
+	} else if scp, err := stringList(raw["scp"]); err == nil {
+		claims.Scopes = scp
+	}
+
+	return claims, nil
+}
+
+// stringList converts a claim holding a string or a list of strings to a
+// list, nil if the claim is absent
+func stringList(value any) ([]string, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return strings.Fields(value), nil
+	case []any:
+		list := make([]string, len(value))
+		for i, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return nil, errors.New("not a string")
+			}
+			list[i] = s
+		}
+		return list, nil
+	}
+	return nil, errors.New("not a string or a list")
+}
+
+// jwksFile holds the keys of a JWKS file, reloading them when the file changes
+type jwksFile struct {
+	path string
+
+	mu      sync.Mutex
+	keys    keyfunc.Keyfunc
+	modTime time.Time
+	size    int64
+	checked time.Time
+}
+
+// key finds the key for a token by its kid, or tries every key if the token
+// names no kid. It first reloads the file if it has changed since it was last
+// checked.
+func (f *jwksFile) key(token *jwt.Token) (any, error) {
+	f.mu.Lock()
+	if time.Since(f.checked) >= jwksCheckInterval {
+		if err := f.reload(); err != nil {
+			config.GetLogger().Warn("Failed to reload JWKS file, keeping the previous keys",
+				zap.String("path", f.path),
+				zap.Error(err),
+			)
+		}
+	}
+	keys := f.keys
+	f.mu.Unlock()
+
+	return keys.Keyfunc(token)
+}
+
+// load reads the file for the first time
+func (f *jwksFile) load() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reload()
+}
+
+// reload reads the file again if its modification time or size changed.
+// The caller must hold f.mu.
+func (f *jwksFile) reload() error {
+	f.checked = time.Now()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+	keys, count, err := parseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("invalid JWKS file %s: %w", f.path, err)
+	}
+
+	f.keys = keys
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	config.GetLogger().Info("Loaded JWKS file",
+		zap.String("path", f.path),
+		zap.Int("keys", count),
+	)
+	return nil
+}
+
+// parseJWKS parses a JWKS document into a keyfunc that only uses keys meant
+// for signatures, and returns the number of keys. RSA keys must have at
+// least 2048 bits.
+func parseJWKS(data []byte) (keyfunc.Keyfunc, int, error) {
+	var set jwkset.JWKSMarshal
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, 0, err
+	}
+	storage, err := set.ToStorage()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	keys, err := storage.KeyReadAll(context.Background())
+	if err != nil {
+		return nil, 0, err
+	}
+	for i, key := range keys {
+		if rsaKey, ok := key.Key().(*rsa.PublicKey); ok && rsaKey.N.BitLen() < 2048 {
+			return nil, 0, fmt.Errorf("key %d (%q): RSA keys must have at least 2048 bits", i, key.Marshal().KID)
+		}
+	}
+
+	kf, err := keyfunc.New(keyfunc.Options{
+		Storage:      storage,
+		UseWhitelist: []jwkset.USE{jwkset.UseSig, ""},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return kf, len(keys), nil
+}
@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/seenthis-ab/content-api/config"
+)
+
+const (
+	testIssuer   = "https://auth.example.com"
+	testAudience = "content-api"
+	testKeyID    = "test-key"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// testVerifier returns a verifier accepting HS256 tokens signed with
+// testSecret and RS256 tokens signed with the returned key, which is in a
+// JWKS file under testKeyID
+func testVerifier(t *testing.T) (*TokenVerifier, *rsa.PrivateKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	jwk, err := jwkset.NewJWKFromKey(key.Public(), jwkset.JWKOptions{
+		Metadata: jwkset.JWKMetadataOptions{KID: testKeyID, USE: jwkset.UseSig},
+	})
+	if err != nil {
+		t.Fatalf("failed to create JWK: %v", err)
+	}
+	data, err := json.Marshal(jwkset.JWKSMarshal{Keys: []jwkset.JWKMarshal{jwk.Marshal()}})
+	if err != nil {
+		t.Fatalf("failed to marshal JWKS: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write JWKS file: %v", err)
+	}
+
+	verifier, err := NewTokenVerifier(&config.JWTConfig{
+		Secret:   testSecret,
+		JWKSFile: path,
+		Issuer:   testIssuer,
+		Audience: testAudience,
+		Leeway:   30 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewTokenVerifier: %v", err)
+	}
+	return verifier, key
+}
+
+// testClaims returns valid claims for a token issued at now
+func testClaims(now time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   "alice",
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"exp":   now.Add(time.Hour).Unix(),
+		"scope": "content:read content:write",
+	}
+}
+
+// signToken signs claims with the method and key, under testKeyID unless
+// the extra header parameters set kid to nil
+func signToken(t *testing.T, method jwt.SigningMethod, key any, claims jwt.MapClaims, header map[string]any) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = testKeyID
+	for name, value := range header {
+		if value == nil {
+			delete(token.Header, name)
+		} else {
+			token.Header[name] = value
+		}
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func TestVerify(t *testing.T) {
+	verifier, key := testVerifier(t)
+	now := time.Now()
+
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key: %v", err)
+	}
+
+	with := func(name string, value any) jwt.MapClaims {
+		claims := testClaims(now)
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error // nil for a valid token
+	}{
+		{"HS256", signToken(t, jwt.SigningMethodHS256, testSecret, testClaims(now), nil), nil},
+		{"RS256", signToken(t, jwt.SigningMethodRS256, key, testClaims(now), nil), nil},
+		{"RS256 without kid", signToken(t, jwt.SigningMethodRS256, key, testClaims(now), map[string]any{"kid": nil}), nil},
+		{"audience in a list", signToken(t, jwt.SigningMethodHS256, testSecret, with("aud", []string{"other", testAudience}), nil), nil},
+		{"expired within leeway", signToken(t, jwt.SigningMethodHS256, testSecret, with("exp", now.Add(-10*time.Second).Unix()), nil), nil},
+
+		{"HS256 signed with the RSA public key", signToken(t, jwt.SigningMethodHS256, publicKeyPEM, testClaims(now), nil), jwt.ErrTokenSignatureInvalid},
+		{"HS256 signed with the RSA public key as DER", signToken(t, jwt.SigningMethodHS256, publicKeyDER, testClaims(now), nil), jwt.ErrTokenSignatureInvalid},
+		{"alg none", signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, testClaims(now), nil), jwt.ErrTokenSignatureInvalid},
+		{"HS384", signToken(t, jwt.SigningMethodHS384, testSecret, testClaims(now), nil), jwt.ErrTokenSignatureInvalid},
+		{"ES256 under the kid of an RSA key", signToken(t, jwt.SigningMethodES256, otherKey, testClaims(now), nil), jwt.ErrTokenSignatureInvalid},
+		{"wrong secret", signToken(t, jwt.SigningMethodHS256, []byte("fedcba9876543210fedcba9876543210"), testClaims(now), nil), jwt.ErrTokenSignatureInvalid},
+		{"unknown crit", signToken(t, jwt.SigningMethodHS256, testSecret, testClaims(now), map[string]any{"crit": []string{"x-tenant"}, "x-tenant": "acme"}), jwt.ErrTokenUnverifiable},
+		{"expired", signToken(t, jwt.SigningMethodHS256, testSecret, with("exp", now.Add(-time.Minute).Unix()), nil), jwt.ErrTokenExpired},
+		{"no exp", signToken(t, jwt.SigningMethodHS256, testSecret, with("exp", nil), nil), jwt.ErrTokenRequiredClaimMissing},
+		{"exp not a number", signToken(t, jwt.SigningMethodHS256, testSecret, with("exp", "tomorrow"), nil), jwt.ErrInvalidType},
+		{"not valid yet", signToken(t, jwt.SigningMethodHS256, testSecret, with("nbf", now.Add(time.Minute).Unix()), nil), jwt.ErrTokenNotValidYet},
+		{"wrong audience", signToken(t, jwt.SigningMethodHS256, testSecret, with("aud", "other"), nil), jwt.ErrTokenInvalidAudience},
+		{"no audience", signToken(t, jwt.SigningMethodHS256, testSecret, with("aud", nil), nil), jwt.ErrTokenRequiredClaimMissing},
+		{"wrong issuer", signToken(t, jwt.SigningMethodHS256, testSecret, with("iss", "https://evil.example.com"), nil), jwt.ErrTokenInvalidIssuer},
+		{"no issuer", signToken(t, jwt.SigningMethodHS256, testSecret, with("iss", nil), nil), jwt.ErrTokenRequiredClaimMissing},
+		{"not a JWT", "not-a-token", jwt.ErrTokenMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(tt.token, now)
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("got error %v, want %v", err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("token was rejected: %v", err)
+			}
+			if claims.Subject != "alice" || len(claims.Scopes) != 2 {
+				t.Errorf("got subject %q and scopes %v", claims.Subject, claims.Scopes)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -56,8 +57,10 @@ func (w *ResponseTimeWriter) Write(data []byte) (int, error) {
 	return w.ResponseWriter.Write(data)
 }
 
-// LoggingMiddleware creates a middleware that logs HTTP requests and responses
-func LoggingMiddleware() func(http.Handler) http.Handler {
+// LoggingMiddleware creates a middleware that logs HTTP requests and
+// responses, except those to the configured skip paths, which still get a
+// request ID
+func LoggingMiddleware(cfg *config.AccessLogConfig) func(http.Handler) http.Handler {
 	logger := config.GetLogger()
 
 	return func(next http.Handler) http.Handler {
@@ -71,15 +74,34 @@ func LoggingMiddleware() func(http.Handler) http.Handler {
 			ctx := WithRequestID(r.Context(), requestID)
 			r = r.WithContext(ctx)
 
+			if slices.Contains(cfg.SkipPaths, r.URL.Path) {
+				w.Header().Set("X-Request-Id", requestID)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Identify the trace, if TracingMiddleware started one, and the API
+			// key or token subject, if AuthMiddleware found one
+			var keyFields []zap.Field
+			if traceID, ok := ctx.Value(TraceIDKey).(string); ok {
+				keyFields = append(keyFields, zap.String("trace_id", traceID))
+			}
+			if keyID, ok := ctx.Value(APIKeyIDKey).(string); ok {
+				keyFields = append(keyFields, zap.String("api_key_id", keyID))
+			}
+			if subject, ok := ctx.Value(SubjectKey).(string); ok {
+				keyFields = append(keyFields, zap.String("subject", subject))
+			}
+
 			// Log request details
-			logger.Info("HTTP request started",
+			logger.Info("HTTP request started", append([]zap.Field{
 				zap.String("method", r.Method),
 				zap.String("path", r.URL.Path),
 				zap.String("user_agent", r.UserAgent()),
 				zap.String("remote_addr", r.RemoteAddr),
 				zap.String("request_id", requestID),
 				zap.Time("timestamp", start),
-			)
+			}, keyFields...)...)
 
 			// Create a custom response writer to capture headers and status
 			responseWriter := &ResponseTimeWriter{
@@ -98,7 +120,7 @@ func LoggingMiddleware() func(http.Handler) http.Handler {
 			responseTime := float64(duration.Microseconds()) / 1000.0
 
 			// Log response details
-			logger.Info("HTTP request completed",
+			logger.Info("HTTP request completed", append([]zap.Field{
 				zap.String("method", r.Method),
 				zap.String("path", r.URL.Path),
 				zap.Int("status_code", responseWriter.statusCode),
@@ -106,7 +128,7 @@ func LoggingMiddleware() func(http.Handler) http.Handler {
 				zap.String("content_length", responseWriter.Header().Get("Content-Length")),
 				zap.String("request_id", requestID),
 				zap.Time("timestamp", time.Now()),
-			)
+			}, keyFields...)...)
 		})
 	}
 }
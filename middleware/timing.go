@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/seenthis-ab/content-api/timing"
+)
+
+// timingWriter holds back the status code until the body is written, so that
+// the Server-Timing header sent with it includes encoding the body
+type timingWriter struct {
+	http.ResponseWriter
+	timings     *timing.Timings
+	status      int
+	wroteHeader bool
+}
+
+// WriteHeader records the status code, writing informational ones at once
+func (w *timingWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	if statusCode >= 100 && statusCode < 200 {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	w.status = statusCode
+}
+
+// Write writes the headers, including Server-Timing, before the first write
+func (w *timingWriter) Write(data []byte) (int, error) {
+	w.writeHeader()
+	return w.ResponseWriter.Write(data)
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController
+func (w *timingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// writeHeader writes the Server-Timing header and the held back status code
+func (w *timingWriter) writeHeader() {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.Header().Set("Server-Timing", w.timings.Header())
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// ServerTimingMiddleware creates a middleware that reports how long each
+// request spent in the database (db), encoding the response body (encode)
+// and everything else (app) in a Server-Timing header. Database time is
+// collected by the stores' statement tracers and encoding time by the
+// formats returned by TimedFormats. It should be the first middleware so that
+// app covers the others.
+func ServerTimingMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, timings := timing.NewContext(r.Context())
+			writer := &timingWriter{ResponseWriter: w, timings: timings}
+
+			next.ServeHTTP(writer, r.WithContext(ctx))
+
+			// Responses without a body are sent once the handler returns
+			writer.writeHeader()
+		})
+	}
+}
+
+// timedBody is the body writer of a request, carrying its timings to the
+// formats' Marshal functions, which are not given the request context
+type timedBody struct {
+	io.Writer
+	timings *timing.Timings
+}
+
+// humaContext is huma.Context under a name that can be embedded without
+// clashing with its Context method
+type humaContext huma.Context
+
+// timedBodyContext replaces the body writer of a huma context
+type timedBodyContext struct {
+	humaContext
+	body *timedBody
+}
+
+// BodyWriter returns the body writer carrying the timings
+func (c *timedBodyContext) BodyWriter() io.Writer {
+	return c.body
+}
+
+// Unwrap returns the wrapped huma context
+func (c *timedBodyContext) Unwrap() huma.Context {
+	return c.humaContext
+}
+
+// TimeEncoding is a huma middleware that makes the timings of a request
+// available to the formats returned by TimedFormats
+func TimeEncoding(ctx huma.Context, next func(huma.Context)) {
+	timings := timing.FromContext(ctx.Context())
+	if timings == nil {
+		next(ctx)
+		return
+	}
+	next(&timedBodyContext{humaContext: ctx, body: &timedBody{Writer: ctx.BodyWriter(), timings: timings}})
+}
+
+// TimedFormats wraps the Marshal function of each format to add the time
+// spent encoding response bodies to the encode phase of Server-Timing. Bodies
+// are encoded into a buffer and then written at once, so that the timing is
+// known before the headers are sent.
+func TimedFormats(formats map[string]huma.Format) map[string]huma.Format {
+	timed := make(map[string]huma.Format, len(formats))
+	for contentType, format := range formats {
+		marshal := format.Marshal
+		if marshal == nil {
+			timed[contentType] = format
+			continue
+		}
+		format.Marshal = func(w io.Writer, v any) error {
+			body, ok := w.(*timedBody)
+			if !ok {
+				return marshal(w, v)
+			}
+
+			start := time.Now()
+			var buf bytes.Buffer
+			err := marshal(&buf, v)
+			body.timings.AddEncode(time.Since(start))
+			if err != nil {
+				return err
+			}
+			_, err = body.Write(buf.Bytes())
+			return err
+		}
+		timed[contentType] = format
+	}
+	return timed
+}
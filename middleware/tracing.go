@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceIDKey is the context key for storing the trace ID, for logging
+const TraceIDKey = "trace_id"
+
+// tracer starts the operation spans, from the global tracer provider
+var tracer = otel.Tracer("github.com/seenthis-ab/content-api/middleware")
+
+// TracingMiddleware creates a middleware that records a server span for every
+// request with otelhttp, continuing the trace of a W3C traceparent header if
+// the request has a valid one. The trace ID is added to the context for
+// logging and the span is returned in a traceresponse header, so that
+// clients can look up the trace of any response.
+func TracingMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			spanContext := trace.SpanContextFromContext(r.Context())
+			ctx := context.WithValue(r.Context(), TraceIDKey, spanContext.TraceID().String())
+			w.Header().Set("traceresponse",
+				"00-"+spanContext.TraceID().String()+"-"+spanContext.SpanID().String()+"-"+spanContext.TraceFlags().String())
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+
+		// Named after the method until TraceOperations knows the route
+		return otelhttp.NewHandler(handler, "",
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+				return r.Method
+			}),
+		)
+	}
+}
+
+// TraceOperations is a huma middleware that names the server span of a
+// request after its route and records the operation as a child span, under
+// which the spans of the statements its handler runs are grouped
+func TraceOperations(ctx huma.Context, next func(huma.Context)) {
+	operation := ctx.Operation()
+
+	server := trace.SpanFromContext(ctx.Context())
+	server.SetName(operation.Method + " " + operation.Path)
+	server.SetAttributes(
+		semconv.HTTPRoute(operation.Path),
+		attribute.String("request_id", GetRequestID(ctx.Context())),
+	)
+
+	spanCtx, span := tracer.Start(ctx.Context(), operation.OperationID)
+	defer span.End()
+
+	next(huma.WithContext(ctx, spanCtx))
+
+	if ctx.Status() >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(ctx.Status()))
+	}
+}
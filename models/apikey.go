@@ -0,0 +1,46 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// APIKeyPrefix starts every API key, which makes keys recognizable in
+// configuration files and secret scanners
+const APIKeyPrefix = "cak_"
+
+// APIKey is a credential for the X-API-Key header. Only the hash of the key
+// is stored, so a lost key cannot be recovered, only revoked and replaced.
+type APIKey struct {
+	ID        string
+	Name      string
+	KeyHash   string
+	Scopes    []string
+	CreatedAt time.Time
+	RevokedAt *time.Time
+}
+
+// NewAPIKey mints an API key with the given name and scopes. It returns the
+// record to store and the key to hand to its user, which is not stored.
+func NewAPIKey(name string, scopes []string) (*APIKey, string) {
+	key := APIKeyPrefix + strings.ToLower(rand.Text())
+	return &APIKey{
+		ID:        strings.ToLower(ulid.Make().String()),
+		Name:      name,
+		KeyHash:   HashAPIKey(key),
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}, key
+}
+
+// HashAPIKey returns the hash under which an API key is stored. Keys are
+// random with 130 bits of entropy, so a fast hash suffices.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,55 @@
+package models
+
+// MaxBulkItems is the largest number of items a single bulk request may hold
+const MaxBulkItems = 1000
+
+// BulkResult is the outcome of one item of a batch write
+type BulkResult struct {
+	ID      string
+	Content *Content // the content as written; nil for deletes and failures
+	Err     error    // ErrNotFound, ErrVersionConflict or the error returned by mutate
+}
+
+// applyMutation runs mutate on a copy of content, so that a failing mutation
+// leaves the original untouched, and returns the mutated copy
+func applyMutation(content *Content, mutate func(*Content) error) (*Content, error) {
+	candidate := cloneContent(content)
+	if err := mutate(candidate); err != nil {
+		return nil, err
+	}
+	// The identity and version of a record are not the mutation's to change
+	candidate.ID = content.ID
+	candidate.Version = content.Version
+	candidate.CreatedAt = content.CreatedAt
+	return candidate, nil
+}
+
+// deleteResults reports each requested ID as deleted if it is among the
+// deleted IDs, and as ErrNotFound otherwise. An ID requested more than once
+// is only reported as deleted the first time.
+func deleteResults(ids []string, deleted []string) []BulkResult {
+	remaining := make(map[string]bool, len(deleted))
+	for _, id := range deleted {
+		remaining[id] = true
+	}
+
+	results := make([]BulkResult, len(ids))
+	for i, id := range ids {
+		results[i].ID = id
+		if remaining[id] {
+			delete(remaining, id)
+		} else {
+			results[i].Err = ErrNotFound
+		}
+	}
+	return results
+}
+
+// expectedVersion returns the version the item at index i of a batch must
+// have, or zero if it may have any
+func expectedVersion(expectedVersions []int, i int) int {
+	if expectedVersions == nil {
+		return 0
+	}
+	return expectedVersions[i]
+}
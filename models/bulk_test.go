@@ -0,0 +1,43 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// TestDeleteManyExpectedVersions checks that DeleteMany leaves items whose
+// version changed alone, telling them apart from missing ones
+func TestDeleteManyExpectedVersions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store ContentStore) {
+		ctx := context.Background()
+		current := createTestContent(t, store, nil)
+		changed := createTestContent(t, store, nil)
+		unconditional := createTestContent(t, store, nil)
+		if err := store.Update(ctx, changed); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+
+		ids := []string{current.ID, changed.ID, unconditional.ID, "missing"}
+		results, err := store.DeleteMany(ctx, ids, []int{1, 1, 0, 1})
+		if err != nil {
+			t.Fatalf("DeleteMany: %v", err)
+		}
+
+		want := []error{nil, ErrVersionConflict, nil, ErrNotFound}
+		for i, result := range results {
+			if result.ID != ids[i] || !errors.Is(result.Err, want[i]) || (want[i] == nil && result.Err != nil) {
+				t.Errorf("result %d = %s %v, want %s %v", i, result.ID, result.Err, ids[i], want[i])
+			}
+		}
+
+		if _, err := store.GetByID(ctx, changed.ID); err != nil {
+			t.Errorf("GetByID(changed) = %v, want it left alone", err)
+		}
+		for _, id := range []string{current.ID, unconditional.ID} {
+			if _, err := store.GetByID(ctx, id); !errors.Is(err, ErrNotFound) {
+				t.Errorf("GetByID(%s) = %v, want ErrNotFound", id, err)
+			}
+		}
+	})
+}
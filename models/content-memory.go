@@ -0,0 +1,786 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryShardCount is the number of independently locked partitions of the
+// in-memory store. Requests for different IDs rarely contend on the same lock.
+const memoryShardCount = 32
+
+type memoryShard struct {
+	mu        sync.RWMutex
+	items     map[string]*Content
+	revisions map[string][]*Revision
+}
+
+// put stores content and records the write as a revision
+func (s *memoryShard) put(content *Content, operation RevisionOperation) {
+	s.items[content.ID] = content
+	s.record(content, operation, content.UpdatedAt)
+}
+
+// live returns the content with the given ID unless it is missing or in
+// the trash
+func (s *memoryShard) live(id string) (*Content, bool) {
+	content, ok := s.items[id]
+	if !ok || content.DeletedAt != nil {
+		return nil, false
+	}
+	return content, true
+}
+
+// trash moves content to the trash and records the deletion as a revision
+func (s *memoryShard) trash(id string, now time.Time) {
+	content := cloneContent(s.items[id])
+	content.DeletedAt = &now
+	content.UpdatedAt = now
+	content.Version++
+	s.put(content, RevisionDelete)
+}
+
+// record appends a revision capturing content to its history
+func (s *memoryShard) record(content *Content, operation RevisionOperation, recordedAt time.Time) {
+	revisions := s.revisions[content.ID]
+	s.revisions[content.ID] = append(revisions, newRevision(content, len(revisions)+1, operation, recordedAt))
+}
+
+// MemoryContentStore keeps content in process memory. It is intended for
+// benchmarking the HTTP layer without a database and for tests.
+type MemoryContentStore struct {
+	shards [memoryShardCount]*memoryShard
+	locks  sync.Map // name -> *sync.Mutex for RunExclusive
+
+	keysMu sync.Mutex
+	keys   map[idempotencyKeyID]*IdempotencyKey
+
+	apiKeysMu sync.Mutex
+	apiKeys   []*APIKey // oldest first
+}
+
+// NewMemoryContentStore creates a new, empty MemoryContentStore instance
+func NewMemoryContentStore() *MemoryContentStore {
+	cs := &MemoryContentStore{keys: make(map[idempotencyKeyID]*IdempotencyKey)}
+	for i := range cs.shards {
+		cs.shards[i] = &memoryShard{
+			items:     make(map[string]*Content),
+			revisions: make(map[string][]*Revision),
+		}
+	}
+	return cs
+}
+
+// shard returns the partition responsible for the given ID
+func (cs *MemoryContentStore) shard(id string) *memoryShard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return cs.shards[h.Sum32()%memoryShardCount]
+}
+
+// lockShards write-locks the partitions responsible for the given IDs, in a
+// fixed order so that concurrent batches cannot deadlock, and returns a
+// function that unlocks them again
+func (cs *MemoryContentStore) lockShards(ids []string) func() {
+	var locked [memoryShardCount]bool
+	for _, id := range ids {
+		h := fnv.New32a()
+		h.Write([]byte(id))
+		locked[h.Sum32()%memoryShardCount] = true
+	}
+	for i, s := range cs.shards {
+		if locked[i] {
+			s.mu.Lock()
+		}
+	}
+	return func() {
+		for i, s := range cs.shards {
+			if locked[i] {
+				s.mu.Unlock()
+			}
+		}
+	}
+}
+
+// Close is a no-op for the in-memory store
+func (cs *MemoryContentStore) Close() error {
+	return nil
+}
+
+// Ping always succeeds for the in-memory store
+func (cs *MemoryContentStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// MigrationVersion reports the in-memory store as up to date, as it has no
+// schema to migrate
+func (cs *MemoryContentStore) MigrationVersion(ctx context.Context) (int, bool, error) {
+	return LatestMigration, false, nil
+}
+
+// Create inserts a new content record
+func (cs *MemoryContentStore) Create(ctx context.Context, content *Content) error {
+	if err := ctx.Err(); err != nil {
+		return wrapError(ctx, "failed to create content", err)
+	}
+
+	s := cs.shard(content.ID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A rejected create leaves the content untouched, as in the SQL stores
+	if _, exists := s.items[content.ID]; exists {
+		return fmt.Errorf("failed to create content: %w", &ConstraintError{
+			Kind:       ConstraintUnique,
+			Constraint: "content.id",
+			Err:        fmt.Errorf("content %s already exists", content.ID),
+		})
+	}
+
+	now := time.Now()
+	content.CreatedAt = now
+	content.UpdatedAt = now
+	content.Version = 1
+	s.put(cloneContent(content), RevisionCreate)
+
+	return nil
+}
+
+// CreateMany inserts several content records at once. Either all of them are
+// created or, if any ID is already taken, none.
+func (cs *MemoryContentStore) CreateMany(ctx context.Context, contents []*Content) error {
+	if err := ctx.Err(); err != nil {
+		return wrapError(ctx, "failed to create content", err)
+	}
+
+	ids := make([]string, len(contents))
+	for i, content := range contents {
+		ids[i] = content.ID
+	}
+	unlock := cs.lockShards(ids)
+	defer unlock()
+
+	seen := make(map[string]bool, len(contents))
+	for _, content := range contents {
+		if _, exists := cs.shard(content.ID).items[content.ID]; exists || seen[content.ID] {
+			return fmt.Errorf("failed to create content: %w", &ConstraintError{
+				Kind:       ConstraintUnique,
+				Constraint: "content.id",
+				Err:        fmt.Errorf("content %s already exists", content.ID),
+			})
+		}
+		seen[content.ID] = true
+	}
+
+	now := time.Now()
+	for _, content := range contents {
+		content.CreatedAt = now
+		content.UpdatedAt = now
+		content.Version = 1
+		cs.shard(content.ID).put(cloneContent(content), RevisionCreate)
+	}
+
+	return nil
+}
+
+// GetByID retrieves content by ID
+func (cs *MemoryContentStore) GetByID(ctx context.Context, id string) (*Content, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapError(ctx, "failed to get content", err)
+	}
+
+	s := cs.shard(id)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	content, ok := s.live(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return cloneContent(content), nil
+}
+
+// List retrieves a page of content records matching the filters in opts
+func (cs *MemoryContentStore) List(ctx context.Context, opts ListOptions) (*ContentPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapError(ctx, "failed to query content", err)
+	}
+
+	sort := opts.sort()
+
+	var contents []*Content
+	for _, s := range cs.shards {
+		s.mu.RLock()
+		for _, content := range s.items {
+			if matchesListOptions(content, opts) {
+				contents = append(contents, content)
+			}
+		}
+		s.mu.RUnlock()
+	}
+
+	slices.SortFunc(contents, func(a, b *Content) int {
+		return compareBySort(sort, a, sort.key(b), b.ID)
+	})
+
+	limit := opts.limit()
+	if len(contents) > limit+1 {
+		contents = contents[:limit+1]
+	}
+	for i, content := range contents {
+		contents[i] = cloneContent(content)
+	}
+
+	return newContentPage(contents, opts), nil
+}
+
+// matchesListOptions reports whether content passes the filters in opts and
+// comes after the cursor, if any
+func matchesListOptions(content *Content, opts ListOptions) bool {
+	switch {
+	case opts.Deleted != (content.DeletedAt != nil):
+		return false
+	case opts.Status != "" && content.Status != opts.Status:
+		return false
+	case opts.Author != "" && content.Author != opts.Author:
+		return false
+	case opts.CreatedAfter != nil && !content.CreatedAt.After(*opts.CreatedAfter):
+		return false
+	case opts.CreatedBefore != nil && !content.CreatedAt.Before(*opts.CreatedBefore):
+		return false
+	case opts.UpdatedSince != nil && content.UpdatedAt.Before(*opts.UpdatedSince):
+		return false
+	case opts.VisibleAt != nil && !visibleAt(content, *opts.VisibleAt):
+		return false
+	case !matchesDataFilters(content, opts.DataFilters):
+		return false
+	case opts.Access != nil && !opts.Access.matches(content):
+		return false
+	case opts.After != nil && compareBySort(opts.sort(), content, opts.After.Key, opts.After.ID) <= 0:
+		return false
+	}
+	return true
+}
+
+// matchesDataFilters reports whether the content data satisfies every filter
+func matchesDataFilters(content *Content, filters []DataFilter) bool {
+	for _, filter := range filters {
+		if !filter.matches(content.Data) {
+			return false
+		}
+	}
+	return true
+}
+
+// compareBySort orders content relative to the row with the given sort key and
+// id, returning a negative number if content comes first in list order
+func compareBySort(sort Sort, content *Content, key interface{}, id string) int {
+	var c int
+	switch k := sort.key(content).(type) {
+	case time.Time:
+		c = k.Compare(key.(time.Time))
+	case string:
+		c = strings.Compare(k, key.(string))
+	}
+	if c == 0 {
+		c = strings.Compare(content.ID, id)
+	}
+	if sort.Desc {
+		return -c
+	}
+	return c
+}
+
+// Search finds content whose title or body contains every word of the query,
+// best matches first. It scans every record and is meant for small data sets.
+func (cs *MemoryContentStore) Search(ctx context.Context, opts SearchOptions) ([]*SearchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapError(ctx, "failed to search content", err)
+	}
+
+	terms := searchTerms(opts.Query)
+	results := []*SearchResult{}
+	if len(terms) == 0 {
+		return results, nil
+	}
+
+	for _, s := range cs.shards {
+		s.mu.RLock()
+		for _, content := range s.items {
+			if content.DeletedAt != nil || (opts.Access != nil && !opts.Access.matches(content)) {
+				continue
+			}
+			if result, ok := matchSearch(content, terms); ok {
+				result.Content = cloneContent(content)
+				results = append(results, result)
+			}
+		}
+		s.mu.RUnlock()
+	}
+
+	slices.SortFunc(results, func(a, b *SearchResult) int {
+		if a.Rank != b.Rank {
+			if a.Rank > b.Rank {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(b.Content.ID, a.Content.ID)
+	})
+
+	if len(results) > opts.limit() {
+		results = results[:opts.limit()]
+	}
+
+	return results, nil
+}
+
+// Update updates an existing content record if its stored version still
+// equals content.Version, and increments the version on success
+func (cs *MemoryContentStore) Update(ctx context.Context, content *Content) error {
+	if err := ctx.Err(); err != nil {
+		return wrapError(ctx, "failed to update content", err)
+	}
+
+	s := cs.shard(content.ID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.live(content.ID)
+	if !ok {
+		return ErrNotFound
+	}
+
+	if existing.Version != content.Version {
+		return ErrVersionConflict
+	}
+
+	content.CreatedAt = existing.CreatedAt
+	content.UpdatedAt = time.Now()
+	content.Version++
+	s.put(cloneContent(content), RevisionUpdate)
+
+	return nil
+}
+
+// Delete moves a content record to the trash. If expectedVersion is non-zero
+// the record is only deleted while its version still matches.
+func (cs *MemoryContentStore) Delete(ctx context.Context, id string, expectedVersion int) error {
+	if err := ctx.Err(); err != nil {
+		return wrapError(ctx, "failed to delete content", err)
+	}
+
+	s := cs.shard(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.live(id)
+	if !ok {
+		return ErrNotFound
+	}
+	if expectedVersion != 0 && existing.Version != expectedVersion {
+		return ErrVersionConflict
+	}
+	s.trash(id, time.Now())
+
+	return nil
+}
+
+// Undelete restores a content record from the trash
+func (cs *MemoryContentStore) Undelete(ctx context.Context, id string) (*Content, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapError(ctx, "failed to undelete content", err)
+	}
+
+	s := cs.shard(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.items[id]
+	if !ok || existing.DeletedAt == nil {
+		return nil, ErrNotFound
+	}
+
+	content := cloneContent(existing)
+	content.DeletedAt = nil
+	content.UpdatedAt = time.Now()
+	content.Version++
+	s.put(content, RevisionUndelete)
+
+	return cloneContent(content), nil
+}
+
+// Purge permanently removes content deleted before the given time, along
+// with its revisions
+func (cs *MemoryContentStore) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, wrapError(ctx, "failed to purge content", err)
+	}
+
+	purged := 0
+	for _, s := range cs.shards {
+		s.mu.Lock()
+		for id, content := range s.items {
+			if content.DeletedAt != nil && content.DeletedAt.Before(deletedBefore) {
+				delete(s.items, id)
+				delete(s.revisions, id)
+				purged++
+			}
+		}
+		s.mu.Unlock()
+	}
+
+	return purged, nil
+}
+
+// UpdateMany applies mutate to each record with the given IDs and stores the
+// results, holding the locks of all affected partitions throughout
+func (cs *MemoryContentStore) UpdateMany(ctx context.Context, ids []string, mutate func(*Content) error) ([]BulkResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapError(ctx, "failed to update content", err)
+	}
+
+	unlock := cs.lockShards(ids)
+	defer unlock()
+
+	now := time.Now()
+	results := make([]BulkResult, len(ids))
+	for i, id := range ids {
+		results[i].ID = id
+
+		s := cs.shard(id)
+		existing, ok := s.live(id)
+		if !ok {
+			results[i].Err = ErrNotFound
+			continue
+		}
+
+		content, err := applyMutation(existing, mutate)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		content.UpdatedAt = now
+		content.Version++
+		// mutate may have kept the pointer it was given
+		s.put(cloneContent(content), RevisionUpdate)
+		results[i].Content = content
+	}
+
+	return results, nil
+}
+
+// DeleteMany moves the records with the given IDs to the trash
+func (cs *MemoryContentStore) DeleteMany(ctx context.Context, ids []string, expectedVersions []int) ([]BulkResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapError(ctx, "failed to delete content", err)
+	}
+
+	unlock := cs.lockShards(ids)
+	defer unlock()
+
+	now := time.Now()
+	results := make([]BulkResult, len(ids))
+	for i, id := range ids {
+		results[i].ID = id
+		s := cs.shard(id)
+		existing, ok := s.live(id)
+		version := expectedVersion(expectedVersions, i)
+		switch {
+		case !ok:
+			results[i].Err = ErrNotFound
+		case version != 0 && existing.Version != version:
+			results[i].Err = ErrVersionConflict
+		default:
+			s.trash(id, now)
+		}
+	}
+
+	return results, nil
+}
+
+// ListScheduled returns the IDs of content whose scheduled publication or
+// expiry is due, oldest first, at most limit of them
+func (cs *MemoryContentStore) ListScheduled(ctx context.Context, due time.Time, limit int) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapError(ctx, "failed to list scheduled content", err)
+	}
+
+	var ids []string
+	for _, s := range cs.shards {
+		s.mu.RLock()
+		for id, content := range s.items {
+			if content.DeletedAt == nil && scheduleDue(content, due) {
+				ids = append(ids, id)
+			}
+		}
+		s.mu.RUnlock()
+	}
+
+	slices.Sort(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	return ids, nil
+}
+
+// RunExclusive runs fn unless another caller of this store is running under
+// the same name
+func (cs *MemoryContentStore) RunExclusive(ctx context.Context, name string, fn func(context.Context) error) (bool, error) {
+	value, _ := cs.locks.LoadOrStore(name, &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	if !mu.TryLock() {
+		return false, nil
+	}
+	defer mu.Unlock()
+
+	return true, fn(ctx)
+}
+
+// CreateIdempotent inserts a new content record and saves the idempotency key
+// that created it. Requests with idempotency keys are serialized, so that the
+// key and the content are stored together.
+func (cs *MemoryContentStore) CreateIdempotent(ctx context.Context, content *Content, key *IdempotencyKey) error {
+	cs.keysMu.Lock()
+	defer cs.keysMu.Unlock()
+
+	id := idempotencyKeyID{caller: key.Caller, key: key.Key}
+	if existing, ok := cs.keys[id]; ok && existing.ExpiresAt.After(time.Now()) {
+		return errIdempotencyKeyExists(key.Key)
+	}
+
+	if err := cs.Create(ctx, content); err != nil {
+		return err
+	}
+	if err := key.complete(content); err != nil {
+		return err
+	}
+
+	saved := *key
+	cs.keys[id] = &saved
+	return nil
+}
+
+// GetIdempotencyKey retrieves a live idempotency key sent by the caller
+func (cs *MemoryContentStore) GetIdempotencyKey(ctx context.Context, caller, key string) (*IdempotencyKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapError(ctx, "failed to get idempotency key", err)
+	}
+
+	cs.keysMu.Lock()
+	defer cs.keysMu.Unlock()
+
+	existing, ok := cs.keys[idempotencyKeyID{caller: caller, key: key}]
+	if !ok || !existing.ExpiresAt.After(time.Now()) {
+		return nil, ErrNotFound
+	}
+
+	k := *existing
+	return &k, nil
+}
+
+// PurgeIdempotencyKeys removes idempotency keys that expired before the given time
+func (cs *MemoryContentStore) PurgeIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, wrapError(ctx, "failed to purge idempotency keys", err)
+	}
+
+	cs.keysMu.Lock()
+	defer cs.keysMu.Unlock()
+
+	purged := 0
+	for id, key := range cs.keys {
+		if key.ExpiresAt.Before(expiredBefore) {
+			delete(cs.keys, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// CreateAPIKey stores a minted API key. Keys of the in-memory store only live
+// as long as the process.
+func (cs *MemoryContentStore) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	if err := ctx.Err(); err != nil {
+		return wrapError(ctx, "failed to create API key", err)
+	}
+
+	cs.apiKeysMu.Lock()
+	defer cs.apiKeysMu.Unlock()
+
+	for _, existing := range cs.apiKeys {
+		if existing.ID == key.ID || existing.KeyHash == key.KeyHash {
+			return fmt.Errorf("failed to create API key: %w", &ConstraintError{
+				Kind:       ConstraintUnique,
+				Constraint: "api_keys.id",
+				Err:        fmt.Errorf("API key %s already exists", key.ID),
+			})
+		}
+	}
+	cs.apiKeys = append(cs.apiKeys, cloneAPIKey(key))
+	return nil
+}
+
+// GetAPIKey retrieves the unrevoked API key with the given hash
+func (cs *MemoryContentStore) GetAPIKey(ctx context.Context, keyHash string) (*APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapError(ctx, "failed to get API key", err)
+	}
+
+	cs.apiKeysMu.Lock()
+	defer cs.apiKeysMu.Unlock()
+
+	for _, key := range cs.apiKeys {
+		if key.KeyHash == keyHash && key.RevokedAt == nil {
+			return cloneAPIKey(key), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ListAPIKeys returns all API keys including revoked ones, newest first
+func (cs *MemoryContentStore) ListAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapError(ctx, "failed to list API keys", err)
+	}
+
+	cs.apiKeysMu.Lock()
+	defer cs.apiKeysMu.Unlock()
+
+	keys := make([]*APIKey, len(cs.apiKeys))
+	for i, key := range cs.apiKeys {
+		keys[len(keys)-1-i] = cloneAPIKey(key)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes the API key with the given ID
+func (cs *MemoryContentStore) RevokeAPIKey(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return wrapError(ctx, "failed to revoke API key", err)
+	}
+
+	cs.apiKeysMu.Lock()
+	defer cs.apiKeysMu.Unlock()
+
+	for _, key := range cs.apiKeys {
+		if key.ID == id && key.RevokedAt == nil {
+			now := time.Now()
+			key.RevokedAt = &now
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// ListRevisions returns the revisions of the content with the given ID,
+// oldest first
+func (cs *MemoryContentStore) ListRevisions(ctx context.Context, id string) ([]*Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapError(ctx, "failed to list revisions", err)
+	}
+
+	s := cs.shard(id)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revisions, ok := s.revisions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	clones := make([]*Revision, len(revisions))
+	for i, revision := range revisions {
+		clones[i] = cloneRevision(revision)
+	}
+	return clones, nil
+}
+
+// GetRevision returns a single revision of the content with the given ID
+func (cs *MemoryContentStore) GetRevision(ctx context.Context, id string, revision int) (*Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapError(ctx, "failed to get revision", err)
+	}
+
+	s := cs.shard(id)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revisions := s.revisions[id]
+	if revision < 1 || revision > len(revisions) {
+		return nil, ErrNotFound
+	}
+	return cloneRevision(revisions[revision-1]), nil
+}
+
+// cloneRevision returns a deep copy of revision
+func cloneRevision(revision *Revision) *Revision {
+	clone := *revision
+	clone.Data = cloneData(revision.Data)
+	return &clone
+}
+
+// cloneAPIKey returns a copy of key that shares no memory with it
+func cloneAPIKey(key *APIKey) *APIKey {
+	clone := *key
+	clone.Scopes = slices.Clone(key.Scopes)
+	clone.RevokedAt = clonePointer(key.RevokedAt)
+	return &clone
+}
+
+// cloneContent returns a deep copy of content so that callers never share
+// mutable state (in particular the Data map) with the store
+func cloneContent(content *Content) *Content {
+	clone := *content
+	clone.Data = cloneData(content.Data)
+	clone.PublishAt = clonePointer(content.PublishAt)
+	clone.ExpireAt = clonePointer(content.ExpireAt)
+	clone.PublishedAt = clonePointer(content.PublishedAt)
+	clone.PublishedBy = clonePointer(content.PublishedBy)
+	clone.DeletedAt = clonePointer(content.DeletedAt)
+	return &clone
+}
+
+// clonePointer returns a pointer to a copy of the value p points to, or nil
+func clonePointer[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+// cloneData deep copies a Data map, which may be nil
+func cloneData(data map[string]interface{}) map[string]interface{} {
+	if data == nil {
+		return nil
+	}
+	return cloneValue(data).(map[string]interface{})
+}
+
+// cloneValue deep copies a decoded JSON value
+func cloneValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		clone := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			clone[key] = cloneValue(item)
+		}
+		return clone
+	case []interface{}:
+		clone := make([]interface{}, len(v))
+		for i, item := range v {
+			clone[i] = cloneValue(item)
+		}
+		return clone
+	default:
+		return v
+	}
+}
@@ -3,13 +3,59 @@ package models
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/exaring/otelpgx"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/multitracer"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/seenthis-ab/content-api/timing"
 )
 
+// postgresConstraintKinds maps Postgres integrity constraint violation codes
+var postgresConstraintKinds = map[string]ConstraintKind{
+	"23505": ConstraintUnique,
+	"23502": ConstraintNotNull,
+	"23514": ConstraintCheck,
+	"23503": ConstraintForeignKey,
+}
+
+// postgresError classifies pgx errors as a ConstraintError or ErrUnavailable,
+// returning nil for any other error
+func postgresError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		if kind, ok := postgresConstraintKinds[pgErr.Code]; ok {
+			constraint := pgErr.ConstraintName
+			if constraint == "" {
+				constraint = pgErr.ColumnName
+			}
+			return &ConstraintError{Kind: kind, Constraint: constraint, Err: err}
+		}
+		// Class 08 connection exception, 53 insufficient resources, 57P0x
+		// server shutting down or starting up, 40001/40P01 serialization
+		// failure and deadlock, which succeed on retry
+		switch {
+		case strings.HasPrefix(pgErr.Code, "08"),
+			strings.HasPrefix(pgErr.Code, "53"),
+			strings.HasPrefix(pgErr.Code, "57P0"),
+			pgErr.Code == "40001", pgErr.Code == "40P01":
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+		return nil
+	}
+
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) || pgconn.SafeToRetry(err) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return nil
+}
+
 type PostgresContentStore struct {
 	pool *pgxpool.Pool
 }
@@ -31,6 +77,10 @@ func NewPostgresContentStoreWithConfig(connString string, maxConns, minConns int
 	config.MaxConnIdleTime = 30 * time.Minute // Maximum idle time of a connection
 	config.HealthCheckPeriod = time.Minute    // How often to check connection health
 
+	// Time statements run during requests for Server-Timing and, if the
+	// request is traced, record them as spans
+	config.ConnConfig.Tracer = multitracer.New(otelpgx.NewTracer(), timing.PgxTracer{})
+
 	// Create the pool with configured settings
 	pool, err := pgxpool.NewWithConfig(context.Background(), config)
 	if err != nil {
@@ -51,52 +101,139 @@ func (cs *PostgresContentStore) Close() error {
 	return nil
 }
 
+// Ping checks that the database can be reached
+func (cs *PostgresContentStore) Ping(ctx context.Context) error {
+	if err := cs.pool.Ping(ctx); err != nil {
+		return wrapError(ctx, "failed to ping database", err)
+	}
+	return nil
+}
+
+// MigrationVersion returns the migration version recorded by golang-migrate
+func (cs *PostgresContentStore) MigrationVersion(ctx context.Context) (int, bool, error) {
+	var version int
+	var dirty bool
+	err := cs.pool.QueryRow(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, wrapError(ctx, "failed to get migration version", err)
+	}
+	return version, dirty, nil
+}
+
+// PoolStat returns statistics of the connection pool, for metrics
+func (cs *PostgresContentStore) PoolStat() *pgxpool.Stat {
+	return cs.pool.Stat()
+}
+
 // Create inserts a new content record
-func (cs *PostgresContentStore) Create(content *Content) error {
+func (cs *PostgresContentStore) Create(ctx context.Context, content *Content) error {
+	return insertPostgresContent(ctx, cs.pool, content)
+}
+
+// postgresExecer is implemented by both *pgxpool.Pool and pgx.Tx
+type postgresExecer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// insertPostgresContent inserts a new content record through db
+func insertPostgresContent(ctx context.Context, db postgresExecer, content *Content) error {
 	// Serialize data to JSON
 	dataJSON, err := json.Marshal(content.Data)
 	if err != nil {
 		return fmt.Errorf("failed to marshal data: %w", err)
 	}
 
+	// The timestamps and version are only set once the insert succeeded,
+	// so that a rejected create leaves the content untouched
 	now := time.Now()
-	content.CreatedAt = now
-	content.UpdatedAt = now
 
 	query := `
-		INSERT INTO content (id, title, body, author, status, data, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO content (id, title, body, author, status, data, created_at, updated_at, version, published_at, published_by, publish_at, expire_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 	`
 
-	_, err = cs.pool.Exec(context.Background(), query,
+	_, err = db.Exec(ctx, query,
 		content.ID,
 		content.Title,
 		content.Body,
 		content.Author,
 		content.Status,
 		dataJSON,
-		content.CreatedAt,
-		content.UpdatedAt,
+		now,
+		now,
+		1,
+		content.PublishedAt,
+		content.PublishedBy,
+		content.PublishAt,
+		content.ExpireAt,
 	)
 
 	if err != nil {
-		return fmt.Errorf("failed to create content: %w", err)
+		return wrapError(ctx, "failed to create content", err)
+	}
+
+	content.CreatedAt = now
+	content.UpdatedAt = now
+	content.Version = 1
+	return nil
+}
+
+// CreateMany inserts several content records with a single COPY, which is
+// atomic: either all of them are created or none
+func (cs *PostgresContentStore) CreateMany(ctx context.Context, contents []*Content) error {
+	now := time.Now()
+
+	rows := make([][]interface{}, len(contents))
+	for i, content := range contents {
+		dataJSON, err := json.Marshal(content.Data)
+		if err != nil {
+			return fmt.Errorf("failed to marshal data: %w", err)
+		}
+
+		content.CreatedAt = now
+		content.UpdatedAt = now
+		content.Version = 1
+
+		rows[i] = []interface{}{
+			content.ID,
+			content.Title,
+			content.Body,
+			content.Author,
+			content.Status,
+			dataJSON,
+			content.CreatedAt,
+			content.UpdatedAt,
+			content.Version,
+			content.PublishedAt,
+			content.PublishedBy,
+			content.PublishAt,
+			content.ExpireAt,
+		}
+	}
+
+	columns := []string{"id", "title", "body", "author", "status", "data", "created_at", "updated_at", "version", "published_at", "published_by", "publish_at", "expire_at"}
+	_, err := cs.pool.CopyFrom(ctx, pgx.Identifier{"content"}, columns, pgx.CopyFromRows(rows))
+	if err != nil {
+		return wrapError(ctx, "failed to create content", err)
 	}
 
 	return nil
 }
 
 // GetByID retrieves content by ID
-func (cs *PostgresContentStore) GetByID(id string) (*Content, error) {
+func (cs *PostgresContentStore) GetByID(ctx context.Context, id string) (*Content, error) {
 	query := `
-		SELECT id, title, body, author, status, data, created_at, updated_at
-		FROM content WHERE id = $1
+		SELECT id, title, body, author, status, data, created_at, updated_at, version, published_at, published_by, publish_at, expire_at
+		FROM content WHERE id = $1 AND deleted_at IS NULL
 	`
 
 	var content Content
 	var dataJSON []byte
 
-	err := cs.pool.QueryRow(context.Background(), query, id).Scan(
+	err := cs.pool.QueryRow(ctx, query, id).Scan(
 		&content.ID,
 		&content.Title,
 		&content.Body,
@@ -105,13 +242,18 @@ func (cs *PostgresContentStore) GetByID(id string) (*Content, error) {
 		&dataJSON,
 		&content.CreatedAt,
 		&content.UpdatedAt,
+		&content.Version,
+		&content.PublishedAt,
+		&content.PublishedBy,
+		&content.PublishAt,
+		&content.ExpireAt,
 	)
 
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return nil, fmt.Errorf("content not found")
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
 		}
-		return nil, fmt.Errorf("failed to get content: %w", err)
+		return nil, wrapError(ctx, "failed to get content", err)
 	}
 
 	// Deserialize data from JSON
@@ -122,16 +264,65 @@ func (cs *PostgresContentStore) GetByID(id string) (*Content, error) {
 	return &content, nil
 }
 
-// List retrieves all content records
-func (cs *PostgresContentStore) List() ([]*Content, error) {
+// List retrieves a page of content records matching the filters in opts
+func (cs *PostgresContentStore) List(ctx context.Context, opts ListOptions) (*ContentPage, error) {
+	sort := opts.sort()
+
+	conditions := []string{"deleted_at IS NULL"}
+	if opts.Deleted {
+		conditions[0] = "deleted_at IS NOT NULL"
+	}
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if opts.Status != "" {
+		conditions = append(conditions, "status = "+arg(opts.Status))
+	}
+	if opts.Author != "" {
+		conditions = append(conditions, "author = "+arg(opts.Author))
+	}
+	if opts.CreatedAfter != nil {
+		conditions = append(conditions, "created_at > "+arg(*opts.CreatedAfter))
+	}
+	if opts.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < "+arg(*opts.CreatedBefore))
+	}
+	if opts.UpdatedSince != nil {
+		conditions = append(conditions, "updated_at >= "+arg(*opts.UpdatedSince))
+	}
+	if opts.VisibleAt != nil {
+		at := arg(*opts.VisibleAt)
+		conditions = append(conditions, "(publish_at IS NULL OR publish_at <= "+at+")", "(expire_at IS NULL OR expire_at > "+at+")")
+	}
+	for _, filter := range opts.DataFilters {
+		doc, err := filter.containment()
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal data filter: %w", err)
+		}
+		// Containment lets Postgres use the idx_content_data_gin index
+		conditions = append(conditions, "data @> "+arg(string(doc))+"::jsonb")
+	}
+	if opts.Access != nil {
+		conditions = append(conditions, opts.Access.condition("", arg))
+	}
+	if opts.After != nil {
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (%s, %s)",
+			sort.Field, sort.keysetOperator(), arg(opts.After.Key), arg(opts.After.ID)))
+	}
+
 	query := `
-		SELECT id, title, body, author, status, data, created_at, updated_at
-		FROM content ORDER BY created_at DESC LIMIT 100
-	`
+		SELECT id, title, body, author, status, data, created_at, updated_at, version, published_at, published_by, publish_at, expire_at, deleted_at
+		FROM content
+		WHERE ` + strings.Join(conditions, " AND ")
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %s",
+		sort.Field, sort.direction(), sort.direction(), arg(opts.limit()+1))
 
-	rows, err := cs.pool.Query(context.Background(), query)
+	rows, err := cs.pool.Query(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query content: %w", err)
+		return nil, wrapError(ctx, "failed to query content", err)
 	}
 	defer rows.Close()
 
@@ -149,6 +340,12 @@ func (cs *PostgresContentStore) List() ([]*Content, error) {
 			&dataJSON,
 			&content.CreatedAt,
 			&content.UpdatedAt,
+			&content.Version,
+			&content.PublishedAt,
+			&content.PublishedBy,
+			&content.PublishAt,
+			&content.ExpireAt,
+			&content.DeletedAt,
 		)
 
 		if err != nil {
@@ -164,61 +361,731 @@ func (cs *PostgresContentStore) List() ([]*Content, error) {
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows: %w", err)
+		return nil, wrapError(ctx, "error iterating rows", err)
 	}
 
-	return contents, nil
+	return newContentPage(contents, opts), nil
 }
 
-// Update updates an existing content record
-func (cs *PostgresContentStore) Update(content *Content) error {
+// Update updates an existing content record if its stored version still
+// equals content.Version, and increments the version on success
+func (cs *PostgresContentStore) Update(ctx context.Context, content *Content) error {
 	// Serialize data to JSON
 	dataJSON, err := json.Marshal(content.Data)
 	if err != nil {
 		return fmt.Errorf("failed to marshal data: %w", err)
 	}
 
-	content.UpdatedAt = time.Now()
+	updatedAt := time.Now()
 
 	query := `
-		UPDATE content 
-		SET title = $1, body = $2, author = $3, status = $4, data = $5, updated_at = $6
-		WHERE id = $7
+		UPDATE content
+		SET title = $1, body = $2, author = $3, status = $4, data = $5, published_at = $6, published_by = $7,
+			publish_at = $8, expire_at = $9, updated_at = $10, version = version + 1
+		WHERE id = $11 AND version = $12 AND deleted_at IS NULL
 	`
 
-	result, err := cs.pool.Exec(context.Background(), query,
+	result, err := cs.pool.Exec(ctx, query,
 		content.Title,
 		content.Body,
 		content.Author,
 		content.Status,
 		dataJSON,
-		content.UpdatedAt,
+		content.PublishedAt,
+		content.PublishedBy,
+		content.PublishAt,
+		content.ExpireAt,
+		updatedAt,
 		content.ID,
+		content.Version,
 	)
 
 	if err != nil {
-		return fmt.Errorf("failed to update content: %w", err)
+		return wrapError(ctx, "failed to update content", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return cs.missingOrConflict(ctx, content.ID)
+	}
+
+	content.UpdatedAt = updatedAt
+	content.Version++
+
+	return nil
+}
+
+// Delete moves a content record to the trash. If expectedVersion is non-zero
+// the record is only deleted while its version still matches.
+func (cs *PostgresContentStore) Delete(ctx context.Context, id string, expectedVersion int) error {
+	query := `
+		UPDATE content
+		SET deleted_at = $1, updated_at = $1, version = version + 1
+		WHERE id = $2 AND deleted_at IS NULL AND ($3 = 0 OR version = $3)
+	`
+
+	result, err := cs.pool.Exec(ctx, query, time.Now(), id, expectedVersion)
+	if err != nil {
+		return wrapError(ctx, "failed to delete content", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return cs.missingOrConflict(ctx, id)
+	}
+
+	return nil
+}
+
+// Undelete restores a content record from the trash
+func (cs *PostgresContentStore) Undelete(ctx context.Context, id string) (*Content, error) {
+	query := `
+		UPDATE content
+		SET deleted_at = NULL, updated_at = $1, version = version + 1
+		WHERE id = $2 AND deleted_at IS NOT NULL
+		RETURNING id, title, body, author, status, data, created_at, updated_at, version, published_at, published_by, publish_at, expire_at
+	`
+
+	var content Content
+	var dataJSON []byte
+
+	err := cs.pool.QueryRow(ctx, query, time.Now(), id).Scan(
+		&content.ID,
+		&content.Title,
+		&content.Body,
+		&content.Author,
+		&content.Status,
+		&dataJSON,
+		&content.CreatedAt,
+		&content.UpdatedAt,
+		&content.Version,
+		&content.PublishedAt,
+		&content.PublishedBy,
+		&content.PublishAt,
+		&content.ExpireAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, wrapError(ctx, "failed to undelete content", err)
+	}
+
+	// Deserialize data from JSON
+	if err := json.Unmarshal(dataJSON, &content.Data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal data: %w", err)
+	}
+
+	return &content, nil
+}
+
+// Purge permanently removes content deleted before the given time, along
+// with its revisions, in one transaction
+func (cs *PostgresContentStore) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	tx, err := cs.pool.Begin(ctx)
+	if err != nil {
+		return 0, wrapError(ctx, "failed to begin transaction", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM content_revisions
+		WHERE content_id IN (SELECT id FROM content WHERE deleted_at < $1)
+	`, deletedBefore)
+	if err != nil {
+		return 0, wrapError(ctx, "failed to purge revisions", err)
+	}
+
+	result, err := tx.Exec(ctx, `DELETE FROM content WHERE deleted_at < $1`, deletedBefore)
+	if err != nil {
+		return 0, wrapError(ctx, "failed to purge content", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, wrapError(ctx, "failed to commit purge", err)
+	}
+
+	return int(result.RowsAffected()), nil
+}
+
+// UpdateMany applies mutate to each record with the given IDs and writes the
+// results in one transaction. The records are locked while they are read, so
+// no other writer can change them in between.
+func (cs *PostgresContentStore) UpdateMany(ctx context.Context, ids []string, mutate func(*Content) error) ([]BulkResult, error) {
+	tx, err := cs.pool.Begin(ctx)
+	if err != nil {
+		return nil, wrapError(ctx, "failed to begin transaction", err)
+	}
+	defer tx.Rollback(ctx)
+
+	existing, err := cs.getManyForUpdate(ctx, tx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE content
+		SET title = $1, body = $2, author = $3, status = $4, data = $5, published_at = $6, published_by = $7,
+			publish_at = $8, expire_at = $9, updated_at = $10, version = version + 1
+		WHERE id = $11 AND version = $12 AND deleted_at IS NULL
+	`
+
+	updatedAt := time.Now()
+	results := make([]BulkResult, len(ids))
+	batch := &pgx.Batch{}
+	for i, id := range ids {
+		results[i].ID = id
+
+		current, ok := existing[id]
+		if !ok {
+			results[i].Err = ErrNotFound
+			continue
+		}
+
+		content, err := applyMutation(current, mutate)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		dataJSON, err := json.Marshal(content.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal data: %w", err)
+		}
+
+		batch.Queue(query,
+			content.Title,
+			content.Body,
+			content.Author,
+			content.Status,
+			dataJSON,
+			content.PublishedAt,
+			content.PublishedBy,
+			content.PublishAt,
+			content.ExpireAt,
+			updatedAt,
+			content.ID,
+			content.Version,
+		)
+
+		content.UpdatedAt = updatedAt
+		content.Version++
+		existing[id] = content
+		results[i].Content = content
+	}
+
+	// The rows are locked, so every queued update matches its version
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return nil, wrapError(ctx, "failed to update content", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, wrapError(ctx, "failed to commit content", err)
+	}
+
+	return results, nil
+}
+
+// getManyForUpdate reads and locks the records with the given IDs within tx,
+// keyed by ID
+func (cs *PostgresContentStore) getManyForUpdate(ctx context.Context, tx pgx.Tx, ids []string) (map[string]*Content, error) {
+	query := `
+		SELECT id, title, body, author, status, data, created_at, updated_at, version, published_at, published_by, publish_at, expire_at
+		FROM content WHERE id = ANY($1) AND deleted_at IS NULL
+		FOR UPDATE
+	`
+
+	rows, err := tx.Query(ctx, query, ids)
+	if err != nil {
+		return nil, wrapError(ctx, "failed to query content", err)
+	}
+	defer rows.Close()
+
+	contents := make(map[string]*Content, len(ids))
+	for rows.Next() {
+		var content Content
+		var dataJSON []byte
+
+		err := rows.Scan(
+			&content.ID,
+			&content.Title,
+			&content.Body,
+			&content.Author,
+			&content.Status,
+			&dataJSON,
+			&content.CreatedAt,
+			&content.UpdatedAt,
+			&content.Version,
+			&content.PublishedAt,
+			&content.PublishedBy,
+			&content.PublishAt,
+			&content.ExpireAt,
+		)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan content: %w", err)
+		}
+
+		// Deserialize data from JSON
+		if err := json.Unmarshal(dataJSON, &content.Data); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal data: %w", err)
+		}
+
+		contents[content.ID] = &content
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, wrapError(ctx, "error iterating rows", err)
+	}
+
+	return contents, nil
+}
+
+// DeleteMany moves the records with the given IDs to the trash in one
+// statement, joining the content to the requested IDs and versions
+func (cs *PostgresContentStore) DeleteMany(ctx context.Context, ids []string, expectedVersions []int) ([]BulkResult, error) {
+	query := `
+		UPDATE content
+		SET deleted_at = $1, updated_at = $1, version = content.version + 1
+		FROM unnest($2::text[], $3::int[]) AS requested(id, expected_version)
+		WHERE content.id = requested.id AND content.deleted_at IS NULL
+			AND (requested.expected_version = 0 OR content.version = requested.expected_version)
+		RETURNING content.id
+	`
+
+	versions := make([]int, len(ids))
+	for i := range ids {
+		versions[i] = expectedVersion(expectedVersions, i)
+	}
+
+	rows, err := cs.pool.Query(ctx, query, time.Now(), ids, versions)
+	if err != nil {
+		return nil, wrapError(ctx, "failed to delete content", err)
+	}
+
+	deleted, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, wrapError(ctx, "failed to delete content", err)
+	}
+
+	results := deleteResults(ids, deleted)
+	for i := range results {
+		if results[i].Err != nil && versions[i] != 0 {
+			results[i].Err = cs.missingOrConflict(ctx, results[i].ID)
+		}
+	}
+	return results, nil
+}
+
+// ListScheduled returns the IDs of content whose scheduled publication or
+// expiry is due, oldest first, at most limit of them
+func (cs *PostgresContentStore) ListScheduled(ctx context.Context, due time.Time, limit int) ([]string, error) {
+	query := `
+		SELECT id FROM content
+		WHERE deleted_at IS NULL
+			AND ((status = 'draft' AND publish_at <= $1) OR (status = 'published' AND expire_at <= $1))
+		ORDER BY id
+		LIMIT $2
+	`
+
+	rows, err := cs.pool.Query(ctx, query, due, limit)
+	if err != nil {
+		return nil, wrapError(ctx, "failed to list scheduled content", err)
 	}
 
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, wrapError(ctx, "failed to list scheduled content", err)
+	}
+
+	return ids, nil
+}
+
+// RunExclusive runs fn while holding the session advisory lock derived from
+// name, which other server instances respect. The lock is held by a
+// connection set aside for the duration of fn.
+func (cs *PostgresContentStore) RunExclusive(ctx context.Context, name string, fn func(context.Context) error) (bool, error) {
+	conn, err := cs.pool.Acquire(ctx)
+	if err != nil {
+		return false, wrapError(ctx, "failed to acquire connection", err)
+	}
+	defer conn.Release()
+
+	var locked bool
+	err = conn.QueryRow(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, name).Scan(&locked)
+	if err != nil {
+		return false, wrapError(ctx, "failed to acquire advisory lock", err)
+	}
+	if !locked {
+		return false, nil
+	}
+
+	defer func() {
+		// Unlock even if ctx is canceled meanwhile. A connection that cannot
+		// unlock is closed rather than returned to the pool holding the lock.
+		unlockCtx := context.WithoutCancel(ctx)
+		if _, err := conn.Exec(unlockCtx, `SELECT pg_advisory_unlock(hashtext($1))`, name); err != nil {
+			conn.Conn().Close(unlockCtx)
+		}
+	}()
+
+	return true, fn(ctx)
+}
+
+// CreateIdempotent inserts a new content record and saves the idempotency key
+// that created it in one transaction. An expired key is taken over. A
+// concurrent request with the same key waits for this transaction on the
+// primary key and then finds the key taken.
+func (cs *PostgresContentStore) CreateIdempotent(ctx context.Context, content *Content, key *IdempotencyKey) error {
+	tx, err := cs.pool.Begin(ctx)
+	if err != nil {
+		return wrapError(ctx, "failed to begin transaction", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := insertPostgresContent(ctx, tx, content); err != nil {
+		return err
+	}
+	if err := key.complete(content); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO idempotency_keys (caller, key, request_hash, content_id, response, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (caller, key) DO UPDATE SET
+			request_hash = excluded.request_hash,
+			content_id = excluded.content_id,
+			response = excluded.response,
+			created_at = excluded.created_at,
+			expires_at = excluded.expires_at
+		WHERE idempotency_keys.expires_at <= excluded.created_at
+	`
+
+	result, err := tx.Exec(ctx, query,
+		key.Caller,
+		key.Key,
+		key.RequestHash,
+		key.ContentID,
+		[]byte(key.Response),
+		key.CreatedAt,
+		key.ExpiresAt,
+	)
+	if err != nil {
+		return wrapError(ctx, "failed to save idempotency key", err)
+	}
 	if result.RowsAffected() == 0 {
-		return fmt.Errorf("content not found")
+		return errIdempotencyKeyExists(key.Key)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return wrapError(ctx, "failed to commit create", err)
 	}
 
 	return nil
 }
 
-// Delete removes a content record by ID
-func (cs *PostgresContentStore) Delete(id string) error {
-	query := `DELETE FROM content WHERE id = $1`
+// GetIdempotencyKey retrieves a live idempotency key sent by the caller
+func (cs *PostgresContentStore) GetIdempotencyKey(ctx context.Context, caller, key string) (*IdempotencyKey, error) {
+	query := `
+		SELECT caller, key, request_hash, content_id, response, created_at, expires_at
+		FROM idempotency_keys
+		WHERE caller = $1 AND key = $2 AND expires_at > now()
+	`
+
+	var k IdempotencyKey
+	var response []byte
+	err := cs.pool.QueryRow(ctx, query, caller, key).Scan(
+		&k.Caller,
+		&k.Key,
+		&k.RequestHash,
+		&k.ContentID,
+		&response,
+		&k.CreatedAt,
+		&k.ExpiresAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, wrapError(ctx, "failed to get idempotency key", err)
+	}
+	k.Response = json.RawMessage(response)
+
+	return &k, nil
+}
+
+// PurgeIdempotencyKeys removes idempotency keys that expired before the given time
+func (cs *PostgresContentStore) PurgeIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int, error) {
+	result, err := cs.pool.Exec(ctx, `DELETE FROM idempotency_keys WHERE expires_at < $1`, expiredBefore)
+	if err != nil {
+		return 0, wrapError(ctx, "failed to purge idempotency keys", err)
+	}
+
+	return int(result.RowsAffected()), nil
+}
 
-	result, err := cs.pool.Exec(context.Background(), query, id)
+// CreateAPIKey stores a minted API key
+func (cs *PostgresContentStore) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	_, err := cs.pool.Exec(ctx, `
+		INSERT INTO api_keys (id, name, key_hash, scopes, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, key.ID, key.Name, key.KeyHash, key.Scopes, key.CreatedAt)
 	if err != nil {
-		return fmt.Errorf("failed to delete content: %w", err)
+		return wrapError(ctx, "failed to create API key", err)
 	}
 
+	return nil
+}
+
+// GetAPIKey retrieves the unrevoked API key with the given hash
+func (cs *PostgresContentStore) GetAPIKey(ctx context.Context, keyHash string) (*APIKey, error) {
+	query := `
+		SELECT id, name, key_hash, scopes, created_at, revoked_at
+		FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL
+	`
+
+	key, err := scanPostgresAPIKey(cs.pool.QueryRow(ctx, query, keyHash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, wrapError(ctx, "failed to get API key", err)
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys returns all API keys including revoked ones, newest first
+func (cs *PostgresContentStore) ListAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	rows, err := cs.pool.Query(ctx, `
+		SELECT id, name, key_hash, scopes, created_at, revoked_at
+		FROM api_keys ORDER BY created_at DESC, id DESC
+	`)
+	if err != nil {
+		return nil, wrapError(ctx, "failed to list API keys", err)
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		key, err := scanPostgresAPIKey(rows)
+		if err != nil {
+			return nil, wrapError(ctx, "failed to scan API key", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapError(ctx, "failed to list API keys", err)
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey revokes the API key with the given ID
+func (cs *PostgresContentStore) RevokeAPIKey(ctx context.Context, id string) error {
+	result, err := cs.pool.Exec(ctx,
+		`UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return wrapError(ctx, "failed to revoke API key", err)
+	}
 	if result.RowsAffected() == 0 {
-		return fmt.Errorf("content not found")
+		return ErrNotFound
 	}
 
 	return nil
 }
+
+// scanPostgresAPIKey scans an api_keys row
+func scanPostgresAPIKey(row pgx.Row) (*APIKey, error) {
+	var key APIKey
+	err := row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.KeyHash,
+		&key.Scopes,
+		&key.CreatedAt,
+		&key.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// missingOrConflict explains why a versioned write affected no rows: either
+// the record does not exist or another writer changed its version first
+func (cs *PostgresContentStore) missingOrConflict(ctx context.Context, id string) error {
+	var exists bool
+	err := cs.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM content WHERE id = $1 AND deleted_at IS NULL)`, id).Scan(&exists)
+	if err != nil {
+		return wrapError(ctx, "failed to check content", err)
+	}
+	if exists {
+		return ErrVersionConflict
+	}
+	return ErrNotFound
+}
+
+// Search finds content whose title or body contains every word of the query,
+// best matches first, using the search_vector column and its GIN index
+func (cs *PostgresContentStore) Search(ctx context.Context, opts SearchOptions) ([]*SearchResult, error) {
+	if len(searchTerms(opts.Query)) == 0 {
+		return []*SearchResult{}, nil
+	}
+
+	titleOptions := fmt.Sprintf("StartSel=%s, StopSel=%s, HighlightAll=true", HighlightStart, HighlightEnd)
+	bodyOptions := fmt.Sprintf("StartSel=%s, StopSel=%s, MaxFragments=1, MaxWords=%d, MinWords=%d, FragmentDelimiter=%s",
+		HighlightStart, HighlightEnd, snippetWords, snippetWords/2, snippetEllipsis)
+
+	args := []interface{}{opts.Query, titleOptions, bodyOptions, opts.limit()}
+	access := ""
+	if opts.Access != nil {
+		access = " AND " + opts.Access.condition("", func(value interface{}) string {
+			args = append(args, value)
+			return fmt.Sprintf("$%d", len(args))
+		})
+	}
+
+	// websearch_to_tsquery never fails on user input, unlike to_tsquery
+	query := `
+		SELECT id, title, body, author, status, data, created_at, updated_at, version, published_at, published_by, publish_at, expire_at,
+			ts_rank(search_vector, q) AS rank,
+			ts_headline('english', title, q, $2),
+			ts_headline('english', body, q, $3)
+		FROM content, websearch_to_tsquery('english', $1) q
+		WHERE search_vector @@ q AND deleted_at IS NULL` + access + `
+		ORDER BY rank DESC, id DESC
+		LIMIT $4
+	`
+
+	rows, err := cs.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, wrapError(ctx, "failed to search content", err)
+	}
+	defer rows.Close()
+
+	results := []*SearchResult{}
+	for rows.Next() {
+		var content Content
+		var dataJSON []byte
+		result := &SearchResult{Content: &content}
+
+		err := rows.Scan(
+			&content.ID,
+			&content.Title,
+			&content.Body,
+			&content.Author,
+			&content.Status,
+			&dataJSON,
+			&content.CreatedAt,
+			&content.UpdatedAt,
+			&content.Version,
+			&content.PublishedAt,
+			&content.PublishedBy,
+			&content.PublishAt,
+			&content.ExpireAt,
+			&result.Rank,
+			&result.TitleSnippet,
+			&result.BodySnippet,
+		)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+
+		// Deserialize data from JSON
+		if err := json.Unmarshal(dataJSON, &content.Data); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal data: %w", err)
+		}
+
+		results = append(results, result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, wrapError(ctx, "error iterating rows", err)
+	}
+
+	return results, nil
+}
+
+// ListRevisions returns the revisions of the content with the given ID,
+// oldest first
+func (cs *PostgresContentStore) ListRevisions(ctx context.Context, id string) ([]*Revision, error) {
+	query := `
+		SELECT content_id, revision, operation, version, title, body, author, status, data, recorded_at
+		FROM content_revisions WHERE content_id = $1
+		ORDER BY revision
+	`
+
+	rows, err := cs.pool.Query(ctx, query, id)
+	if err != nil {
+		return nil, wrapError(ctx, "failed to list revisions", err)
+	}
+	defer rows.Close()
+
+	var revisions []*Revision
+	for rows.Next() {
+		revision, err := scanPostgresRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, wrapError(ctx, "error iterating rows", err)
+	}
+
+	if len(revisions) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return revisions, nil
+}
+
+// GetRevision returns a single revision of the content with the given ID
+func (cs *PostgresContentStore) GetRevision(ctx context.Context, id string, revision int) (*Revision, error) {
+	query := `
+		SELECT content_id, revision, operation, version, title, body, author, status, data, recorded_at
+		FROM content_revisions WHERE content_id = $1 AND revision = $2
+	`
+
+	result, err := scanPostgresRevision(cs.pool.QueryRow(ctx, query, id, revision))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, wrapError(ctx, "failed to get revision", err)
+	}
+
+	return result, nil
+}
+
+// scanPostgresRevision scans a content_revisions row
+func scanPostgresRevision(row pgx.Row) (*Revision, error) {
+	var revision Revision
+	var dataJSON []byte
+
+	err := row.Scan(
+		&revision.ContentID,
+		&revision.Revision,
+		&revision.Operation,
+		&revision.Version,
+		&revision.Title,
+		&revision.Body,
+		&revision.Author,
+		&revision.Status,
+		&dataJSON,
+		&revision.RecordedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deserialize data from JSON
+	if err := json.Unmarshal(dataJSON, &revision.Data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal data: %w", err)
+	}
+
+	return &revision, nil
+}
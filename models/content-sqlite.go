@@ -1,31 +1,161 @@
 package models
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/XSAM/otelsql"
+	"github.com/mattn/go-sqlite3"
+	"github.com/seenthis-ab/content-api/timing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// sqliteConstraintKinds maps SQLite extended result codes of constraint violations
+var sqliteConstraintKinds = map[sqlite3.ErrNoExtended]ConstraintKind{
+	sqlite3.ErrConstraintUnique:     ConstraintUnique,
+	sqlite3.ErrConstraintPrimaryKey: ConstraintUnique,
+	sqlite3.ErrConstraintNotNull:    ConstraintNotNull,
+	sqlite3.ErrConstraintCheck:      ConstraintCheck,
+	sqlite3.ErrConstraintForeignKey: ConstraintForeignKey,
+}
+
+// sqliteError classifies go-sqlite3 errors as a ConstraintError or
+// ErrUnavailable, returning nil for any other error
+func sqliteError(err error) error {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return nil
+	}
+
+	switch sqliteErr.Code {
+	case sqlite3.ErrConstraint:
+		kind, ok := sqliteConstraintKinds[sqliteErr.ExtendedCode]
+		if !ok {
+			kind = ConstraintCheck
+		}
+		// Messages look like "UNIQUE constraint failed: content.id"
+		_, constraint, _ := strings.Cut(sqliteErr.Error(), ": ")
+		return &ConstraintError{Kind: kind, Constraint: constraint, Err: err}
+	case sqlite3.ErrBusy, sqlite3.ErrLocked, sqlite3.ErrCantOpen, sqlite3.ErrIoErr:
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return nil
+}
+
+// sqliteTimeFormat is the layout timestamps are stored in. It is fixed width
+// and always UTC so that comparing the TEXT values orders them by time, which
+// keyset pagination on created_at relies on.
+const sqliteTimeFormat = "2006-01-02 15:04:05.000000000-07:00"
+
+// formatSQLiteTime formats t for storage in a TEXT timestamp column
+func formatSQLiteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeFormat)
+}
+
+// sqliteTime scans a TEXT timestamp column into a time.Time. The driver only
+// parses columns declared as DATE/DATETIME/TIMESTAMP, but the STRICT schema
+// declares them as TEXT.
+type sqliteTime struct {
+	t *time.Time
+}
+
+// Scan implements sql.Scanner
+func (st sqliteTime) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case time.Time:
+		*st.t = v
+		return nil
+	case string:
+		for _, layout := range sqlite3.SQLiteTimestampFormats {
+			if t, err := time.ParseInLocation(layout, v, time.UTC); err == nil {
+				*st.t = t
+				return nil
+			}
+		}
+		return fmt.Errorf("unsupported timestamp format: %q", v)
+	case nil:
+		*st.t = time.Time{}
+		return nil
+	default:
+		return fmt.Errorf("unsupported timestamp type: %T", value)
+	}
+}
+
+// sqliteNullableTime formats t for storage in a nullable TEXT timestamp
+// column, returning nil for a nil t
+func sqliteNullableTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return formatSQLiteTime(*t)
+}
+
+// sqliteNullTime scans a nullable TEXT timestamp column, leaving the pointer
+// nil for NULL
+type sqliteNullTime struct {
+	t **time.Time
+}
+
+// Scan implements sql.Scanner
+func (st sqliteNullTime) Scan(value interface{}) error {
+	if value == nil {
+		*st.t = nil
+		return nil
+	}
+	var t time.Time
+	if err := (sqliteTime{&t}).Scan(value); err != nil {
+		return err
+	}
+	*st.t = &t
+	return nil
+}
+
+// sqliteSpanOptions records a span per statement and transaction step, and
+// only within traced requests, as otelpgx does for Postgres
+var sqliteSpanOptions = otelsql.SpanOptions{
+	DisableErrSkip:       true,
+	OmitConnResetSession: true,
+	OmitConnPrepare:      true,
+	OmitRows:             true,
+	OmitConnectorConnect: true,
+	SpanFilter: func(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+		return trace.SpanFromContext(ctx).IsRecording()
+	},
+}
+
 type SQLiteContentStore struct {
-	db *sql.DB
+	db     *sql.DB
+	holder string // identifies this process as the holder of leases
 }
 
 // NewContentStore creates a new SQLiteContentStore instance
 func NewSQLiteContentStore(dbPath string) (*SQLiteContentStore, error) {
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+	// Without FTS5 the search migration fails, so refuse to start instead
+	if !sqliteFTS5 {
+		return nil, errors.New("SQLite support needs the FTS5 extension, build with -tags sqlite_fts5")
 	}
 
+	// Statements run during requests are timed for Server-Timing and, if
+	// the request is traced, recorded as spans
+	db := otelsql.OpenDB(timing.NewConnector(&sqlite3.SQLiteDriver{}, dbPath),
+		otelsql.WithAttributes(semconv.DBSystemNameSQLite),
+		otelsql.WithSpanOptions(sqliteSpanOptions),
+	)
+
 	// Test the connection
 	if err := db.Ping(); err != nil {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return &SQLiteContentStore{db: db}, nil
+	return &SQLiteContentStore{db: db, holder: rand.Text()}, nil
 }
 
 // Close closes the database connection
@@ -33,67 +163,181 @@ func (cs *SQLiteContentStore) Close() error {
 	return cs.db.Close()
 }
 
+// Ping checks that the database can be reached
+func (cs *SQLiteContentStore) Ping(ctx context.Context) error {
+	if err := cs.db.PingContext(ctx); err != nil {
+		return wrapError(ctx, "failed to ping database", err)
+	}
+	return nil
+}
+
+// MigrationVersion returns the migration version recorded by golang-migrate
+func (cs *SQLiteContentStore) MigrationVersion(ctx context.Context) (int, bool, error) {
+	var version int
+	var dirty bool
+	err := cs.db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, wrapError(ctx, "failed to get migration version", err)
+	}
+	return version, dirty, nil
+}
+
+// DB returns the database handle, for its connection pool metrics
+func (cs *SQLiteContentStore) DB() *sql.DB {
+	return cs.db
+}
+
 // Create inserts a new content record
-func (cs *SQLiteContentStore) Create(content *Content) error {
+func (cs *SQLiteContentStore) Create(ctx context.Context, content *Content) error {
+	return insertSQLiteContent(ctx, cs.db, content)
+}
+
+// sqliteExecer is implemented by both *sql.DB and *sql.Tx
+type sqliteExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertSQLiteContent inserts a new content record through db
+func insertSQLiteContent(ctx context.Context, db sqliteExecer, content *Content) error {
 	// Serialize data to JSON
 	dataJSON, err := json.Marshal(content.Data)
 	if err != nil {
 		return fmt.Errorf("failed to marshal data: %w", err)
 	}
 
+	// The timestamps and version are only set once the insert succeeded,
+	// so that a rejected create leaves the content untouched
 	now := time.Now()
-	content.CreatedAt = now
-	content.UpdatedAt = now
 
 	query := `
-		INSERT INTO content (id, title, body, author, status, data, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO content (id, title, body, author, status, data, created_at, updated_at, version, published_at, published_by, publish_at, expire_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err = cs.db.Exec(query,
+	_, err = db.ExecContext(ctx, query,
 		content.ID,
 		content.Title,
 		content.Body,
 		content.Author,
 		content.Status,
-		dataJSON,
-		content.CreatedAt,
-		content.UpdatedAt,
+		string(dataJSON),
+		formatSQLiteTime(now),
+		formatSQLiteTime(now),
+		1,
+		sqliteNullableTime(content.PublishedAt),
+		content.PublishedBy,
+		sqliteNullableTime(content.PublishAt),
+		sqliteNullableTime(content.ExpireAt),
 	)
 
 	if err != nil {
-		return fmt.Errorf("failed to create content: %w", err)
+		return wrapError(ctx, "failed to create content", err)
+	}
+
+	content.CreatedAt = now
+	content.UpdatedAt = now
+	content.Version = 1
+	return nil
+}
+
+// sqliteInsertBatchSize bounds the rows of one multi-row INSERT, keeping the
+// number of bound parameters well below SQLite's limit
+const sqliteInsertBatchSize = 500
+
+// CreateMany inserts several content records in one transaction using
+// multi-row INSERT statements. Either all of them are created or none.
+func (cs *SQLiteContentStore) CreateMany(ctx context.Context, contents []*Content) error {
+	now := time.Now()
+
+	tx, err := cs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapError(ctx, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	for start := 0; start < len(contents); start += sqliteInsertBatchSize {
+		batch := contents[start:min(start+sqliteInsertBatchSize, len(contents))]
+
+		values := make([]string, len(batch))
+		args := make([]interface{}, 0, 13*len(batch))
+		for i, content := range batch {
+			dataJSON, err := json.Marshal(content.Data)
+			if err != nil {
+				return fmt.Errorf("failed to marshal data: %w", err)
+			}
+
+			content.CreatedAt = now
+			content.UpdatedAt = now
+			content.Version = 1
+
+			values[i] = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+			args = append(args,
+				content.ID,
+				content.Title,
+				content.Body,
+				content.Author,
+				content.Status,
+				string(dataJSON),
+				formatSQLiteTime(content.CreatedAt),
+				formatSQLiteTime(content.UpdatedAt),
+				content.Version,
+				sqliteNullableTime(content.PublishedAt),
+				content.PublishedBy,
+				sqliteNullableTime(content.PublishAt),
+				sqliteNullableTime(content.ExpireAt),
+			)
+		}
+
+		query := `
+			INSERT INTO content (id, title, body, author, status, data, created_at, updated_at, version, published_at, published_by, publish_at, expire_at)
+			VALUES ` + strings.Join(values, ", ")
+
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return wrapError(ctx, "failed to create content", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return wrapError(ctx, "failed to commit content", err)
 	}
 
 	return nil
 }
 
 // GetByID retrieves content by ID
-func (cs *SQLiteContentStore) GetByID(id string) (*Content, error) {
+func (cs *SQLiteContentStore) GetByID(ctx context.Context, id string) (*Content, error) {
 	query := `
-		SELECT id, title, body, author, status, data, created_at, updated_at
-		FROM content WHERE id = ?
+		SELECT id, title, body, author, status, data, created_at, updated_at, version, published_at, published_by, publish_at, expire_at
+		FROM content WHERE id = ? AND deleted_at IS NULL
 	`
 
 	var content Content
 	var dataJSON []byte
 
-	err := cs.db.QueryRow(query, id).Scan(
+	err := cs.db.QueryRowContext(ctx, query, id).Scan(
 		&content.ID,
 		&content.Title,
 		&content.Body,
 		&content.Author,
 		&content.Status,
 		&dataJSON,
-		&content.CreatedAt,
-		&content.UpdatedAt,
+		sqliteTime{&content.CreatedAt},
+		sqliteTime{&content.UpdatedAt},
+		&content.Version,
+		sqliteNullTime{&content.PublishedAt},
+		&content.PublishedBy,
+		sqliteNullTime{&content.PublishAt},
+		sqliteNullTime{&content.ExpireAt},
 	)
 
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("content not found")
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
 		}
-		return nil, fmt.Errorf("failed to get content: %w", err)
+		return nil, wrapError(ctx, "failed to get content", err)
 	}
 
 	// Deserialize data from JSON
@@ -104,16 +348,70 @@ func (cs *SQLiteContentStore) GetByID(id string) (*Content, error) {
 	return &content, nil
 }
 
-// List retrieves all content records
-func (cs *SQLiteContentStore) List() ([]*Content, error) {
+// List retrieves a page of content records matching the filters in opts
+func (cs *SQLiteContentStore) List(ctx context.Context, opts ListOptions) (*ContentPage, error) {
+	sort := opts.sort()
+
+	conditions := []string{"deleted_at IS NULL"}
+	if opts.Deleted {
+		conditions[0] = "deleted_at IS NOT NULL"
+	}
+	var args []interface{}
+
+	if opts.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, opts.Status)
+	}
+	if opts.Author != "" {
+		conditions = append(conditions, "author = ?")
+		args = append(args, opts.Author)
+	}
+	if opts.CreatedAfter != nil {
+		conditions = append(conditions, "created_at > ?")
+		args = append(args, formatSQLiteTime(*opts.CreatedAfter))
+	}
+	if opts.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, formatSQLiteTime(*opts.CreatedBefore))
+	}
+	if opts.UpdatedSince != nil {
+		conditions = append(conditions, "updated_at >= ?")
+		args = append(args, formatSQLiteTime(*opts.UpdatedSince))
+	}
+	if opts.VisibleAt != nil {
+		conditions = append(conditions, "(publish_at IS NULL OR publish_at <= ?)", "(expire_at IS NULL OR expire_at > ?)")
+		args = append(args, formatSQLiteTime(*opts.VisibleAt), formatSQLiteTime(*opts.VisibleAt))
+	}
+	for _, filter := range opts.DataFilters {
+		condition, filterArgs := filter.sqliteCondition()
+		conditions = append(conditions, condition)
+		args = append(args, filterArgs...)
+	}
+	if opts.Access != nil {
+		conditions = append(conditions, opts.Access.condition("", func(value interface{}) string {
+			args = append(args, value)
+			return "?"
+		}))
+	}
+	if opts.After != nil {
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (?, ?)", sort.Field, sort.keysetOperator()))
+		key := opts.After.Key
+		if t, ok := key.(time.Time); ok {
+			key = formatSQLiteTime(t)
+		}
+		args = append(args, key, opts.After.ID)
+	}
+
 	query := `
-		SELECT id, title, body, author, status, data, created_at, updated_at
-		FROM content ORDER BY created_at DESC LIMIT 100
-	`
+		SELECT id, title, body, author, status, data, created_at, updated_at, version, published_at, published_by, publish_at, expire_at, deleted_at
+		FROM content
+		WHERE ` + strings.Join(conditions, " AND ")
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT ?", sort.Field, sort.direction(), sort.direction())
+	args = append(args, opts.limit()+1)
 
-	rows, err := cs.db.Query(query)
+	rows, err := cs.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query content: %w", err)
+		return nil, wrapError(ctx, "failed to query content", err)
 	}
 	defer rows.Close()
 
@@ -129,8 +427,14 @@ func (cs *SQLiteContentStore) List() ([]*Content, error) {
 			&content.Author,
 			&content.Status,
 			&dataJSON,
-			&content.CreatedAt,
-			&content.UpdatedAt,
+			sqliteTime{&content.CreatedAt},
+			sqliteTime{&content.UpdatedAt},
+			&content.Version,
+			sqliteNullTime{&content.PublishedAt},
+			&content.PublishedBy,
+			sqliteNullTime{&content.PublishAt},
+			sqliteNullTime{&content.ExpireAt},
+			sqliteNullTime{&content.DeletedAt},
 		)
 
 		if err != nil {
@@ -146,40 +450,47 @@ func (cs *SQLiteContentStore) List() ([]*Content, error) {
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows: %w", err)
+		return nil, wrapError(ctx, "error iterating rows", err)
 	}
 
-	return contents, nil
+	return newContentPage(contents, opts), nil
 }
 
-// Update updates an existing content record
-func (cs *SQLiteContentStore) Update(content *Content) error {
+// Update updates an existing content record if its stored version still
+// equals content.Version, and increments the version on success
+func (cs *SQLiteContentStore) Update(ctx context.Context, content *Content) error {
 	// Serialize data to JSON
 	dataJSON, err := json.Marshal(content.Data)
 	if err != nil {
 		return fmt.Errorf("failed to marshal data: %w", err)
 	}
 
-	content.UpdatedAt = time.Now()
+	updatedAt := time.Now()
 
 	query := `
-		UPDATE content 
-		SET title = ?, body = ?, author = ?, status = ?, data = ?, updated_at = ?
-		WHERE id = ?
+		UPDATE content
+		SET title = ?, body = ?, author = ?, status = ?, data = ?, published_at = ?, published_by = ?,
+			publish_at = ?, expire_at = ?, updated_at = ?, version = version + 1
+		WHERE id = ? AND version = ? AND deleted_at IS NULL
 	`
 
-	result, err := cs.db.Exec(query,
+	result, err := cs.db.ExecContext(ctx, query,
 		content.Title,
 		content.Body,
 		content.Author,
 		content.Status,
-		dataJSON,
-		content.UpdatedAt,
+		string(dataJSON),
+		sqliteNullableTime(content.PublishedAt),
+		content.PublishedBy,
+		sqliteNullableTime(content.PublishAt),
+		sqliteNullableTime(content.ExpireAt),
+		formatSQLiteTime(updatedAt),
 		content.ID,
+		content.Version,
 	)
 
 	if err != nil {
-		return fmt.Errorf("failed to update content: %w", err)
+		return wrapError(ctx, "failed to update content", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
@@ -188,19 +499,28 @@ func (cs *SQLiteContentStore) Update(content *Content) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("content not found")
+		return cs.missingOrConflict(ctx, content.ID)
 	}
 
+	content.UpdatedAt = updatedAt
+	content.Version++
+
 	return nil
 }
 
-// Delete removes a content record by ID
-func (cs *SQLiteContentStore) Delete(id string) error {
-	query := `DELETE FROM content WHERE id = ?`
+// Delete moves a content record to the trash. If expectedVersion is non-zero
+// the record is only deleted while its version still matches.
+func (cs *SQLiteContentStore) Delete(ctx context.Context, id string, expectedVersion int) error {
+	query := `
+		UPDATE content
+		SET deleted_at = ?, updated_at = ?, version = version + 1
+		WHERE id = ? AND deleted_at IS NULL AND (? = 0 OR version = ?)
+	`
 
-	result, err := cs.db.Exec(query, id)
+	now := formatSQLiteTime(time.Now())
+	result, err := cs.db.ExecContext(ctx, query, now, now, id, expectedVersion, expectedVersion)
 	if err != nil {
-		return fmt.Errorf("failed to delete content: %w", err)
+		return wrapError(ctx, "failed to delete content", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
@@ -209,8 +529,750 @@ func (cs *SQLiteContentStore) Delete(id string) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("content not found")
+		return cs.missingOrConflict(ctx, id)
 	}
 
 	return nil
 }
+
+// Undelete restores a content record from the trash
+func (cs *SQLiteContentStore) Undelete(ctx context.Context, id string) (*Content, error) {
+	query := `
+		UPDATE content
+		SET deleted_at = NULL, updated_at = ?, version = version + 1
+		WHERE id = ? AND deleted_at IS NOT NULL
+		RETURNING id, title, body, author, status, data, created_at, updated_at, version, published_at, published_by, publish_at, expire_at
+	`
+
+	var content Content
+	var dataJSON []byte
+
+	err := cs.db.QueryRowContext(ctx, query, formatSQLiteTime(time.Now()), id).Scan(
+		&content.ID,
+		&content.Title,
+		&content.Body,
+		&content.Author,
+		&content.Status,
+		&dataJSON,
+		sqliteTime{&content.CreatedAt},
+		sqliteTime{&content.UpdatedAt},
+		&content.Version,
+		sqliteNullTime{&content.PublishedAt},
+		&content.PublishedBy,
+		sqliteNullTime{&content.PublishAt},
+		sqliteNullTime{&content.ExpireAt},
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, wrapError(ctx, "failed to undelete content", err)
+	}
+
+	// Deserialize data from JSON
+	if err := json.Unmarshal(dataJSON, &content.Data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal data: %w", err)
+	}
+
+	return &content, nil
+}
+
+// Purge permanently removes content deleted before the given time, along
+// with its revisions, in one transaction
+func (cs *SQLiteContentStore) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	before := formatSQLiteTime(deletedBefore)
+
+	tx, err := cs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, wrapError(ctx, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM content_revisions
+		WHERE content_id IN (SELECT id FROM content WHERE deleted_at < ?)
+	`, before)
+	if err != nil {
+		return 0, wrapError(ctx, "failed to purge revisions", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM content WHERE deleted_at < ?`, before)
+	if err != nil {
+		return 0, wrapError(ctx, "failed to purge content", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, wrapError(ctx, "failed to commit purge", err)
+	}
+
+	return int(rowsAffected), nil
+}
+
+// UpdateMany applies mutate to each record with the given IDs and writes the
+// results in one transaction
+func (cs *SQLiteContentStore) UpdateMany(ctx context.Context, ids []string, mutate func(*Content) error) ([]BulkResult, error) {
+	tx, err := cs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, wrapError(ctx, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	existing, err := cs.getMany(ctx, tx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE content
+		SET title = ?, body = ?, author = ?, status = ?, data = ?, published_at = ?, published_by = ?,
+			publish_at = ?, expire_at = ?, updated_at = ?, version = version + 1
+		WHERE id = ? AND version = ? AND deleted_at IS NULL
+	`
+
+	updatedAt := time.Now()
+	results := make([]BulkResult, len(ids))
+	for i, id := range ids {
+		results[i].ID = id
+
+		current, ok := existing[id]
+		if !ok {
+			results[i].Err = ErrNotFound
+			continue
+		}
+
+		content, err := applyMutation(current, mutate)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		dataJSON, err := json.Marshal(content.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal data: %w", err)
+		}
+
+		result, err := tx.ExecContext(ctx, query,
+			content.Title,
+			content.Body,
+			content.Author,
+			content.Status,
+			string(dataJSON),
+			sqliteNullableTime(content.PublishedAt),
+			content.PublishedBy,
+			sqliteNullableTime(content.PublishAt),
+			sqliteNullableTime(content.ExpireAt),
+			formatSQLiteTime(updatedAt),
+			content.ID,
+			content.Version,
+		)
+		if err != nil {
+			return nil, wrapError(ctx, "failed to update content", err)
+		}
+
+		// Another connection may have written the row since this
+		// transaction read it
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			results[i].Err = ErrVersionConflict
+			continue
+		}
+
+		content.UpdatedAt = updatedAt
+		content.Version++
+		existing[id] = content
+		results[i].Content = content
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, wrapError(ctx, "failed to commit content", err)
+	}
+
+	return results, nil
+}
+
+// getMany reads the records with the given IDs within tx, keyed by ID
+func (cs *SQLiteContentStore) getMany(ctx context.Context, tx *sql.Tx, ids []string) (map[string]*Content, error) {
+	query := `
+		SELECT id, title, body, author, status, data, created_at, updated_at, version, published_at, published_by, publish_at, expire_at
+		FROM content WHERE id IN (` + sqlitePlaceholders(len(ids)) + `) AND deleted_at IS NULL
+	`
+
+	rows, err := tx.QueryContext(ctx, query, sqliteArgs(ids)...)
+	if err != nil {
+		return nil, wrapError(ctx, "failed to query content", err)
+	}
+	defer rows.Close()
+
+	contents := make(map[string]*Content, len(ids))
+	for rows.Next() {
+		var content Content
+		var dataJSON []byte
+
+		err := rows.Scan(
+			&content.ID,
+			&content.Title,
+			&content.Body,
+			&content.Author,
+			&content.Status,
+			&dataJSON,
+			sqliteTime{&content.CreatedAt},
+			sqliteTime{&content.UpdatedAt},
+			&content.Version,
+			sqliteNullTime{&content.PublishedAt},
+			&content.PublishedBy,
+			sqliteNullTime{&content.PublishAt},
+			sqliteNullTime{&content.ExpireAt},
+		)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan content: %w", err)
+		}
+
+		// Deserialize data from JSON
+		if err := json.Unmarshal(dataJSON, &content.Data); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal data: %w", err)
+		}
+
+		contents[content.ID] = &content
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, wrapError(ctx, "error iterating rows", err)
+	}
+
+	return contents, nil
+}
+
+// DeleteMany moves the records with the given IDs to the trash in one
+// statement, joining the content to the requested IDs and versions
+func (cs *SQLiteContentStore) DeleteMany(ctx context.Context, ids []string, expectedVersions []int) ([]BulkResult, error) {
+	query := `
+		UPDATE content
+		SET deleted_at = ?, updated_at = ?, version = content.version + 1
+		FROM (
+			SELECT value ->> 0 AS id, value ->> 1 AS expected_version FROM json_each(?)
+		) AS requested
+		WHERE content.id = requested.id AND content.deleted_at IS NULL
+			AND (requested.expected_version = 0 OR content.version = requested.expected_version)
+		RETURNING content.id
+	`
+
+	requested := make([][2]interface{}, len(ids))
+	for i, id := range ids {
+		requested[i] = [2]interface{}{id, expectedVersion(expectedVersions, i)}
+	}
+	requestedJSON, err := json.Marshal(requested)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal ids: %w", err)
+	}
+
+	now := formatSQLiteTime(time.Now())
+	rows, err := cs.db.QueryContext(ctx, query, now, now, string(requestedJSON))
+	if err != nil {
+		return nil, wrapError(ctx, "failed to delete content", err)
+	}
+	defer rows.Close()
+
+	var deleted []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan content id: %w", err)
+		}
+		deleted = append(deleted, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, wrapError(ctx, "error iterating rows", err)
+	}
+
+	results := deleteResults(ids, deleted)
+	for i := range results {
+		if results[i].Err != nil && expectedVersion(expectedVersions, i) != 0 {
+			results[i].Err = cs.missingOrConflict(ctx, results[i].ID)
+		}
+	}
+	return results, nil
+}
+
+// ListScheduled returns the IDs of content whose scheduled publication or
+// expiry is due, oldest first, at most limit of them
+func (cs *SQLiteContentStore) ListScheduled(ctx context.Context, due time.Time, limit int) ([]string, error) {
+	query := `
+		SELECT id FROM content
+		WHERE deleted_at IS NULL
+			AND ((status = 'draft' AND publish_at <= ?) OR (status = 'published' AND expire_at <= ?))
+		ORDER BY id
+		LIMIT ?
+	`
+
+	rows, err := cs.db.QueryContext(ctx, query, formatSQLiteTime(due), formatSQLiteTime(due), limit)
+	if err != nil {
+		return nil, wrapError(ctx, "failed to list scheduled content", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan content id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, wrapError(ctx, "error iterating rows", err)
+	}
+
+	return ids, nil
+}
+
+// sqliteLeaseDuration bounds how long a lease is held. A process that dies
+// while holding a lease blocks the job for at most this long.
+const sqliteLeaseDuration = 5 * time.Minute
+
+// RunExclusive runs fn while holding the lease with the given name in the
+// leases table, which other processes sharing the database file respect. fn
+// is canceled when the lease runs out.
+func (cs *SQLiteContentStore) RunExclusive(ctx context.Context, name string, fn func(context.Context) error) (bool, error) {
+	now := time.Now()
+
+	query := `
+		INSERT INTO leases (name, holder, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+		WHERE leases.expires_at < ?
+	`
+
+	result, err := cs.db.ExecContext(ctx, query, name, cs.holder,
+		formatSQLiteTime(now.Add(sqliteLeaseDuration)), formatSQLiteTime(now))
+	if err != nil {
+		return false, wrapError(ctx, "failed to acquire lease", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	// Release the lease even if ctx is canceled meanwhile
+	defer cs.db.ExecContext(context.WithoutCancel(ctx),
+		`DELETE FROM leases WHERE name = ? AND holder = ?`, name, cs.holder)
+
+	ctx, cancel := context.WithDeadline(ctx, now.Add(sqliteLeaseDuration))
+	defer cancel()
+
+	return true, fn(ctx)
+}
+
+// CreateIdempotent inserts a new content record and saves the idempotency key
+// that created it in one transaction. An expired key is taken over.
+func (cs *SQLiteContentStore) CreateIdempotent(ctx context.Context, content *Content, key *IdempotencyKey) error {
+	tx, err := cs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapError(ctx, "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertSQLiteContent(ctx, tx, content); err != nil {
+		return err
+	}
+	if err := key.complete(content); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO idempotency_keys (caller, key, request_hash, content_id, response, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (caller, key) DO UPDATE SET
+			request_hash = excluded.request_hash,
+			content_id = excluded.content_id,
+			response = excluded.response,
+			created_at = excluded.created_at,
+			expires_at = excluded.expires_at
+		WHERE idempotency_keys.expires_at <= excluded.created_at
+	`
+
+	result, err := tx.ExecContext(ctx, query,
+		key.Caller,
+		key.Key,
+		key.RequestHash,
+		key.ContentID,
+		string(key.Response),
+		formatSQLiteTime(key.CreatedAt),
+		formatSQLiteTime(key.ExpiresAt),
+	)
+	if err != nil {
+		return wrapError(ctx, "failed to save idempotency key", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return errIdempotencyKeyExists(key.Key)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return wrapError(ctx, "failed to commit create", err)
+	}
+
+	return nil
+}
+
+// GetIdempotencyKey retrieves a live idempotency key sent by the caller
+func (cs *SQLiteContentStore) GetIdempotencyKey(ctx context.Context, caller, key string) (*IdempotencyKey, error) {
+	query := `
+		SELECT caller, key, request_hash, content_id, response, created_at, expires_at
+		FROM idempotency_keys
+		WHERE caller = ? AND key = ? AND expires_at > ?
+	`
+
+	var k IdempotencyKey
+	var response string
+	err := cs.db.QueryRowContext(ctx, query, caller, key, formatSQLiteTime(time.Now())).Scan(
+		&k.Caller,
+		&k.Key,
+		&k.RequestHash,
+		&k.ContentID,
+		&response,
+		sqliteTime{&k.CreatedAt},
+		sqliteTime{&k.ExpiresAt},
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, wrapError(ctx, "failed to get idempotency key", err)
+	}
+	k.Response = json.RawMessage(response)
+
+	return &k, nil
+}
+
+// PurgeIdempotencyKeys removes idempotency keys that expired before the given time
+func (cs *SQLiteContentStore) PurgeIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int, error) {
+	result, err := cs.db.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE expires_at < ?`, formatSQLiteTime(expiredBefore))
+	if err != nil {
+		return 0, wrapError(ctx, "failed to purge idempotency keys", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return int(rowsAffected), nil
+}
+
+// CreateAPIKey stores a minted API key
+func (cs *SQLiteContentStore) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	scopesJSON, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal scopes: %w", err)
+	}
+
+	_, err = cs.db.ExecContext(ctx, `
+		INSERT INTO api_keys (id, name, key_hash, scopes, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, key.ID, key.Name, key.KeyHash, string(scopesJSON), formatSQLiteTime(key.CreatedAt))
+	if err != nil {
+		return wrapError(ctx, "failed to create API key", err)
+	}
+
+	return nil
+}
+
+// GetAPIKey retrieves the unrevoked API key with the given hash
+func (cs *SQLiteContentStore) GetAPIKey(ctx context.Context, keyHash string) (*APIKey, error) {
+	query := `
+		SELECT id, name, key_hash, scopes, created_at, revoked_at
+		FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL
+	`
+
+	key, err := scanSQLiteAPIKey(cs.db.QueryRowContext(ctx, query, keyHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, wrapError(ctx, "failed to get API key", err)
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys returns all API keys including revoked ones, newest first
+func (cs *SQLiteContentStore) ListAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	rows, err := cs.db.QueryContext(ctx, `
+		SELECT id, name, key_hash, scopes, created_at, revoked_at
+		FROM api_keys ORDER BY created_at DESC, id DESC
+	`)
+	if err != nil {
+		return nil, wrapError(ctx, "failed to list API keys", err)
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		key, err := scanSQLiteAPIKey(rows)
+		if err != nil {
+			return nil, wrapError(ctx, "failed to scan API key", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapError(ctx, "failed to list API keys", err)
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey revokes the API key with the given ID
+func (cs *SQLiteContentStore) RevokeAPIKey(ctx context.Context, id string) error {
+	result, err := cs.db.ExecContext(ctx,
+		`UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`,
+		formatSQLiteTime(time.Now()), id)
+	if err != nil {
+		return wrapError(ctx, "failed to revoke API key", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// scanSQLiteAPIKey scans an api_keys row
+func scanSQLiteAPIKey(row interface{ Scan(...interface{}) error }) (*APIKey, error) {
+	var key APIKey
+	var scopesJSON []byte
+	err := row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.KeyHash,
+		&scopesJSON,
+		sqliteTime{&key.CreatedAt},
+		sqliteNullTime{&key.RevokedAt},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(scopesJSON, &key.Scopes); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal scopes: %w", err)
+	}
+	return &key, nil
+}
+
+// sqlitePlaceholders returns n comma separated parameter placeholders
+func sqlitePlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// sqliteArgs converts IDs to query arguments
+func sqliteArgs(ids []string) []interface{} {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
+
+// missingOrConflict explains why a versioned write affected no rows: either
+// the record does not exist or another writer changed its version first
+func (cs *SQLiteContentStore) missingOrConflict(ctx context.Context, id string) error {
+	var exists bool
+	err := cs.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM content WHERE id = ? AND deleted_at IS NULL)`, id).Scan(&exists)
+	if err != nil {
+		return wrapError(ctx, "failed to check content", err)
+	}
+	if exists {
+		return ErrVersionConflict
+	}
+	return ErrNotFound
+}
+
+// Search finds content whose title or body contains every word of the query,
+// best matches first, using the content_fts FTS5 index
+func (cs *SQLiteContentStore) Search(ctx context.Context, opts SearchOptions) ([]*SearchResult, error) {
+	match := fts5Query(opts.Query)
+	if match == "" {
+		return []*SearchResult{}, nil
+	}
+
+	args := []interface{}{
+		HighlightStart, HighlightEnd,
+		HighlightStart, HighlightEnd, snippetEllipsis, snippetWords,
+		match,
+	}
+	access := ""
+	if opts.Access != nil {
+		access = " AND " + opts.Access.condition("c.", func(value interface{}) string {
+			args = append(args, value)
+			return "?"
+		})
+	}
+	args = append(args, opts.limit())
+
+	// bm25() is lower for better matches; title hits weigh more than body hits
+	query := `
+		SELECT c.id, c.title, c.body, c.author, c.status, c.data, c.created_at, c.updated_at, c.version, c.published_at, c.published_by, c.publish_at, c.expire_at,
+			-bm25(content_fts, 2.0, 1.0) AS rank,
+			highlight(content_fts, 0, ?, ?),
+			snippet(content_fts, 1, ?, ?, ?, ?)
+		FROM content_fts
+		JOIN content c ON c.rowid = content_fts.rowid
+		WHERE content_fts MATCH ? AND c.deleted_at IS NULL` + access + `
+		ORDER BY rank DESC, c.id DESC
+		LIMIT ?
+	`
+
+	rows, err := cs.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, wrapError(ctx, "failed to search content", err)
+	}
+	defer rows.Close()
+
+	results := []*SearchResult{}
+	for rows.Next() {
+		var content Content
+		var dataJSON []byte
+		result := &SearchResult{Content: &content}
+
+		err := rows.Scan(
+			&content.ID,
+			&content.Title,
+			&content.Body,
+			&content.Author,
+			&content.Status,
+			&dataJSON,
+			sqliteTime{&content.CreatedAt},
+			sqliteTime{&content.UpdatedAt},
+			&content.Version,
+			sqliteNullTime{&content.PublishedAt},
+			&content.PublishedBy,
+			sqliteNullTime{&content.PublishAt},
+			sqliteNullTime{&content.ExpireAt},
+			&result.Rank,
+			&result.TitleSnippet,
+			&result.BodySnippet,
+		)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+
+		// Deserialize data from JSON
+		if err := json.Unmarshal(dataJSON, &content.Data); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal data: %w", err)
+		}
+
+		results = append(results, result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, wrapError(ctx, "error iterating rows", err)
+	}
+
+	return results, nil
+}
+
+// ListRevisions returns the revisions of the content with the given ID,
+// oldest first
+func (cs *SQLiteContentStore) ListRevisions(ctx context.Context, id string) ([]*Revision, error) {
+	query := `
+		SELECT content_id, revision, operation, version, title, body, author, status, data, recorded_at
+		FROM content_revisions WHERE content_id = ?
+		ORDER BY revision
+	`
+
+	rows, err := cs.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, wrapError(ctx, "failed to list revisions", err)
+	}
+	defer rows.Close()
+
+	var revisions []*Revision
+	for rows.Next() {
+		revision, err := scanSQLiteRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, wrapError(ctx, "error iterating rows", err)
+	}
+
+	if len(revisions) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return revisions, nil
+}
+
+// GetRevision returns a single revision of the content with the given ID
+func (cs *SQLiteContentStore) GetRevision(ctx context.Context, id string, revision int) (*Revision, error) {
+	query := `
+		SELECT content_id, revision, operation, version, title, body, author, status, data, recorded_at
+		FROM content_revisions WHERE content_id = ? AND revision = ?
+	`
+
+	result, err := scanSQLiteRevision(cs.db.QueryRowContext(ctx, query, id, revision))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, wrapError(ctx, "failed to get revision", err)
+	}
+
+	return result, nil
+}
+
+// scanSQLiteRevision scans a content_revisions row
+func scanSQLiteRevision(row interface{ Scan(...interface{}) error }) (*Revision, error) {
+	var revision Revision
+	var dataJSON []byte
+
+	err := row.Scan(
+		&revision.ContentID,
+		&revision.Revision,
+		&revision.Operation,
+		&revision.Version,
+		&revision.Title,
+		&revision.Body,
+		&revision.Author,
+		&revision.Status,
+		&dataJSON,
+		sqliteTime{&revision.RecordedAt},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deserialize data from JSON
+	if err := json.Unmarshal(dataJSON, &revision.Data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal data: %w", err)
+	}
+
+	return &revision, nil
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -10,26 +11,133 @@ import (
 
 // Content represents a content record
 type Content struct {
-	ID        string                 `json:"id" db:"id"`
-	Title     string                 `json:"title" db:"title"`
-	Body      string                 `json:"body" db:"body"`
-	Author    string                 `json:"author" db:"author"`
-	Status    string                 `json:"status" db:"status"`
-	Data      map[string]interface{} `json:"data" db:"data"`
-	CreatedAt time.Time              `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time              `json:"updated_at" db:"updated_at"`
+	ID          string                 `json:"id" db:"id"`
+	Title       string                 `json:"title" db:"title"`
+	Body        string                 `json:"body" db:"body"`
+	Author      string                 `json:"author" db:"author"`
+	Status      string                 `json:"status" db:"status"`
+	Data        map[string]interface{} `json:"data" db:"data"`
+	CreatedAt   time.Time              `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at" db:"updated_at"`
+	Version     int                    `json:"version" db:"version"`
+	PublishAt   *time.Time             `json:"publish_at,omitempty" db:"publish_at"`
+	ExpireAt    *time.Time             `json:"expire_at,omitempty" db:"expire_at"`
+	PublishedAt *time.Time             `json:"published_at,omitempty" db:"published_at"`
+	PublishedBy *string                `json:"published_by,omitempty" db:"published_by"`
+	DeletedAt   *time.Time             `json:"deleted_at,omitempty" db:"deleted_at"`
 }
 
-// ContentStore interface defines the contract for content storage operations
+// ContentReader reads content. Every operation of the store interfaces takes
+// the caller's context so that a disconnected client or an expired deadline
+// aborts the underlying query; such aborts are reported as ErrCanceled or
+// ErrDeadlineExceeded. Missing content is reported as ErrNotFound, an
+// unreachable database as ErrUnavailable and constraint violations as a
+// *ConstraintError.
+//
+// Content in the trash is treated as missing; List only returns it when
+// ListOptions.Deleted is set.
+type ContentReader interface {
+	GetByID(ctx context.Context, id string) (*Content, error)
+	List(ctx context.Context, opts ListOptions) (*ContentPage, error)
+	Search(ctx context.Context, opts SearchOptions) ([]*SearchResult, error)
+}
+
+// ContentWriter writes single content records. Writes are optimistic: Update
+// only succeeds while the stored version equals Content.Version, and Delete
+// while it equals expectedVersion (unless zero); otherwise they return
+// ErrVersionConflict.
+//
+// Delete moves content to the trash, from which Undelete restores it.
+type ContentWriter interface {
+	Create(ctx context.Context, content *Content) error
+	Update(ctx context.Context, content *Content) error
+	Delete(ctx context.Context, id string, expectedVersion int) error
+	Undelete(ctx context.Context, id string) (*Content, error)
+}
+
+// BatchWriter writes content in batches, each in a single transaction.
+// CreateMany is all or nothing. UpdateMany and DeleteMany report missing
+// records and failed mutations per item in their results and commit the
+// remaining items; the returned error is only set if the batch as a whole
+// failed and was rolled back. DeleteMany takes nil or the version each item
+// must still have, zero for any; an item at another version is reported as
+// ErrVersionConflict and left alone.
+type BatchWriter interface {
+	CreateMany(ctx context.Context, contents []*Content) error
+	UpdateMany(ctx context.Context, ids []string, mutate func(*Content) error) ([]BulkResult, error)
+	DeleteMany(ctx context.Context, ids []string, expectedVersions []int) ([]BulkResult, error)
+}
+
+// RevisionReader reads the revisions recorded by every write of content
+type RevisionReader interface {
+	ListRevisions(ctx context.Context, id string) ([]*Revision, error)
+	GetRevision(ctx context.Context, id string, revision int) (*Revision, error)
+}
+
+// IdempotencyStore saves the responses of idempotent creates. CreateIdempotent
+// creates content like Create and saves the idempotency key in the same
+// transaction, so that either both are stored or neither. It fails with
+// ErrConflict if the key is live. Keys are scoped to the caller that sent
+// them, so that callers cannot see each other's responses or block each
+// other's keys. GetIdempotencyKey reports expired keys as
+// ErrNotFound, and PurgeIdempotencyKeys removes keys that expired before a
+// given time.
+type IdempotencyStore interface {
+	CreateIdempotent(ctx context.Context, content *Content, key *IdempotencyKey) error
+	GetIdempotencyKey(ctx context.Context, caller, key string) (*IdempotencyKey, error)
+	PurgeIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int, error)
+}
+
+// APIKeyStore stores API keys. CreateAPIKey stores a minted key and GetAPIKey
+// looks up the key with the given hash, reporting revoked keys as
+// ErrNotFound. RevokeAPIKey revokes a key by its ID and ListAPIKeys returns
+// all keys, newest first.
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	GetAPIKey(ctx context.Context, keyHash string) (*APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]*APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string) error
+}
+
+// JobStore backs the background jobs. Purge removes content that has been in
+// the trash since before a given time for good. ListScheduled returns the IDs
+// of drafts whose publish_at and of published content whose expire_at is at
+// or before due. RunExclusive runs fn unless another holder, possibly in
+// another server process, is running under the same name, and reports
+// whether fn ran.
+type JobStore interface {
+	Purge(ctx context.Context, deletedBefore time.Time) (int, error)
+	ListScheduled(ctx context.Context, due time.Time, limit int) ([]string, error)
+	RunExclusive(ctx context.Context, name string, fn func(context.Context) error) (bool, error)
+}
+
+// HealthStore reports the health of the database. Ping checks that it can be
+// reached. MigrationVersion returns the version of the last migration
+// applied to it and whether that migration failed halfway (dirty), as
+// recorded by golang-migrate, or zero if none was.
+type HealthStore interface {
+	Ping(ctx context.Context) error
+	MigrationVersion(ctx context.Context) (version int, dirty bool, err error)
+}
+
+// ContentStore is a complete content storage backend
 type ContentStore interface {
-	Create(content *Content) error
-	GetByID(id string) (*Content, error)
-	List() ([]*Content, error)
-	Update(content *Content) error
-	Delete(id string) error
+	ContentReader
+	ContentWriter
+	BatchWriter
+	RevisionReader
+	IdempotencyStore
+	APIKeyStore
+	JobStore
+	HealthStore
 	Close() error
 }
 
+// LatestMigration is the version of the newest migration in db/sqlite/migrations
+// and db/postgres/migrations, which the database must be at for the server to
+// be ready. Bump it when adding a migration.
+const LatestMigration = 13
+
 // ContentStoreFactory defines a function type for creating ContentStore instances
 type ContentStoreFactory func(dbConfig *config.DatabaseConfig) (ContentStore, error)
 
@@ -37,9 +145,10 @@ type ContentStoreFactory func(dbConfig *config.DatabaseConfig) (ContentStore, er
 // based on the database configuration
 func GetContentStore() (ContentStore, error) {
 	log := config.GetLogger()
-	dbConfig := config.LoadDatabaseConfig()
-	switch config.GetDatabaseEngine() {
+	engine := config.GetDatabaseEngine()
+	switch engine {
 	case "postgres":
+		dbConfig := config.LoadDatabaseConfig()
 		log.Info("Using Postgres database engine",
 			zap.Int("max_connections", dbConfig.MaxConns),
 			zap.Int("min_connections", dbConfig.MinConns),
@@ -49,14 +158,18 @@ func GetContentStore() (ContentStore, error) {
 			return nil, fmt.Errorf("failed to initialize Postgres database: %w", err)
 		}
 		return pgStore, nil
+	case "memory":
+		log.Info("Using in-memory database engine")
+		return NewMemoryContentStore(), nil
 	case "sqlite":
 		log.Info("Using SQLite database engine")
-		fallthrough
-	default:
+		dbConfig := config.LoadDatabaseConfig()
 		sqlStore, err := NewSQLiteContentStore(dbConfig.GetConnectionString())
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize SQLite database: %w", err)
 		}
 		return sqlStore, nil
+	default:
+		return nil, fmt.Errorf("unsupported database engine: %q", engine)
 	}
 }
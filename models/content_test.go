@@ -0,0 +1,110 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestCreateConflict checks that creating content under a taken ID fails
+// with ErrConflict and leaves the rejected content untouched
+func TestCreateConflict(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store ContentStore) {
+		existing := createTestContent(t, store, nil)
+
+		createdAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		duplicate := &Content{
+			ID:        existing.ID,
+			Title:     "Duplicate",
+			Body:      "Duplicate body",
+			Author:    "someone else",
+			Status:    "draft",
+			CreatedAt: createdAt,
+			UpdatedAt: createdAt,
+			Version:   7,
+		}
+		err := store.Create(context.Background(), duplicate)
+		if !errors.Is(err, ErrConflict) {
+			t.Fatalf("Create = %v, want ErrConflict", err)
+		}
+		if !duplicate.CreatedAt.Equal(createdAt) || !duplicate.UpdatedAt.Equal(createdAt) || duplicate.Version != 7 {
+			t.Errorf("rejected create changed the content to created_at %v, updated_at %v, version %d",
+				duplicate.CreatedAt, duplicate.UpdatedAt, duplicate.Version)
+		}
+
+		stored, err := store.GetByID(context.Background(), existing.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if stored.Title != existing.Title || stored.Version != 1 {
+			t.Errorf("stored content = %q version %d, want %q version 1", stored.Title, stored.Version, existing.Title)
+		}
+	})
+}
+
+// TestUpdateVersion checks that Update only applies to the version it read,
+// bumping it, and fails with ErrVersionConflict once another write came
+// first
+func TestUpdateVersion(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store ContentStore) {
+		ctx := context.Background()
+		content := createTestContent(t, store, nil)
+		stale := *content
+
+		content.Title = "First"
+		if err := store.Update(ctx, content); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if content.Version != 2 {
+			t.Errorf("version after update = %d, want 2", content.Version)
+		}
+
+		stale.Title = "Second"
+		if err := store.Update(ctx, &stale); !errors.Is(err, ErrVersionConflict) {
+			t.Fatalf("Update at a stale version = %v, want ErrVersionConflict", err)
+		}
+
+		stored, err := store.GetByID(ctx, content.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if stored.Title != "First" || stored.Version != 2 {
+			t.Errorf("stored content = %q version %d, want First version 2", stored.Title, stored.Version)
+		}
+	})
+}
+
+// TestDeleteVersion checks that Delete only trashes content at the expected
+// version, or at any version when it is zero
+func TestDeleteVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected int
+		err      error
+	}{
+		{"any version", 0, nil},
+		{"current version", 1, nil},
+		{"other version", 2, ErrVersionConflict},
+	}
+	forEachStore(t, func(t *testing.T, store ContentStore) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				content := createTestContent(t, store, nil)
+
+				if err := store.Delete(ctx, content.ID, tt.expected); !errors.Is(err, tt.err) {
+					t.Fatalf("Delete = %v, want %v", err, tt.err)
+				}
+
+				_, err := store.GetByID(ctx, content.ID)
+				if tt.err == nil && !errors.Is(err, ErrNotFound) {
+					t.Errorf("GetByID after delete = %v, want ErrNotFound", err)
+				}
+				if tt.err != nil && err != nil {
+					t.Errorf("GetByID after rejected delete = %v, want the content", err)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Cursor identifies the last row of a page for keyset pagination. Rows are
+// ordered by (sort key, id), and since IDs are ULIDs the pair is unique.
+type Cursor struct {
+	Sort Sort        // ordering the cursor was issued for
+	Key  interface{} // sort key of the last row, a time.Time or a string
+	ID   string      // id of the last row
+}
+
+// cursorJSON is the serialized form of a Cursor
+type cursorJSON struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+	ID   string `json:"i"`
+}
+
+// CursorFor returns the cursor pointing just past the given content
+func CursorFor(sort Sort, content *Content) *Cursor {
+	return &Cursor{Sort: sort, Key: sort.key(content), ID: content.ID}
+}
+
+// Encode returns the opaque, URL-safe representation of the cursor
+func (c *Cursor) Encode() string {
+	cj := cursorJSON{Sort: c.Sort.String(), ID: c.ID}
+	switch key := c.Key.(type) {
+	case time.Time:
+		cj.Key = key.Format(time.RFC3339Nano)
+	case string:
+		cj.Key = key
+	}
+
+	data, _ := json.Marshal(cj)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor previously returned by Encode. The cursor must
+// have been issued for the given sort, since keys are not comparable otherwise.
+func DecodeCursor(s string, sort Sort) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	var cj cursorJSON
+	if err := json.Unmarshal(data, &cj); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	if cj.ID == "" {
+		return nil, fmt.Errorf("invalid cursor: missing position")
+	}
+	if cj.Sort != sort.String() {
+		return nil, fmt.Errorf("invalid cursor: issued for sort %q, not %q", cj.Sort, sort.String())
+	}
+
+	c := &Cursor{Sort: sort, Key: cj.Key, ID: cj.ID}
+	if sort.Field.isTime() {
+		t, err := time.Parse(time.RFC3339Nano, cj.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", err)
+		}
+		c.Key = t
+	}
+
+	return c, nil
+}
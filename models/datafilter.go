@@ -0,0 +1,196 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DataFilterPrefix is the query parameter prefix selecting keys in the data column
+const DataFilterPrefix = "data."
+
+// dataContainsPrefix marks a filter value as array membership rather than equality
+const dataContainsPrefix = "contains:"
+
+// dataKeyPattern restricts the keys a filter path may contain, keeping paths
+// safe to embed in SQLite JSON path expressions
+var dataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// DataFilterOp is the comparison a DataFilter performs
+type DataFilterOp string
+
+const (
+	// DataEquals matches when the value at the path equals the filter value
+	DataEquals DataFilterOp = "eq"
+	// DataContains matches when the value at the path is an array holding the filter value
+	DataContains DataFilterOp = "contains"
+)
+
+// DataFilter matches content by a value inside its JSON data column.
+//
+// Values are JSON scalars: a filter value that parses as a JSON number, boolean,
+// null or quoted string is used as such, anything else is taken as a plain
+// string. So data.count=5 matches the number 5 and data.code="5" the string "5".
+type DataFilter struct {
+	Path  []string
+	Op    DataFilterOp
+	Value interface{} // string, float64, bool or nil
+}
+
+// ParseDataFilter parses a query parameter such as data.category=programming
+// or data.tags=contains:go into a DataFilter
+func ParseDataFilter(key, value string) (DataFilter, error) {
+	if !strings.HasPrefix(key, DataFilterPrefix) {
+		return DataFilter{}, fmt.Errorf("data filter %q must start with %q", key, DataFilterPrefix)
+	}
+
+	path := strings.Split(strings.TrimPrefix(key, DataFilterPrefix), ".")
+	for _, k := range path {
+		if !dataKeyPattern.MatchString(k) {
+			return DataFilter{}, fmt.Errorf("invalid data filter key %q: keys may only contain letters, digits and underscores", key)
+		}
+	}
+
+	filter := DataFilter{Path: path, Op: DataEquals}
+	if strings.HasPrefix(value, dataContainsPrefix) {
+		filter.Op = DataContains
+		value = strings.TrimPrefix(value, dataContainsPrefix)
+	}
+	filter.Value = parseDataFilterValue(value)
+
+	return filter, nil
+}
+
+// parseDataFilterValue decodes a JSON scalar, falling back to the raw string
+func parseDataFilterValue(value string) interface{} {
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(value), &decoded); err == nil {
+		switch decoded.(type) {
+		case string, float64, bool, nil:
+			return decoded
+		}
+	}
+	return value
+}
+
+// containment returns the JSON document that the Postgres data column must
+// contain (@>) for the filter to match
+func (f DataFilter) containment() ([]byte, error) {
+	var doc interface{} = f.Value
+	if f.Op == DataContains {
+		doc = []interface{}{f.Value}
+	}
+	for i := len(f.Path) - 1; i >= 0; i-- {
+		doc = map[string]interface{}{f.Path[i]: doc}
+	}
+	return json.Marshal(doc)
+}
+
+// jsonPath returns the SQLite JSON path expression for the filter, e.g. $.a.b
+func (f DataFilter) jsonPath() string {
+	return "$." + strings.Join(f.Path, ".")
+}
+
+// sqliteJSONType returns the json_type() SQLite reports for the filter value
+func (f DataFilter) sqliteJSONType() string {
+	switch v := f.Value.(type) {
+	case string:
+		return "text"
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case nil:
+		return "null"
+	default:
+		return "number"
+	}
+}
+
+// sqliteCondition returns the SQL condition and arguments implementing the
+// filter with SQLite JSON functions, mirroring Postgres containment semantics
+func (f DataFilter) sqliteCondition() (string, []interface{}) {
+	typeCondition := func(typeExpr string) string {
+		// SQLite reports numbers as integer or real, JSON only knows number
+		if f.sqliteJSONType() == "number" {
+			return typeExpr + " IN ('integer', 'real')"
+		}
+		return typeExpr + " = '" + f.sqliteJSONType() + "'"
+	}
+
+	// Booleans and null are fully determined by their JSON type
+	valueCondition := func(valueExpr string) (string, []interface{}) {
+		switch f.Value.(type) {
+		case string, float64:
+			return " AND " + valueExpr + " = ?", []interface{}{f.Value}
+		default:
+			return "", nil
+		}
+	}
+
+	if f.Op == DataContains {
+		cond, args := valueCondition("json_each.value")
+		return fmt.Sprintf(
+			"json_type(data, ?) = 'array' AND EXISTS (SELECT 1 FROM json_each(data, ?) WHERE %s%s)",
+			typeCondition("json_each.type"), cond,
+		), append([]interface{}{f.jsonPath(), f.jsonPath()}, args...)
+	}
+
+	cond, args := valueCondition("json_extract(data, ?)")
+	if len(args) > 0 {
+		args = []interface{}{f.jsonPath(), f.Value}
+	}
+	return typeCondition("json_type(data, ?)") + cond, append([]interface{}{f.jsonPath()}, args...)
+}
+
+// matches evaluates the filter against decoded content data in Go, with the
+// same semantics as the SQL implementations
+func (f DataFilter) matches(data map[string]interface{}) bool {
+	var value interface{} = data
+	for _, k := range f.Path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if value, ok = object[k]; !ok {
+			return false
+		}
+	}
+
+	if f.Op == DataContains {
+		array, ok := value.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, item := range array {
+			if jsonScalarEqual(item, f.Value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return jsonScalarEqual(value, f.Value)
+}
+
+// jsonScalarEqual compares two decoded JSON values, treating all numbers as
+// float64 and never matching objects or arrays
+func jsonScalarEqual(a, b interface{}) bool {
+	switch av := a.(type) {
+	case string, bool, nil:
+		return a == b
+	case float64:
+		bv, ok := b.(float64)
+		return ok && av == bv
+	case int:
+		bv, ok := b.(float64)
+		return ok && float64(av) == bv
+	case int64:
+		bv, ok := b.(float64)
+		return ok && float64(av) == bv
+	default:
+		return false
+	}
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// TestDataFilters runs the same data filters against every store, so that
+// Postgres containment, the SQLite JSON functions and the in-memory matcher
+// are held to identical semantics
+func TestDataFilters(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store ContentStore) {
+		// Every item carries the run, so that runs sharing a Postgres
+		// database only see their own content
+		run := strings.ToLower(ulid.Make().String())
+		items := map[string]map[string]interface{}{
+			"programming": {
+				"category": "programming",
+				"tags":     []interface{}{"go", "sql"},
+				"meta":     map[string]interface{}{"lang": "en", "level": 2},
+				"count":    1,
+				"code":     "1",
+				"featured": true,
+			},
+			"cooking": {
+				"category": "cooking",
+				"tags":     []interface{}{"baking"},
+				"meta":     map[string]interface{}{"lang": "sv"},
+				"count":    "1",
+				"code":     1.0,
+				"featured": false,
+				"rating":   nil,
+			},
+			"empty": {},
+			"shapes": {
+				"category": []interface{}{"programming"},
+				"tags":     "go",
+				"meta":     "en",
+			},
+		}
+		names := map[string]string{} // content ID -> item name
+		for name, data := range items {
+			data["run"] = run
+			names[createTestContent(t, store, data).ID] = name
+		}
+
+		tests := []struct {
+			name    string
+			filters map[string]string // query parameters
+			want    []string          // names of the matching items
+		}{
+			{"eq string, not an array holding it", map[string]string{"data.category": "programming"}, []string{"programming"}},
+			{"eq quoted string", map[string]string{"data.category": `"cooking"`}, []string{"cooking"}},
+			{"eq true", map[string]string{"data.featured": "true"}, []string{"programming"}},
+			{"eq false", map[string]string{"data.featured": "false"}, []string{"cooking"}},
+			{"eq null", map[string]string{"data.rating": "null"}, []string{"cooking"}},
+			{"contains on array", map[string]string{"data.tags": "contains:go"}, []string{"programming"}},
+			{"contains other element", map[string]string{"data.tags": "contains:baking"}, []string{"cooking"}},
+			{"contains no element", map[string]string{"data.tags": "contains:rust"}, nil},
+			{"contains on object", map[string]string{"data.meta": "contains:en"}, nil},
+			{"eq on array", map[string]string{"data.tags": "go"}, []string{"shapes"}},
+			{"nested string", map[string]string{"data.meta.lang": "sv"}, []string{"cooking"}},
+			{"nested number", map[string]string{"data.meta.level": "2"}, []string{"programming"}},
+			{"nested path through scalar", map[string]string{"data.meta.lang.code": "en"}, nil},
+			{"missing key", map[string]string{"data.missing": "x"}, nil},
+			{"missing nested key", map[string]string{"data.meta.missing": "1"}, nil},
+			{"missing key is not null", map[string]string{"data.missing": "null"}, nil},
+			{"number does not match string", map[string]string{"data.count": "1"}, []string{"programming"}},
+			{"string does not match number", map[string]string{"data.count": `"1"`}, []string{"cooking"}},
+			{"integer matches float", map[string]string{"data.code": "1.0"}, []string{"cooking"}},
+			{"all filters must match", map[string]string{"data.category": "programming", "data.tags": "contains:sql"}, []string{"programming"}},
+			{"one filter fails", map[string]string{"data.category": "programming", "data.tags": "contains:baking"}, nil},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				opts := ListOptions{Limit: MaxListLimit}
+				filters := maps.Clone(tt.filters)
+				filters["data.run"] = run
+				for key, value := range filters {
+					filter, err := ParseDataFilter(key, value)
+					if err != nil {
+						t.Fatalf("ParseDataFilter(%q, %q): %v", key, value, err)
+					}
+					opts.DataFilters = append(opts.DataFilters, filter)
+				}
+
+				page, err := store.List(context.Background(), opts)
+				if err != nil {
+					t.Fatalf("List: %v", err)
+				}
+				var got []string
+				for _, content := range page.Items {
+					got = append(got, names[content.ID])
+				}
+				slices.Sort(got)
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
+}
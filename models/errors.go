@@ -0,0 +1,118 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+)
+
+var (
+	// ErrNotFound is returned when no content exists with the requested ID
+	ErrNotFound = errors.New("content not found")
+
+	// ErrConflict is returned when a write clashes with existing content, such
+	// as creating content with an ID that is already taken
+	ErrConflict = errors.New("content conflict")
+
+	// ErrUnavailable is returned when the database cannot be reached or is
+	// temporarily unable to serve the request (dropped connection, database
+	// shutting down, SQLite database locked); retrying later may succeed
+	ErrUnavailable = errors.New("database unavailable")
+
+	// ErrCanceled is returned when a store operation is aborted because the
+	// caller's context was canceled (e.g. the HTTP client disconnected)
+	ErrCanceled = errors.New("operation canceled")
+
+	// ErrDeadlineExceeded is returned when a store operation is aborted because
+	// the caller's context deadline passed (e.g. the server write timeout fired)
+	ErrDeadlineExceeded = errors.New("operation deadline exceeded")
+
+	// ErrVersionConflict is returned by versioned writes when the record was
+	// changed by another writer since it was read
+	ErrVersionConflict = errors.New("content version conflict")
+)
+
+// ConstraintKind identifies the kind of database constraint a write violated
+type ConstraintKind string
+
+const (
+	ConstraintUnique     ConstraintKind = "unique"
+	ConstraintNotNull    ConstraintKind = "not_null"
+	ConstraintCheck      ConstraintKind = "check"
+	ConstraintForeignKey ConstraintKind = "foreign_key"
+)
+
+// ConstraintError is returned when a write violates a database constraint.
+// Unique violations also match ErrConflict with errors.Is.
+type ConstraintError struct {
+	Kind       ConstraintKind
+	Constraint string // constraint or column name, if the driver reports one
+	Err        error
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("%s constraint violated: %v", e.Kind, e.Err)
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports unique violations as ErrConflict
+func (e *ConstraintError) Is(target error) bool {
+	return target == ErrConflict && e.Kind == ConstraintUnique
+}
+
+var (
+	canceledCount         atomic.Int64
+	deadlineExceededCount atomic.Int64
+)
+
+// CancellationStats returns the number of store operations aborted by context
+// cancellation and by deadline expiry since the process started
+func CancellationStats() (canceled, deadlineExceeded int64) {
+	return canceledCount.Load(), deadlineExceededCount.Load()
+}
+
+// wrapError wraps a driver error with the given message, translating context
+// cancellation into ErrCanceled or ErrDeadlineExceeded, connection failures
+// into ErrUnavailable and constraint violations into a ConstraintError, so
+// callers can tell them apart from genuine database failures
+func wrapError(ctx context.Context, msg string, err error) error {
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+		canceledCount.Add(1)
+		return fmt.Errorf("%s: %w: %w", msg, ErrCanceled, err)
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		deadlineExceededCount.Add(1)
+		return fmt.Errorf("%s: %w: %w", msg, ErrDeadlineExceeded, err)
+	default:
+		return fmt.Errorf("%s: %w", msg, classifyError(err))
+	}
+}
+
+// classifyError translates driver errors into the errors of this package,
+// returning err unchanged if it is none of them
+func classifyError(err error) error {
+	if classified := postgresError(err); classified != nil {
+		return classified
+	}
+	if classified := sqliteError(err); classified != nil {
+		return classified
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr),
+		errors.Is(err, driver.ErrBadConn),
+		errors.Is(err, sql.ErrConnDone),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
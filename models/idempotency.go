@@ -0,0 +1,48 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// IdempotencyKey records a create made with an Idempotency-Key header and the
+// content it created, so that a retry of the same request can be answered
+// with the original response instead of creating the content again. A key is
+// live until ExpiresAt, after which it may be reused for a new request.
+type IdempotencyKey struct {
+	Caller      string // identity of the caller that sent the key, which the key is scoped to
+	Key         string
+	RequestHash string          // identifies the request body the key was first used with
+	ContentID   string          // set by CreateIdempotent
+	Response    json.RawMessage // the content as created, set by CreateIdempotent
+	CreatedAt   time.Time       // set by CreateIdempotent
+	ExpiresAt   time.Time
+}
+
+// idempotencyKeyID identifies an idempotency key within the keys of all callers
+type idempotencyKeyID struct {
+	caller, key string
+}
+
+// complete fills in the fields of key describing the content it created
+func (key *IdempotencyKey) complete(content *Content) error {
+	response, err := json.Marshal(content)
+	if err != nil {
+		return fmt.Errorf("failed to marshal response: %w", err)
+	}
+	key.ContentID = content.ID
+	key.Response = response
+	key.CreatedAt = content.CreatedAt
+	return nil
+}
+
+// errIdempotencyKeyExists reports a live idempotency key taken by another
+// request
+func errIdempotencyKeyExists(key string) error {
+	return fmt.Errorf("failed to save idempotency key: %w", &ConstraintError{
+		Kind:       ConstraintUnique,
+		Constraint: "idempotency_keys.key",
+		Err:        fmt.Errorf("idempotency key %s already exists", key),
+	})
+}
@@ -0,0 +1,189 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultListLimit is the page size used when none is requested
+	DefaultListLimit = 100
+	// MaxListLimit is the largest page size a caller may request
+	MaxListLimit = 1000
+)
+
+// SortField is a column that List results can be ordered by
+type SortField string
+
+const (
+	SortCreatedAt SortField = "created_at"
+	SortUpdatedAt SortField = "updated_at"
+	SortTitle     SortField = "title"
+	SortAuthor    SortField = "author"
+	SortStatus    SortField = "status"
+)
+
+// sortFields is the whitelist of columns List may order by. The values are
+// interpolated into SQL, so nothing else may ever be accepted.
+var sortFields = map[SortField]bool{
+	SortCreatedAt: true,
+	SortUpdatedAt: true,
+	SortTitle:     true,
+	SortAuthor:    true,
+	SortStatus:    true,
+}
+
+// isTime reports whether the field holds a timestamp rather than text
+func (f SortField) isTime() bool {
+	return f == SortCreatedAt || f == SortUpdatedAt
+}
+
+// Sort describes the order of List results. Ties are broken by id in the same
+// direction, so every ordering is total and usable for keyset pagination.
+type Sort struct {
+	Field SortField
+	Desc  bool
+}
+
+// DefaultSort lists the newest content first
+var DefaultSort = Sort{Field: SortCreatedAt, Desc: true}
+
+// ParseSort parses a sort expression such as "title" (ascending) or
+// "-created_at" (descending)
+func ParseSort(s string) (Sort, error) {
+	if s == "" {
+		return DefaultSort, nil
+	}
+
+	sort := Sort{Field: SortField(strings.TrimPrefix(s, "-")), Desc: strings.HasPrefix(s, "-")}
+	if !sortFields[sort.Field] {
+		return Sort{}, fmt.Errorf("unsupported sort field: %q", sort.Field)
+	}
+
+	return sort, nil
+}
+
+// String returns the sort expression accepted by ParseSort
+func (s Sort) String() string {
+	if s.Desc {
+		return "-" + string(s.Field)
+	}
+	return string(s.Field)
+}
+
+// direction returns the SQL ORDER BY direction
+func (s Sort) direction() string {
+	if s.Desc {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// keysetOperator returns the SQL comparison selecting rows after a cursor
+func (s Sort) keysetOperator() string {
+	if s.Desc {
+		return "<"
+	}
+	return ">"
+}
+
+// key returns the value of the sort field for the given content
+func (s Sort) key(content *Content) interface{} {
+	switch s.Field {
+	case SortUpdatedAt:
+		return content.UpdatedAt
+	case SortTitle:
+		return content.Title
+	case SortAuthor:
+		return content.Author
+	case SortStatus:
+		return content.Status
+	default:
+		return content.CreatedAt
+	}
+}
+
+// ListOptions controls which content List returns and in which order
+type ListOptions struct {
+	Limit int     // page size, DefaultListLimit if zero
+	After *Cursor // position to continue from, nil for the first page
+	Sort  Sort    // result order, DefaultSort if zero
+
+	Status        string        // only content with this status
+	Author        string        // only content by this author
+	CreatedAfter  *time.Time    // only content created strictly after this time
+	CreatedBefore *time.Time    // only content created strictly before this time
+	UpdatedSince  *time.Time    // only content updated at or after this time
+	VisibleAt     *time.Time    // only content whose publish_at/expire_at window contains this time
+	DataFilters   []DataFilter  // only content whose data matches all of these
+	Access        *AccessFilter // only content the caller may see, nil for all
+	Deleted       bool          // list the trash instead of live content
+}
+
+// AccessFilter restricts List and Search to the content a caller may see:
+// content by one author, published content, or either. The zero value
+// matches nothing.
+type AccessFilter struct {
+	Author    string // content by this author, empty for none
+	Published bool   // content with status published
+}
+
+// condition returns the SQL condition of the filter, with columns qualified
+// by prefix and values added through arg, which returns their placeholder
+func (f *AccessFilter) condition(prefix string, arg func(value interface{}) string) string {
+	var alternatives []string
+	if f.Author != "" {
+		alternatives = append(alternatives, prefix+"author = "+arg(f.Author))
+	}
+	if f.Published {
+		alternatives = append(alternatives, prefix+"status = "+arg("published"))
+	}
+	if len(alternatives) == 0 {
+		return "1 = 0"
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")"
+}
+
+// matches reports whether content passes the filter
+func (f *AccessFilter) matches(content *Content) bool {
+	return (f.Author != "" && content.Author == f.Author) ||
+		(f.Published && content.Status == "published")
+}
+
+// limit returns the effective page size
+func (o ListOptions) limit() int {
+	if o.Limit <= 0 {
+		return DefaultListLimit
+	}
+	if o.Limit > MaxListLimit {
+		return MaxListLimit
+	}
+	return o.Limit
+}
+
+// sort returns the effective result order
+func (o ListOptions) sort() Sort {
+	if o.Sort.Field == "" {
+		return DefaultSort
+	}
+	return o.Sort
+}
+
+// ContentPage is a single page of List results
+type ContentPage struct {
+	Items []*Content
+	Next  *Cursor // nil when there are no more rows
+}
+
+// newContentPage builds a page from up to limit+1 rows fetched by a store,
+// using the extra row only to detect whether a next page exists
+func newContentPage(contents []*Content, opts ListOptions) *ContentPage {
+	limit := opts.limit()
+	page := &ContentPage{Items: contents}
+	if len(contents) > limit {
+		page.Items = contents[:limit]
+		page.Next = CursorFor(opts.sort(), page.Items[limit-1])
+	}
+	return page
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// TestAccessFilterCondition checks the SQL the filter adds, which matches
+// nothing for the zero value rather than everything
+func TestAccessFilterCondition(t *testing.T) {
+	tests := []struct {
+		name      string
+		filter    AccessFilter
+		condition string
+		args      []interface{}
+	}{
+		{"zero", AccessFilter{}, "1 = 0", nil},
+		{"author", AccessFilter{Author: "alice"}, "(c.author = $1)", []interface{}{"alice"}},
+		{"published", AccessFilter{Published: true}, "(c.status = $1)", []interface{}{"published"}},
+		{"either", AccessFilter{Author: "alice", Published: true}, "(c.author = $1 OR c.status = $2)", []interface{}{"alice", "published"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var args []interface{}
+			condition := tt.filter.condition("c.", func(value interface{}) string {
+				args = append(args, value)
+				return fmt.Sprintf("$%d", len(args))
+			})
+			if condition != tt.condition || !slices.Equal(args, tt.args) {
+				t.Errorf("got %q %v, want %q %v", condition, args, tt.condition, tt.args)
+			}
+		})
+	}
+}
+
+// TestAccessFilter runs the same access filters through List and Search of
+// every store, so that the SQL conditions and the in-memory matcher agree
+func TestAccessFilter(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store ContentStore) {
+		ctx := context.Background()
+
+		// Authors and the searched body carry the run, so that runs sharing
+		// a Postgres database only see their own content
+		run := strings.ToLower(ulid.Make().String())
+		alice, bob := "alice-"+run, "bob-"+run
+		items := map[string]struct{ author, status string }{
+			"alice draft":     {alice, "draft"},
+			"alice published": {alice, "published"},
+			"bob draft":       {bob, "draft"},
+			"bob published":   {bob, "published"},
+			"bob archived":    {bob, "archived"},
+		}
+		names := map[string]string{} // content ID -> item name
+		for name, item := range items {
+			content := &Content{
+				ID:     strings.ToLower(ulid.Make().String()),
+				Title:  "Access " + name,
+				Body:   "Access test " + run,
+				Author: item.author,
+				Status: item.status,
+				Data:   map[string]interface{}{"run": run},
+			}
+			if err := store.Create(ctx, content); err != nil {
+				t.Fatalf("failed to create content: %v", err)
+			}
+			names[content.ID] = name
+		}
+		runFilter, err := ParseDataFilter("data.run", run)
+		if err != nil {
+			t.Fatalf("ParseDataFilter: %v", err)
+		}
+
+		tests := []struct {
+			name   string
+			access *AccessFilter
+			want   []string
+		}{
+			{"none", nil, []string{"alice draft", "alice published", "bob archived", "bob draft", "bob published"}},
+			{"zero", &AccessFilter{}, nil},
+			{"author", &AccessFilter{Author: alice}, []string{"alice draft", "alice published"}},
+			{"published", &AccessFilter{Published: true}, []string{"alice published", "bob published"}},
+			{"author or published", &AccessFilter{Author: alice, Published: true}, []string{"alice draft", "alice published", "bob published"}},
+			{"other author", &AccessFilter{Author: "carol-" + run}, nil},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				page, err := store.List(ctx, ListOptions{Limit: MaxListLimit, DataFilters: []DataFilter{runFilter}, Access: tt.access})
+				if err != nil {
+					t.Fatalf("List: %v", err)
+				}
+				var got []string
+				for _, content := range page.Items {
+					got = append(got, names[content.ID])
+				}
+				slices.Sort(got)
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("List got %v, want %v", got, tt.want)
+				}
+
+				results, err := store.Search(ctx, SearchOptions{Query: run, Limit: MaxSearchLimit, Access: tt.access})
+				if err != nil {
+					t.Fatalf("Search: %v", err)
+				}
+				got = nil
+				for _, result := range results {
+					got = append(got, names[result.Content.ID])
+				}
+				slices.Sort(got)
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("Search got %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
+}
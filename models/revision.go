@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+)
+
+// RevisionOperation is the kind of write that produced a revision
+type RevisionOperation string
+
+const (
+	RevisionCreate   RevisionOperation = "create"
+	RevisionUpdate   RevisionOperation = "update"
+	RevisionDelete   RevisionOperation = "delete"
+	RevisionUndelete RevisionOperation = "undelete"
+)
+
+// Revision is a snapshot of content as left by one create, update, delete or
+// undelete. Revisions are numbered per content from 1 and are kept while the
+// content is in the trash; purging the content removes them too. The SQL
+// stores write them from triggers, in the same transaction as the write they
+// record.
+type Revision struct {
+	ContentID  string                 `json:"content_id"`
+	Revision   int                    `json:"revision"`
+	Operation  RevisionOperation      `json:"operation" enum:"create,update,delete,undelete"`
+	Version    int                    `json:"version" doc:"Version of the content captured by the revision"`
+	Title      string                 `json:"title"`
+	Body       string                 `json:"body"`
+	Author     string                 `json:"author"`
+	Status     string                 `json:"status"`
+	Data       map[string]interface{} `json:"data"`
+	RecordedAt time.Time              `json:"recorded_at"`
+}
+
+// newRevision captures the current state of content
+func newRevision(content *Content, revision int, operation RevisionOperation, recordedAt time.Time) *Revision {
+	return &Revision{
+		ContentID:  content.ID,
+		Revision:   revision,
+		Operation:  operation,
+		Version:    content.Version,
+		Title:      content.Title,
+		Body:       content.Body,
+		Author:     content.Author,
+		Status:     content.Status,
+		Data:       cloneData(content.Data),
+		RecordedAt: recordedAt,
+	}
+}
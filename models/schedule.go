@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// scheduleDue reports whether content is a draft whose publish_at or
+// published content whose expire_at is at or before t
+func scheduleDue(content *Content, t time.Time) bool {
+	switch content.Status {
+	case "draft":
+		return content.PublishAt != nil && !content.PublishAt.After(t)
+	case "published":
+		return content.ExpireAt != nil && !content.ExpireAt.After(t)
+	}
+	return false
+}
+
+// visibleAt reports whether t lies within the publish_at/expire_at window of
+// content, either end of which may be open
+func visibleAt(content *Content, t time.Time) bool {
+	if content.PublishAt != nil && content.PublishAt.After(t) {
+		return false
+	}
+	if content.ExpireAt != nil && !content.ExpireAt.After(t) {
+		return false
+	}
+	return true
+}
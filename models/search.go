@@ -0,0 +1,157 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	// DefaultSearchLimit is the number of results returned when none is requested
+	DefaultSearchLimit = 20
+	// MaxSearchLimit is the largest number of results a caller may request
+	MaxSearchLimit = 100
+
+	// HighlightStart and HighlightEnd surround matched terms in snippets
+	HighlightStart = "<mark>"
+	HighlightEnd   = "</mark>"
+
+	// snippetEllipsis marks text left out of a snippet
+	snippetEllipsis = "…"
+	// snippetWords is the approximate number of words in a body snippet
+	snippetWords = 16
+)
+
+// SearchOptions controls a full-text search over title and body
+type SearchOptions struct {
+	Query  string        // free text, all words must match
+	Limit  int           // maximum number of results, DefaultSearchLimit if zero
+	Access *AccessFilter // only content the caller may see, nil for all
+}
+
+// limit returns the effective number of results
+func (o SearchOptions) limit() int {
+	if o.Limit <= 0 {
+		return DefaultSearchLimit
+	}
+	if o.Limit > MaxSearchLimit {
+		return MaxSearchLimit
+	}
+	return o.Limit
+}
+
+// SearchResult is a single full-text search hit
+type SearchResult struct {
+	Content      *Content
+	Rank         float64 // relevance, higher is better; only comparable within one search
+	TitleSnippet string  // title with matched terms highlighted
+	BodySnippet  string  // excerpt of the body around the matches, highlighted
+}
+
+// searchWordPattern matches the words that searches operate on
+var searchWordPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// searchTerms splits free text into lowercase search words
+func searchTerms(query string) []string {
+	words := searchWordPattern.FindAllString(query, -1)
+	for i, word := range words {
+		words[i] = strings.ToLower(word)
+	}
+	return words
+}
+
+// fts5Query converts free text into an FTS5 MATCH expression in which every
+// word is quoted, so user input can never be parsed as FTS5 query syntax
+func fts5Query(query string) string {
+	terms := searchTerms(query)
+	for i, term := range terms {
+		terms[i] = `"` + term + `"`
+	}
+	return strings.Join(terms, " ")
+}
+
+// matchSearch scores content against the search terms in Go, for the memory
+// store. Every term must occur as a word in the title or body; title matches
+// weigh more than body matches. It reports false if the content does not match.
+func matchSearch(content *Content, terms []string) (*SearchResult, bool) {
+	titleCounts := countWords(content.Title)
+	bodyCounts := countWords(content.Body)
+
+	var rank float64
+	for _, term := range terms {
+		title, body := titleCounts[term], bodyCounts[term]
+		if title == 0 && body == 0 {
+			return nil, false
+		}
+		rank += float64(2*title + body)
+	}
+
+	return &SearchResult{
+		Content:      content,
+		Rank:         rank,
+		TitleSnippet: highlightSnippet(content.Title, terms, 0),
+		BodySnippet:  highlightSnippet(content.Body, terms, snippetWords),
+	}, true
+}
+
+// countWords counts the lowercase words in text
+func countWords(text string) map[string]int {
+	counts := map[string]int{}
+	for _, word := range searchTerms(text) {
+		counts[word]++
+	}
+	return counts
+}
+
+// highlightSnippet wraps the search terms in text with highlight markers. If
+// maxWords is positive only a window of that many words around the first
+// match is returned, with ellipses marking the cut.
+func highlightSnippet(text string, terms []string, maxWords int) string {
+	isTerm := map[string]bool{}
+	for _, term := range terms {
+		isTerm[term] = true
+	}
+
+	words := searchWordPattern.FindAllStringIndex(text, -1)
+	start, end := 0, len(words)
+	if maxWords > 0 && len(words) > maxWords {
+		first := 0
+		for i, w := range words {
+			if isTerm[strings.ToLower(text[w[0]:w[1]])] {
+				first = i
+				break
+			}
+		}
+		start = max(0, first-maxWords/4)
+		end = min(len(words), start+maxWords)
+		start = max(0, end-maxWords)
+	}
+	if start >= end {
+		return text
+	}
+
+	var b strings.Builder
+	from := 0
+	if start > 0 {
+		b.WriteString(snippetEllipsis)
+		from = words[start][0]
+	}
+	for _, w := range words[start:end] {
+		b.WriteString(text[from:w[0]])
+		word := text[w[0]:w[1]]
+		if isTerm[strings.ToLower(word)] {
+			b.WriteString(HighlightStart + word + HighlightEnd)
+		} else {
+			b.WriteString(word)
+		}
+		from = w[1]
+	}
+	if end < len(words) {
+		b.WriteString(strings.TrimRightFunc(text[from:words[end][0]], unicode.IsSpace))
+		b.WriteString(snippetEllipsis)
+	} else {
+		b.WriteString(text[from:])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,7 @@
+//go:build sqlite_fts5
+
+package models
+
+// sqliteFTS5 reports whether go-sqlite3 was built with the FTS5 extension,
+// which the full-text search migration and queries need
+const sqliteFTS5 = true
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// testPostgresURLEnv names the variable holding the connection string of a
+// migrated Postgres database to run the store tests against. Postgres is
+// skipped when it is not set.
+const testPostgresURLEnv = "TEST_DATABASE_URL"
+
+// testStores returns a store of each engine, by engine name: a fresh memory
+// store, a fresh SQLite database with the migrations applied and, if
+// TEST_DATABASE_URL is set, Postgres. SQLite needs the sqlite_fts5 build tag,
+// without which the test fails rather than pass without exercising it.
+// Stores are closed when the test finishes.
+func testStores(t *testing.T) map[string]ContentStore {
+	t.Helper()
+
+	stores := map[string]ContentStore{"memory": NewMemoryContentStore()}
+	stores["sqlite"] = testSQLiteStore(t)
+	if url := os.Getenv(testPostgresURLEnv); url != "" {
+		store, err := NewPostgresContentStore(url)
+		if err != nil {
+			t.Fatalf("failed to open Postgres store: %v", err)
+		}
+		stores["postgres"] = store
+	} else {
+		t.Logf("%s not set, skipping Postgres", testPostgresURLEnv)
+	}
+
+	for _, store := range stores {
+		t.Cleanup(func() { store.Close() })
+	}
+	return stores
+}
+
+// testSQLiteStore creates a SQLite database in a temporary directory and
+// applies the up migrations to it
+func testSQLiteStore(t *testing.T) *SQLiteContentStore {
+	t.Helper()
+
+	if !sqliteFTS5 {
+		t.Fatal("SQLite is built without FTS5, run the tests with -tags sqlite_fts5")
+	}
+
+	path := filepath.Join(t.TempDir(), "content-api.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+
+	migrations, err := filepath.Glob("../db/sqlite/migrations/*.up.sql")
+	if err != nil || len(migrations) == 0 {
+		t.Fatalf("failed to find SQLite migrations: %v", err)
+	}
+	for _, migration := range migrations {
+		statements, err := os.ReadFile(migration)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", migration, err)
+		}
+		if _, err := db.Exec(string(statements)); err != nil {
+			t.Fatalf("failed to apply %s: %v", migration, err)
+		}
+	}
+
+	store, err := NewSQLiteContentStore(path + "?_journal_mode=WAL")
+	if err != nil {
+		t.Fatalf("failed to open SQLite store: %v", err)
+	}
+	return store
+}
+
+// forEachStore runs fn as a subtest against a store of each engine
+func forEachStore(t *testing.T, fn func(t *testing.T, store ContentStore)) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) { fn(t, store) })
+	}
+}
+
+// createTestContent creates draft content with the given data, under an ID
+// that is unique across test runs sharing a Postgres database
+func createTestContent(t *testing.T, store ContentStore, data map[string]interface{}) *Content {
+	t.Helper()
+
+	content := &Content{
+		ID:     strings.ToLower(ulid.Make().String()),
+		Title:  "Test content",
+		Body:   "Test body",
+		Author: "tester",
+		Status: "draft",
+		Data:   data,
+	}
+	if err := store.Create(context.Background(), content); err != nil {
+		t.Fatalf("failed to create content: %v", err)
+	}
+	return content
+}
@@ -0,0 +1,245 @@
+// Package policy decides what callers may do with content. A policy file
+// grants roles to callers and permissions to roles; permissions may be
+// limited to the caller's own content or to published content.
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/seenthis-ab/content-api/middleware"
+	"github.com/seenthis-ab/content-api/models"
+)
+
+// Action is something a caller does with content
+type Action string
+
+const (
+	ActionRead    Action = "read"
+	ActionCreate  Action = "create"
+	ActionUpdate  Action = "update"  // title, body, author and data
+	ActionPublish Action = "publish" // status and the publishing schedule
+	ActionDelete  Action = "delete"  // including undelete and the trash
+)
+
+// actions is the set of actions permissions may name
+var actions = []Action{ActionRead, ActionCreate, ActionUpdate, ActionPublish, ActionDelete}
+
+// Conditions that limit a permission to some content, written after the
+// action as in "update:own"
+const (
+	conditionOwn       = "own"       // content whose author is the subject of the caller's bearer token
+	conditionPublished = "published" // content with status published
+)
+
+// File is the format of a policy file
+type File struct {
+	Roles          map[string][]string `json:"roles"`           // role name -> permissions such as "read" or "update:own"
+	AnonymousRoles []string            `json:"anonymous_roles"` // roles of callers without credentials
+	DefaultRoles   []string            `json:"default_roles"`   // roles of every authenticated caller
+	RolesClaim     string              `json:"roles_claim"`     // bearer token claim listing further roles, "roles" if empty
+	Subjects       map[string][]string `json:"subjects"`        // bearer token subject -> roles
+	APIKeys        map[string][]string `json:"api_keys"`        // API key ID -> roles
+}
+
+// permission allows an action, on all content unless limited by a condition
+type permission struct {
+	action    Action
+	condition string
+}
+
+// Policy grants permissions to callers. A nil Policy allows everything.
+type Policy struct {
+	file  File
+	roles map[string][]permission
+}
+
+// DeniedError reports an action the caller may not perform
+type DeniedError struct {
+	Action Action
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("not allowed to %s this content", e.Action)
+}
+
+// Load reads a policy file, rejecting unknown fields, permissions and roles
+// so that mistakes do not silently grant or withhold access. An empty path
+// returns a nil Policy, which allows everything.
+func Load(path string) (*Policy, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var file File
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", path, err)
+	}
+	if file.RolesClaim == "" {
+		file.RolesClaim = "roles"
+	}
+
+	p := &Policy{file: file, roles: map[string][]permission{}}
+	for role, grants := range file.Roles {
+		for _, grant := range grants {
+			perm, err := parsePermission(grant)
+			if err != nil {
+				return nil, fmt.Errorf("invalid policy file %s: role %q: %w", path, role, err)
+			}
+			p.roles[role] = append(p.roles[role], perm)
+		}
+	}
+
+	assigned := slices.Concat(file.AnonymousRoles, file.DefaultRoles)
+	for _, roles := range file.Subjects {
+		assigned = append(assigned, roles...)
+	}
+	for _, roles := range file.APIKeys {
+		assigned = append(assigned, roles...)
+	}
+	for _, role := range assigned {
+		if _, ok := file.Roles[role]; !ok {
+			return nil, fmt.Errorf("invalid policy file %s: role %q is not defined", path, role)
+		}
+	}
+
+	return p, nil
+}
+
+// parsePermission parses a permission such as "read" or "update:own"
+func parsePermission(s string) (permission, error) {
+	action, condition, _ := strings.Cut(s, ":")
+	perm := permission{action: Action(action), condition: condition}
+	if !slices.Contains(actions, perm.action) {
+		return permission{}, fmt.Errorf("unknown action %q", action)
+	}
+	if condition != "" && condition != conditionOwn && condition != conditionPublished {
+		return permission{}, fmt.Errorf("unknown condition %q", condition)
+	}
+	return perm, nil
+}
+
+// allows reports whether the permission covers the content for the subject
+func (perm permission) allows(content *models.Content, subject string) bool {
+	switch perm.condition {
+	case conditionOwn:
+		return subject != "" && content.Author == subject
+	case conditionPublished:
+		return content.Status == "published"
+	}
+	return true
+}
+
+// principal is the caller of a request as far as the policy is concerned
+type principal struct {
+	subject     string // sub claim of the bearer token, empty for API keys
+	permissions []permission
+}
+
+// principal collects the permissions of all roles of the caller
+func (p *Policy) principal(ctx context.Context) principal {
+	caller := middleware.GetCaller(ctx)
+	if caller == nil || caller.Anonymous() {
+		return principal{permissions: p.permissions(p.file.AnonymousRoles)}
+	}
+
+	roles := slices.Clone(p.file.DefaultRoles)
+	var subject string
+	if caller.APIKeyID != "" {
+		roles = append(roles, p.file.APIKeys[caller.APIKeyID]...)
+	}
+	if caller.Claims != nil {
+		subject = caller.Claims.Subject
+		roles = append(roles, p.file.Subjects[subject]...)
+		roles = append(roles, claimRoles(caller.Claims.Raw[p.file.RolesClaim])...)
+	}
+	return principal{subject: subject, permissions: p.permissions(roles)}
+}
+
+// permissions returns the permissions of the given roles, ignoring roles the
+// policy does not define, such as unrelated ones from a token
+func (p *Policy) permissions(roles []string) []permission {
+	var perms []permission
+	for _, role := range roles {
+		perms = append(perms, p.roles[role]...)
+	}
+	return perms
+}
+
+// claimRoles reads the roles in a token claim holding a list of strings or
+// a space separated string
+func claimRoles(claim any) []string {
+	switch claim := claim.(type) {
+	case string:
+		return strings.Fields(claim)
+	case []any:
+		var roles []string
+		for _, role := range claim {
+			if role, ok := role.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+		return roles
+	}
+	return nil
+}
+
+// Authorize returns a DeniedError unless the caller may perform the action on
+// the content. For creates, the content is the content to be created.
+func (p *Policy) Authorize(ctx context.Context, action Action, content *models.Content) error {
+	if p == nil {
+		return nil
+	}
+
+	caller := p.principal(ctx)
+	for _, perm := range caller.permissions {
+		if perm.action == action && perm.allows(content, caller.subject) {
+			return nil
+		}
+	}
+	return &DeniedError{Action: action}
+}
+
+// Filter returns the filter selecting the content on which the caller may
+// perform the action, nil if that is all content, or a DeniedError if the
+// caller may not perform it on any content
+func (p *Policy) Filter(ctx context.Context, action Action) (*models.AccessFilter, error) {
+	if p == nil {
+		return nil, nil
+	}
+
+	caller := p.principal(ctx)
+	var filter *models.AccessFilter
+	for _, perm := range caller.permissions {
+		if perm.action != action {
+			continue
+		}
+		if filter == nil {
+			filter = &models.AccessFilter{}
+		}
+		switch perm.condition {
+		case "":
+			return nil, nil
+		case conditionOwn:
+			filter.Author = caller.subject
+		case conditionPublished:
+			filter.Published = true
+		}
+	}
+	if filter == nil {
+		return nil, &DeniedError{Action: action}
+	}
+	return filter, nil
+}
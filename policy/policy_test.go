@@ -0,0 +1,213 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/seenthis-ab/content-api/middleware"
+	"github.com/seenthis-ab/content-api/models"
+)
+
+// testPolicyFile grants every kind of permission, to roles assigned in each
+// of the ways a policy can assign them
+const testPolicyFile = `{
+  "roles": {
+    "reader": ["read:published"],
+    "author": ["read:published", "read:own", "create:own", "update:own"],
+    "editor": ["read", "create", "update", "publish"],
+    "admin": ["read", "create", "update", "publish", "delete"]
+  },
+  "anonymous_roles": ["reader"],
+  "default_roles": ["author"],
+  "roles_claim": "groups",
+  "subjects": {"carol": ["admin"]},
+  "api_keys": {"01kkey": ["editor"]}
+}`
+
+// writePolicy writes a policy file and returns its path
+func writePolicy(t *testing.T, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("failed to write policy file: %v", err)
+	}
+	return path
+}
+
+// testPolicy loads testPolicyFile
+func testPolicy(t *testing.T) *Policy {
+	t.Helper()
+
+	p, err := Load(writePolicy(t, testPolicyFile))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return p
+}
+
+// asCaller returns a context of a request by the caller
+func asCaller(caller *middleware.Caller) context.Context {
+	return context.WithValue(context.Background(), middleware.CallerKey, caller)
+}
+
+// asSubject returns a context of a request with a bearer token for the
+// subject, carrying claims such as the groups claim
+func asSubject(subject string, claims map[string]any) context.Context {
+	return asCaller(&middleware.Caller{Claims: &middleware.Claims{Subject: subject, Raw: claims}})
+}
+
+// TestLoad checks that mistakes in policy files are rejected when loading
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		err  string // part of the error, empty if the file is valid
+	}{
+		{"valid", testPolicyFile, ""},
+		{"empty", `{}`, ""},
+		{"invalid JSON", `{"roles": `, "invalid policy file"},
+		{"unknown field", `{"role": {}}`, `unknown field "role"`},
+		{"unknown action", `{"roles": {"a": ["edit"]}}`, `role "a": unknown action "edit"`},
+		{"unknown condition", `{"roles": {"a": ["read:mine"]}}`, `role "a": unknown condition "mine"`},
+		{"undefined anonymous role", `{"anonymous_roles": ["reader"]}`, `role "reader" is not defined`},
+		{"undefined default role", `{"default_roles": ["author"]}`, `role "author" is not defined`},
+		{"undefined subject role", `{"subjects": {"carol": ["admin"]}}`, `role "admin" is not defined`},
+		{"undefined API key role", `{"api_keys": {"01kkey": ["editor"]}}`, `role "editor" is not defined`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Load(writePolicy(t, tt.file))
+			if tt.err == "" {
+				if err != nil || p == nil {
+					t.Errorf("got %v, %v, want a policy", p, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+
+	if p, err := Load(""); p != nil || err != nil {
+		t.Errorf("Load without a path = %v, %v, want a nil policy", p, err)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Load of a missing file succeeded")
+	}
+	if p, err := Load("../config/policy.json"); p == nil || err != nil {
+		t.Errorf("Load of the example policy = %v, %v", p, err)
+	}
+}
+
+// TestAuthorize checks the permissions each kind of caller gets from its
+// roles, and the own and published conditions
+func TestAuthorize(t *testing.T) {
+	p := testPolicy(t)
+	aliceDraft := &models.Content{Author: "alice", Status: "draft"}
+	alicePublished := &models.Content{Author: "alice", Status: "published"}
+	bobDraft := &models.Content{Author: "bob", Status: "draft"}
+	unowned := &models.Content{Author: "", Status: "draft"}
+
+	anonymous := asCaller(&middleware.Caller{})
+	alice := asSubject("alice", nil)
+	editor := asSubject("dave", map[string]any{"groups": []any{"other", "editor"}})
+	spaced := asSubject("erin", map[string]any{"groups": "other admin"})
+	carol := asSubject("carol", nil)
+	apiKey := asCaller(&middleware.Caller{APIKeyID: "01kkey"})
+	otherKey := asCaller(&middleware.Caller{APIKeyID: "01kother"})
+	noSubject := asSubject("", nil)
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		action  Action
+		content *models.Content
+		allowed bool
+	}{
+		{"outside a request, published", context.Background(), ActionRead, alicePublished, true},
+		{"outside a request, draft", context.Background(), ActionRead, aliceDraft, false},
+		{"anonymous published", anonymous, ActionRead, alicePublished, true},
+		{"anonymous draft", anonymous, ActionRead, aliceDraft, false},
+		{"anonymous create", anonymous, ActionCreate, aliceDraft, false},
+		{"own draft", alice, ActionRead, aliceDraft, true},
+		{"other's draft", alice, ActionRead, bobDraft, false},
+		{"other's published", alice, ActionRead, &models.Content{Author: "bob", Status: "published"}, true},
+		{"create own", alice, ActionCreate, aliceDraft, true},
+		{"create for other", alice, ActionCreate, bobDraft, false},
+		{"update own", alice, ActionUpdate, aliceDraft, true},
+		{"update other's", alice, ActionUpdate, bobDraft, false},
+		{"publish own", alice, ActionPublish, aliceDraft, false},
+		{"delete own", alice, ActionDelete, aliceDraft, false},
+		{"role from claim list", editor, ActionPublish, bobDraft, true},
+		{"role from claim list, not delete", editor, ActionDelete, bobDraft, false},
+		{"role from claim string", spaced, ActionDelete, bobDraft, true},
+		{"role from subject", carol, ActionDelete, bobDraft, true},
+		{"role from API key", apiKey, ActionUpdate, bobDraft, true},
+		{"API key owns nothing", otherKey, ActionUpdate, unowned, false},
+		{"API key reads published", otherKey, ActionRead, alicePublished, true},
+		{"no subject owns nothing", noSubject, ActionRead, unowned, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.Authorize(tt.ctx, tt.action, tt.content)
+			if tt.allowed && err != nil {
+				t.Errorf("got %v, want allowed", err)
+			}
+			var denied *DeniedError
+			if !tt.allowed && (!errors.As(err, &denied) || denied.Action != tt.action) {
+				t.Errorf("got %v, want a DeniedError for %s", err, tt.action)
+			}
+		})
+	}
+
+	var nilPolicy *Policy
+	if err := nilPolicy.Authorize(anonymous, ActionDelete, aliceDraft); err != nil {
+		t.Errorf("nil policy denied: %v", err)
+	}
+}
+
+// TestFilter checks the access filters of callers: nil for all content, the
+// conditions of their permissions combined, or denied
+func TestFilter(t *testing.T) {
+	p := testPolicy(t)
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		action Action
+		filter *models.AccessFilter
+		denied bool
+	}{
+		{"anonymous read", asCaller(&middleware.Caller{}), ActionRead, &models.AccessFilter{Published: true}, false},
+		{"anonymous update", asCaller(&middleware.Caller{}), ActionUpdate, nil, true},
+		{"author read", asSubject("alice", nil), ActionRead, &models.AccessFilter{Author: "alice", Published: true}, false},
+		{"author update", asSubject("alice", nil), ActionUpdate, &models.AccessFilter{Author: "alice"}, false},
+		{"author delete", asSubject("alice", nil), ActionDelete, nil, true},
+		{"editor read", asSubject("dave", map[string]any{"groups": []any{"editor"}}), ActionRead, nil, false},
+		{"API key read", asCaller(&middleware.Caller{APIKeyID: "01kother"}), ActionRead, &models.AccessFilter{Published: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := p.Filter(tt.ctx, tt.action)
+			if tt.denied {
+				var denied *DeniedError
+				if !errors.As(err, &denied) {
+					t.Errorf("got %+v, %v, want a DeniedError", filter, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Filter: %v", err)
+			}
+			if (filter == nil) != (tt.filter == nil) || (filter != nil && *filter != *tt.filter) {
+				t.Errorf("got %+v, want %+v", filter, tt.filter)
+			}
+		})
+	}
+}
@@ -7,8 +7,12 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -33,6 +37,13 @@ type TestResult struct {
 	Duration  time.Duration `json:"duration_ns"`
 	Error     string        `json:"error,omitempty"`
 	Timestamp time.Time     `json:"timestamp"`
+	Timing    []Phase       `json:"server_timing,omitempty"` // phases of the Server-Timing header
+}
+
+// Phase is one metric of a Server-Timing header, such as db, encode or app
+type Phase struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration_ns"`
 }
 
 // TestSummary holds the summary of all test results
@@ -58,6 +69,65 @@ type OperationStat struct {
 	MinDuration time.Duration `json:"min_duration_ns"`
 	MaxDuration time.Duration `json:"max_duration_ns"`
 	SuccessRate float64       `json:"success_rate"`
+
+	// Phases holds percentiles of each phase reported in Server-Timing
+	Phases map[string]PhaseStat `json:"phases,omitempty"`
+}
+
+// PhaseStat holds percentiles of the server-side duration of one phase
+type PhaseStat struct {
+	Count       int           `json:"count"`
+	AvgDuration time.Duration `json:"avg_duration_ns"`
+	P50Duration time.Duration `json:"p50_duration_ns"`
+	P90Duration time.Duration `json:"p90_duration_ns"`
+	P99Duration time.Duration `json:"p99_duration_ns"`
+	MaxDuration time.Duration `json:"max_duration_ns"`
+}
+
+// parseServerTiming parses the durations of a Server-Timing header such as
+// "db;dur=1.204, encode;dur=0.051, app;dur=0.320", given in milliseconds.
+// Metrics without a duration are skipped.
+func parseServerTiming(header string) []Phase {
+	var phases []Phase
+	for _, metric := range strings.Split(header, ",") {
+		params := strings.Split(metric, ";")
+		name := strings.TrimSpace(params[0])
+		for _, param := range params[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if key != "dur" {
+				continue
+			}
+			ms, err := strconv.ParseFloat(strings.Trim(value, `"`), 64)
+			if err != nil || name == "" {
+				continue
+			}
+			phases = append(phases, Phase{Name: name, Duration: time.Duration(math.Round(ms * float64(time.Millisecond)))})
+		}
+	}
+	return phases
+}
+
+// newPhaseStat computes statistics of the durations of a phase
+func newPhaseStat(durations []time.Duration) PhaseStat {
+	sorted := slices.Sorted(slices.Values(durations))
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	return PhaseStat{
+		Count:       len(sorted),
+		AvgDuration: total / time.Duration(len(sorted)),
+		P50Duration: percentile(sorted, 50),
+		P90Duration: percentile(sorted, 90),
+		P99Duration: percentile(sorted, 99),
+		MaxDuration: sorted[len(sorted)-1],
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank-1, 0)]
 }
 
 // SmokeTest performs CRUD operations in parallel
@@ -72,10 +142,25 @@ type SmokeTest struct {
 	fileMutex   sync.Mutex
 	iterations  int
 	parallel    int
+	conditional bool // also revalidate each read with If-None-Match, expecting 304
+}
+
+// apiKeyTransport sends an API key with every request
+type apiKeyTransport struct {
+	apiKey string
+	base   http.RoundTripper
+}
+
+// RoundTrip adds the X-API-Key header to a copy of the request
+func (t *apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("X-API-Key", t.apiKey)
+	return t.base.RoundTrip(req)
 }
 
-// NewSmokeTest creates a new smoke test instance
-func NewSmokeTest(baseURL string, parallel int, resultsFilePath string) *SmokeTest {
+// NewSmokeTest creates a new smoke test instance. The API key, if any, is
+// sent with every request.
+func NewSmokeTest(baseURL string, parallel int, resultsFilePath string, conditional bool, apiKey string) *SmokeTest {
 	// Create results file
 	resultsFile, err := os.OpenFile(resultsFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
@@ -83,16 +168,23 @@ func NewSmokeTest(baseURL string, parallel int, resultsFilePath string) *SmokeTe
 		resultsFile = nil
 	}
 
+	var transport http.RoundTripper = http.DefaultTransport
+	if apiKey != "" {
+		transport = &apiKeyTransport{apiKey: apiKey, base: transport}
+	}
+
 	return &SmokeTest{
 		baseURL: baseURL,
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: transport,
 		},
 		results:     make(chan TestResult, 1000), // Buffer for results
 		semaphore:   make(chan struct{}, parallel),
 		resultsFile: resultsFile,
 		resultsPath: resultsFilePath,
 		parallel:    parallel,
+		conditional: conditional,
 	}
 }
 
@@ -188,6 +280,7 @@ func (st *SmokeTest) createContent(ctx context.Context, id int) {
 			Operation: "CREATE",
 			ID:        fmt.Sprintf("%d", id),
 			Status:    resp.StatusCode,
+			Timing:    parseServerTiming(resp.Header.Get("Server-Timing")),
 			Duration:  time.Since(start),
 			Error:     fmt.Errorf("failed to decode response: %w", err).Error(),
 			Timestamp: time.Now(),
@@ -195,10 +288,24 @@ func (st *SmokeTest) createContent(ctx context.Context, id int) {
 		return
 	}
 
+	if resp.StatusCode != 200 && resp.StatusCode != 201 {
+		st.results <- TestResult{
+			Operation: "CREATE",
+			ID:        fmt.Sprintf("%d", id),
+			Status:    resp.StatusCode,
+			Timing:    parseServerTiming(resp.Header.Get("Server-Timing")),
+			Duration:  time.Since(start),
+			Error:     fmt.Sprintf("unexpected status code: %d", resp.StatusCode),
+			Timestamp: time.Now(),
+		}
+		return
+	}
+
 	st.results <- TestResult{
 		Operation: "CREATE",
 		ID:        apiResp["id"].(string), // Assuming ID is always a string in the new APIResponse
 		Status:    resp.StatusCode,
+		Timing:    parseServerTiming(resp.Header.Get("Server-Timing")),
 		Duration:  time.Since(start),
 		Error:     "",
 		Timestamp: time.Now(),
@@ -207,9 +314,16 @@ func (st *SmokeTest) createContent(ctx context.Context, id int) {
 	// If creation was successful, perform READ, UPDATE, DELETE operations in sequence
 	if resp.StatusCode == 200 || resp.StatusCode == 201 {
 		st.wg.Add(3)
+		if st.conditional {
+			st.wg.Add(1)
+		}
 		go func() {
 			// READ first
-			st.readContent(ctx, apiResp["id"].(string))
+			etag := st.readContent(ctx, apiResp["id"].(string))
+			// Revalidate the READ, which should be answered with 304 Not Modified
+			if st.conditional {
+				st.readContentConditional(ctx, apiResp["id"].(string), etag)
+			}
 			// Small delay to ensure READ completes
 			time.Sleep(5 * time.Millisecond)
 			// UPDATE second
@@ -222,8 +336,8 @@ func (st *SmokeTest) createContent(ctx context.Context, id int) {
 	}
 }
 
-// readContent reads a content item by ID
-func (st *SmokeTest) readContent(ctx context.Context, id string) {
+// readContent reads a content item by ID and returns its ETag
+func (st *SmokeTest) readContent(ctx context.Context, id string) string {
 	st.acquire()
 	defer st.release()
 	defer st.wg.Done()
@@ -240,7 +354,7 @@ func (st *SmokeTest) readContent(ctx context.Context, id string) {
 			Error:     fmt.Errorf("failed to create request: %w", err).Error(),
 			Timestamp: time.Now(),
 		}
-		return
+		return ""
 	}
 
 	resp, err := st.httpClient.Do(req)
@@ -253,7 +367,7 @@ func (st *SmokeTest) readContent(ctx context.Context, id string) {
 			Error:     fmt.Errorf("failed to execute request: %w", err).Error(),
 			Timestamp: time.Now(),
 		}
-		return
+		return ""
 	}
 	defer resp.Body.Close()
 
@@ -261,10 +375,67 @@ func (st *SmokeTest) readContent(ctx context.Context, id string) {
 		Operation: "READ",
 		ID:        id,
 		Status:    resp.StatusCode,
+		Timing:    parseServerTiming(resp.Header.Get("Server-Timing")),
 		Duration:  time.Since(start),
 		Error:     "",
 		Timestamp: time.Now(),
 	}
+
+	return resp.Header.Get("ETag")
+}
+
+// readContentConditional revalidates a content item with If-None-Match,
+// counting anything but 304 Not Modified as a failure
+func (st *SmokeTest) readContentConditional(ctx context.Context, id string, etag string) {
+	st.acquire()
+	defer st.release()
+	defer st.wg.Done()
+
+	start := time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", st.baseURL+"/content/"+id, nil)
+	if err != nil {
+		st.results <- TestResult{
+			Operation: "READ_CONDITIONAL",
+			ID:        id,
+			Status:    0,
+			Duration:  time.Since(start),
+			Error:     fmt.Errorf("failed to create request: %w", err).Error(),
+			Timestamp: time.Now(),
+		}
+		return
+	}
+
+	req.Header.Set("If-None-Match", etag)
+
+	resp, err := st.httpClient.Do(req)
+	if err != nil {
+		st.results <- TestResult{
+			Operation: "READ_CONDITIONAL",
+			ID:        id,
+			Status:    0,
+			Duration:  time.Since(start),
+			Error:     fmt.Errorf("failed to execute request: %w", err).Error(),
+			Timestamp: time.Now(),
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	errMsg := ""
+	if resp.StatusCode != http.StatusNotModified {
+		errMsg = fmt.Sprintf("expected status 304 for ETag %s", etag)
+	}
+
+	st.results <- TestResult{
+		Operation: "READ_CONDITIONAL",
+		ID:        id,
+		Status:    resp.StatusCode,
+		Timing:    parseServerTiming(resp.Header.Get("Server-Timing")),
+		Duration:  time.Since(start),
+		Error:     errMsg,
+		Timestamp: time.Now(),
+	}
 }
 
 // updateContent updates a content item
@@ -342,6 +513,7 @@ func (st *SmokeTest) updateContent(ctx context.Context, id string) {
 		Operation: "UPDATE",
 		ID:        id,
 		Status:    resp.StatusCode,
+		Timing:    parseServerTiming(resp.Header.Get("Server-Timing")),
 		Duration:  time.Since(start),
 		Error:     "",
 		Timestamp: time.Now(),
@@ -387,6 +559,7 @@ func (st *SmokeTest) deleteContent(ctx context.Context, id string) {
 		Operation: "DELETE",
 		ID:        id,
 		Status:    resp.StatusCode,
+		Timing:    parseServerTiming(resp.Header.Get("Server-Timing")),
 		Duration:  time.Since(start),
 		Error:     "",
 		Timestamp: time.Now(),
@@ -422,6 +595,8 @@ func (st *SmokeTest) Run(numIterations int) {
 		totalDur time.Duration
 		minDur   time.Duration
 		maxDur   time.Duration
+		phases   map[string][]time.Duration
+		order    []string // phase names in the order the server reports them
 	})
 
 	for result := range st.results {
@@ -443,6 +618,19 @@ func (st *SmokeTest) Run(numIterations int) {
 			stats.maxDur = result.Duration
 		}
 
+		// Only successful requests, failures are often cut short
+		if result.Error == "" {
+			for _, phase := range result.Timing {
+				if stats.phases == nil {
+					stats.phases = make(map[string][]time.Duration)
+				}
+				if _, ok := stats.phases[phase.Name]; !ok {
+					stats.order = append(stats.order, phase.Name)
+				}
+				stats.phases[phase.Name] = append(stats.phases[phase.Name], phase.Duration)
+			}
+		}
+
 		operationStats[result.Operation] = stats
 	}
 
@@ -461,6 +649,13 @@ func (st *SmokeTest) Run(numIterations int) {
 		log.Printf("%s: %d total, %d success, %d failures, avg: %v, min: %v, max: %v",
 			op, stats.count, stats.success, stats.failures, avgDur, stats.minDur, stats.maxDur)
 
+		// Break the server-side time down by the phases of Server-Timing
+		for _, name := range stats.order {
+			phase := newPhaseStat(stats.phases[name])
+			log.Printf("  server %s: avg: %v, p50: %v, p90: %v, p99: %v, max: %v",
+				name, phase.AvgDuration, phase.P50Duration, phase.P90Duration, phase.P99Duration, phase.MaxDuration)
+		}
+
 		totalOperations += stats.count
 		totalSuccess += stats.success
 		totalFailures += stats.failures
@@ -496,7 +691,7 @@ func (st *SmokeTest) Run(numIterations int) {
 			avgDur = stats.totalDur / time.Duration(stats.count)
 		}
 
-		summary.Operations[op] = OperationStat{
+		opStat := OperationStat{
 			Count:       stats.count,
 			Success:     stats.success,
 			Failures:    stats.failures,
@@ -505,6 +700,13 @@ func (st *SmokeTest) Run(numIterations int) {
 			MaxDuration: stats.maxDur,
 			SuccessRate: float64(stats.success) / float64(stats.count),
 		}
+		if len(stats.phases) > 0 {
+			opStat.Phases = make(map[string]PhaseStat)
+			for name, durations := range stats.phases {
+				opStat.Phases[name] = newPhaseStat(durations)
+			}
+		}
+		summary.Operations[op] = opStat
 	}
 
 	// Write summary to file
@@ -523,9 +725,11 @@ func main() {
 		iterations  = flag.Int("n", 10, "Number of iterations to run")
 		parallel    = flag.Int("parallel", 10, "Maximum number of parallel API calls")
 		resultsFile = flag.String("results", "scripts/performance-test/test-results.jsonl", "Path to results JSONL file")
+		conditional = flag.Bool("conditional", false, "Revalidate each read with If-None-Match, expecting 304 Not Modified")
+		apiKey      = flag.String("api-key", os.Getenv("API_KEY"), "API key with scope content:write, needed unless the server grants it anonymously")
 	)
 	flag.Parse()
 
-	smokeTest := NewSmokeTest(*baseURL, *parallel, *resultsFile)
+	smokeTest := NewSmokeTest(*baseURL, *parallel, *resultsFile, *conditional, *apiKey)
 	smokeTest.Run(*iterations)
 }
@@ -7,29 +7,49 @@ BASE_URL=${BASE_URL:-http://localhost:8888}
 
 OUTPUT_DIR=scripts/smoke-test
 
+# API_KEY is required: writes need an API key with scope content:write. Set it
+# to an empty string only for a server that grants content:write anonymously
+# (AUTH_ANONYMOUS_SCOPES), such as the in-memory setup in the README.
+if [ -z "${API_KEY+set}" ]; then
+  echo "FAILURE!: set API_KEY to an API key with scope content:write" >&2
+  exit 1
+fi
+AUTH_HEADER=()
+if [ -n "$API_KEY" ]; then
+  AUTH_HEADER=(-H "X-API-Key: $API_KEY")
+fi
+
 URL="$BASE_URL/content"
 echo -e "\nCreate - POST $URL\n"
-curl -s --show-error -X POST $URL -H "Content-Type: application/json" -d '{"title":"Test Content","body":"This is test content","author":"Test Author","status":"draft"}' -o $OUTPUT_DIR/create.json -D /tmp/headers
+status_code=$(curl -s --show-error "${AUTH_HEADER[@]}" -X POST $URL -H "Content-Type: application/json" -d '{"title":"Test Content","body":"This is test content","author":"Test Author","status":"draft"}' -o $OUTPUT_DIR/create.json -D /tmp/headers -w '%{http_code}')
 cat /tmp/headers
 cat $OUTPUT_DIR/create.json | jq
+if [ "$status_code" -ne "200" ] && [ "$status_code" -ne "201" ]; then
+  echo -e "\nFAILURE!: expected the create to succeed but got status code $status_code\n"
+  exit 1
+fi
+
+CONTENT_ID=$(jq -r '.id' $OUTPUT_DIR/create.json)
+if [ -z "$CONTENT_ID" ] || [ "$CONTENT_ID" = "null" ]; then
+  echo -e "\nFAILURE!: the create response has no content ID\n"
+  exit 1
+fi
 
 URL="$BASE_URL/content"
 echo -e "\nList - GET $URL\n"
-curl -s --show-error $URL -o $OUTPUT_DIR/list.json -D /tmp/headers
+curl -s --show-error "${AUTH_HEADER[@]}" $URL -o $OUTPUT_DIR/list.json -D /tmp/headers
 cat /tmp/headers
 cat $OUTPUT_DIR/list.json | jq
 
-CONTENT_ID=$(curl -s --show-error $BASE_URL/content | jq -r '.[0].id')
-
 URL="$BASE_URL/content/$CONTENT_ID"
 echo -e "\nGet - GET $URL\n"
-curl -s --show-error $URL -o $OUTPUT_DIR/get.json -D /tmp/headers
+curl -s --show-error "${AUTH_HEADER[@]}" $URL -o $OUTPUT_DIR/get.json -D /tmp/headers
 cat /tmp/headers
 cat $OUTPUT_DIR/get.json | jq
 
 URL="$BASE_URL/content/$CONTENT_ID"
 echo -e "\nUpdate - PUT $URL\n"
-curl -s --show-error -X PUT $URL \
+curl -s --show-error "${AUTH_HEADER[@]}" -X PUT $URL \
   -H "Content-Type: application/json" \
   -d '{
     "title": "Updated Title",
@@ -43,10 +63,10 @@ cat $OUTPUT_DIR/update.json | jq
 
 URL="$BASE_URL/content/$CONTENT_ID"
 echo -e "\nDelete - DELETE $URL\n"
-curl -s --show-error -X DELETE $URL -o $OUTPUT_DIR/delete.json -D /tmp/headers
+curl -s --show-error "${AUTH_HEADER[@]}" -X DELETE $URL -o $OUTPUT_DIR/delete.json -D /tmp/headers
 cat /tmp/headers
 cat $OUTPUT_DIR/delete.json | jq
-status_code=$(curl -s --show-error $URL -w '%{http_code}' -o /dev/null)
+status_code=$(curl -s --show-error "${AUTH_HEADER[@]}" $URL -w '%{http_code}' -o /dev/null)
 if [ "$status_code" -ne "404" ]; then
   echo -e "\nFAILURE!: expected status code 404 after delete but got $status_code\n"
   exit 1
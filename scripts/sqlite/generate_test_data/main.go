@@ -1,80 +1,19 @@
 package main
 
 import (
+	"context"
 	cryptorand "crypto/rand"
 	"fmt"
+	"maps"
 	"math/big"
 	"math/rand"
 	"strings"
 	"time"
 
 	"github.com/oklog/ulid/v2"
-	"github.com/seenthis-ab/content-api/config"
-	postgresModels "github.com/seenthis-ab/content-api/postgres-models"
-	sqliteModels "github.com/seenthis-ab/content-api/sqlite-models"
+	"github.com/seenthis-ab/content-api/models"
 )
 
-// ContentStore interface for both backends
-type ContentStore interface {
-	Create(content *Content) error
-	List() ([]*Content, error)
-	Close() error
-}
-
-// Content is a generic type for both backends
-type Content struct {
-	ID        string                 `json:"id" db:"id"`
-	Title     string                 `json:"title" db:"title"`
-	Body      string                 `json:"body" db:"body"`
-	Author    string                 `json:"author" db:"author"`
-	Status    string                 `json:"status" db:"status"`
-	Data      map[string]interface{} `json:"data" db:"data"`
-	CreatedAt time.Time              `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time              `json:"updated_at" db:"updated_at"`
-}
-
-// Adapter types to satisfy ContentStore interface for each backend
-type sqliteContentStoreAdapter struct{ s *sqliteModels.ContentStore }
-
-func (a *sqliteContentStoreAdapter) Create(content *Content) error {
-	return a.s.Create((*sqliteModels.Content)(content))
-}
-func (a *sqliteContentStoreAdapter) List() ([]*Content, error) {
-	list, err := a.s.List()
-	if err != nil {
-		return nil, err
-	}
-	res := make([]*Content, len(list))
-	for i, c := range list {
-		res[i] = (*Content)(c)
-	}
-	return res, nil
-}
-func (a *sqliteContentStoreAdapter) Close() error {
-	return a.s.Close()
-}
-
-type postgresContentStoreAdapter struct{ s *postgresModels.ContentStore }
-
-func (a *postgresContentStoreAdapter) Create(content *Content) error {
-	return a.s.Create((*postgresModels.Content)(content))
-}
-func (a *postgresContentStoreAdapter) List() ([]*Content, error) {
-	list, err := a.s.List()
-	if err != nil {
-		return nil, err
-	}
-	res := make([]*Content, len(list))
-	for i, c := range list {
-		res[i] = (*Content)(c)
-	}
-	return res, nil
-}
-func (a *postgresContentStoreAdapter) Close() error {
-	a.s.Close()
-	return nil
-}
-
 // Sample data for generating realistic content
 var (
 	titles = []string{
@@ -167,19 +106,19 @@ func generateULID() string {
 }
 
 // generateTestContent creates a single test content item
-func generateTestContent() *Content {
+func generateTestContent() *models.Content {
 	title := randomChoice(titles)
 	body := randomChoice(bodies)
 	author := randomChoice(authors)
 	status := randomChoice(statuses)
-	data := randomChoice(sampleData)
+	data := maps.Clone(randomChoice(sampleData))
 
 	// Add some randomization to make data more varied
 	data["views"] = rand.Intn(10000)
 	data["likes"] = rand.Intn(1000)
 	data["published"] = time.Now().Add(-time.Duration(rand.Intn(365)) * 24 * time.Hour)
 
-	return &Content{
+	content := &models.Content{
 		ID:     generateULID(),
 		Title:  title,
 		Body:   body,
@@ -187,34 +126,22 @@ func generateTestContent() *Content {
 		Status: status,
 		Data:   data,
 	}
+
+	// Published and archived content went through the publishing workflow
+	if status != "draft" {
+		publishedAt := data["published"].(time.Time)
+		content.PublishedAt = &publishedAt
+		content.PublishedBy = &author
+	}
+
+	return content
 }
 
 func main() {
-	// Load database configuration
-	dbConfig := config.LoadDatabaseConfig()
-	var contentStore ContentStore
-	var err error
-
-	// Initialize database connection based on engine
-	switch config.GetDatabaseEngine() {
-	case "postgres":
-		fmt.Println("Using Postgres database engine")
-		var pgStore *postgresModels.ContentStore
-		pgStore, err = postgresModels.NewContentStore(dbConfig.GetConnectionString())
-		if err != nil {
-			panic(fmt.Sprintf("Failed to initialize Postgres database: %v", err))
-		}
-		contentStore = &postgresContentStoreAdapter{s: pgStore}
-	case "sqlite":
-		fallthrough
-	default:
-		fmt.Println("Using SQLite database engine")
-		var sqlStore *sqliteModels.ContentStore
-		sqlStore, err = sqliteModels.NewContentStore(dbConfig.GetConnectionString())
-		if err != nil {
-			panic(fmt.Sprintf("Failed to initialize SQLite database: %v", err))
-		}
-		contentStore = &sqliteContentStoreAdapter{s: sqlStore}
+	// Initialize database connection based on DATABASE_ENGINE
+	contentStore, err := models.GetContentStore()
+	if err != nil {
+		panic(err)
 	}
 	defer contentStore.Close()
 
@@ -224,33 +151,28 @@ func main() {
 
 	// Track progress
 	startTime := time.Now()
-	batchSize := 100
+	batchSize := models.MaxBulkItems
+	created := 0
 
-	for i := 0; i < numRecords; i++ {
-		content := generateTestContent()
+	for created < numRecords {
+		batch := make([]*models.Content, min(batchSize, numRecords-created))
+		for i := range batch {
+			batch[i] = generateTestContent()
+		}
 
-		if err := contentStore.Create(content); err != nil {
-			fmt.Printf("Error creating content %d: %v\n", i+1, err)
-			continue
+		// Each batch is inserted in one transaction (COPY on Postgres)
+		if err := contentStore.CreateMany(context.Background(), batch); err != nil {
+			panic(fmt.Sprintf("Error creating content %d-%d: %v", created+1, created+len(batch), err))
 		}
+		created += len(batch)
 
 		// Progress reporting
-		if (i+1)%batchSize == 0 {
-			elapsed := time.Since(startTime)
-			rate := float64(i+1) / elapsed.Seconds()
-			fmt.Printf("Created %d records (%.1f records/sec)\n", i+1, rate)
-		}
+		elapsed := time.Since(startTime)
+		rate := float64(created) / elapsed.Seconds()
+		fmt.Printf("Created %d records (%.1f records/sec)\n", created, rate)
 	}
 
 	elapsed := time.Since(startTime)
 	fmt.Printf("\n✅ Successfully created %d test records in %.2f seconds\n", numRecords, elapsed.Seconds())
 	fmt.Printf("Average rate: %.1f records/second\n", float64(numRecords)/elapsed.Seconds())
-
-	// Verify the count
-	contents, err := contentStore.List()
-	if err != nil {
-		fmt.Printf("Warning: Could not verify record count: %v\n", err)
-	} else {
-		fmt.Printf("Total records in database: %d\n", len(contents))
-	}
 }
@@ -0,0 +1,63 @@
+package timing
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// pgxStatementKey is the context key pgx hands from the start to the end of
+// a call
+const pgxStatementKey = "pgx_statement"
+
+// PgxTracer times pgx queries, batches and copies run during a request for
+// its Server-Timing header. Set it as the Tracer of a pgx.ConnConfig,
+// combined with others through multitracer.
+type PgxTracer struct{}
+
+func startPgx(ctx context.Context) context.Context {
+	stmt := startStatement(ctx)
+	if stmt == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, pgxStatementKey, stmt)
+}
+
+func endPgx(ctx context.Context) {
+	if stmt, ok := ctx.Value(pgxStatementKey).(*statement); ok {
+		stmt.end()
+	}
+}
+
+// TraceQueryStart implements pgx.QueryTracer
+func (PgxTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	return startPgx(ctx)
+}
+
+// TraceQueryEnd implements pgx.QueryTracer
+func (PgxTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryEndData) {
+	endPgx(ctx)
+}
+
+// TraceBatchStart implements pgx.BatchTracer, timing the whole batch at once
+func (PgxTracer) TraceBatchStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceBatchStartData) context.Context {
+	return startPgx(ctx)
+}
+
+// TraceBatchQuery implements pgx.BatchTracer
+func (PgxTracer) TraceBatchQuery(context.Context, *pgx.Conn, pgx.TraceBatchQueryData) {}
+
+// TraceBatchEnd implements pgx.BatchTracer
+func (PgxTracer) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, _ pgx.TraceBatchEndData) {
+	endPgx(ctx)
+}
+
+// TraceCopyFromStart implements pgx.CopyFromTracer
+func (PgxTracer) TraceCopyFromStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceCopyFromStartData) context.Context {
+	return startPgx(ctx)
+}
+
+// TraceCopyFromEnd implements pgx.CopyFromTracer
+func (PgxTracer) TraceCopyFromEnd(ctx context.Context, _ *pgx.Conn, _ pgx.TraceCopyFromEndData) {
+	endPgx(ctx)
+}
@@ -0,0 +1,275 @@
+package timing
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"time"
+)
+
+// statement is an SQL statement being run during a request, whose duration
+// is added to the database time of the request's Server-Timing header
+type statement struct {
+	timings *Timings
+	start   time.Time
+}
+
+// startStatement starts timing an SQL statement, returning nil outside of
+// requests
+func startStatement(ctx context.Context) *statement {
+	timings := FromContext(ctx)
+	if timings == nil {
+		return nil
+	}
+	return &statement{timings: timings, start: time.Now()}
+}
+
+// end adds the duration of the statement to the database time
+func (s *statement) end() {
+	if s != nil {
+		s.timings.AddDB(time.Since(s.start))
+	}
+}
+
+// NewConnector wraps a database/sql driver so that statements run during a
+// request are timed for its Server-Timing header, for sql.OpenDB
+func NewConnector(d driver.Driver, dsn string) driver.Connector {
+	return &connector{driver: d, dsn: dsn}
+}
+
+type connector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+// Connect opens a connection of the wrapped driver
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	var dc driver.Conn
+	var err error
+	if d, ok := c.driver.(driver.DriverContext); ok {
+		var inner driver.Connector
+		if inner, err = d.OpenConnector(c.dsn); err == nil {
+			dc, err = inner.Connect(ctx)
+		}
+	} else {
+		dc, err = c.driver.Open(c.dsn)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: dc}, nil
+}
+
+// Driver returns the wrapped driver
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// conn times the statements of a connection. Optional interfaces the
+// wrapped connection lacks fall back to what database/sql does without them.
+type conn struct {
+	driver.Conn
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var ds driver.Stmt
+	var err error
+	if pc, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		ds, err = pc.PrepareContext(ctx, query)
+	} else {
+		ds, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &preparedStmt{Stmt: ds}, nil
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	stmt := startStatement(ctx)
+	var dt driver.Tx
+	var err error
+	if bc, ok := c.Conn.(driver.ConnBeginTx); ok {
+		dt, err = bc.BeginTx(ctx, opts)
+	} else {
+		dt, err = c.Conn.Begin()
+	}
+	stmt.end()
+	if err != nil {
+		return nil, err
+	}
+	return &tx{Tx: dt, ctx: ctx}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ec, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	stmt := startStatement(ctx)
+	result, err := ec.ExecContext(ctx, query, args)
+	stmt.end()
+	return result, err
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	qc, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	stmt := startStatement(ctx)
+	dr, err := qc.QueryContext(ctx, query, args)
+	if err != nil {
+		stmt.end()
+		return nil, err
+	}
+	return &rows{Rows: dr, stmt: stmt}, nil
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// tx times the end of a transaction with the context it was begun with, as
+// database/sql does not pass one to Commit and Rollback
+type tx struct {
+	driver.Tx
+	ctx context.Context
+}
+
+func (t *tx) Commit() error {
+	stmt := startStatement(t.ctx)
+	err := t.Tx.Commit()
+	stmt.end()
+	return err
+}
+
+func (t *tx) Rollback() error {
+	stmt := startStatement(t.ctx)
+	err := t.Tx.Rollback()
+	stmt.end()
+	return err
+}
+
+// preparedStmt times the executions of a prepared statement
+type preparedStmt struct {
+	driver.Stmt
+}
+
+func (s *preparedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	stmt := startStatement(ctx)
+	var result driver.Result
+	var err error
+	if sc, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = sc.ExecContext(ctx, args)
+	} else {
+		result, err = s.Stmt.Exec(values(args))
+	}
+	stmt.end()
+	return result, err
+}
+
+func (s *preparedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	stmt := startStatement(ctx)
+	var dr driver.Rows
+	var err error
+	if sc, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		dr, err = sc.QueryContext(ctx, args)
+	} else {
+		dr, err = s.Stmt.Query(values(args))
+	}
+	if err != nil {
+		stmt.end()
+		return nil, err
+	}
+	return &rows{Rows: dr, stmt: stmt}, nil
+}
+
+func (s *preparedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// values converts arguments for drivers predating named parameters, which
+// database/sql only lets through without names
+func values(args []driver.NamedValue) []driver.Value {
+	converted := make([]driver.Value, len(args))
+	for i, arg := range args {
+		converted[i] = arg.Value
+	}
+	return converted
+}
+
+// rows ends a query once its rows are closed, so that its duration includes
+// stepping through the results
+type rows struct {
+	driver.Rows
+	stmt *statement
+}
+
+func (r *rows) Close() error {
+	err := r.Rows.Close()
+	r.stmt.end()
+	return err
+}
+
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return ct.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return ct.ColumnTypeScanType(index)
+	}
+	return reflect.TypeFor[any]()
+}
+
+func (r *rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+		return ct.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r *rows) ColumnTypeLength(index int) (length int64, ok bool) {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+		return ct.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *rows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	if ct, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return ct.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
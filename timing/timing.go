@@ -0,0 +1,71 @@
+// Package timing collects how long a request spends in the database and
+// encoding its response, for the Server-Timing response header
+package timing
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// TimingsKey is the context key for storing the timings of a request
+const TimingsKey = "timings"
+
+// Timings accumulates the time a request spends in each phase. All methods
+// may be called on a nil Timings, which is what FromContext returns outside
+// of requests.
+type Timings struct {
+	start  time.Time
+	db     atomic.Int64 // nanoseconds
+	encode atomic.Int64 // nanoseconds
+}
+
+// NewContext starts the timings of a request and adds them to the context
+func NewContext(ctx context.Context) (context.Context, *Timings) {
+	t := &Timings{start: time.Now()}
+	return context.WithValue(ctx, TimingsKey, t), t
+}
+
+// FromContext returns the timings of the request, nil if there are none
+func FromContext(ctx context.Context) *Timings {
+	if ctx == nil {
+		return nil
+	}
+	t, _ := ctx.Value(TimingsKey).(*Timings)
+	return t
+}
+
+// AddDB adds the duration of a database statement, including reading its
+// rows
+func (t *Timings) AddDB(d time.Duration) {
+	if t != nil {
+		t.db.Add(int64(d))
+	}
+}
+
+// AddEncode adds the duration of encoding a response body
+func (t *Timings) AddEncode(d time.Duration) {
+	if t != nil {
+		t.encode.Add(int64(d))
+	}
+}
+
+// Header formats the timings as a Server-Timing header value, such as
+// "db;dur=1.204, encode;dur=0.051, app;dur=0.320", in milliseconds. app is
+// the time since the request started that was spent neither in the
+// database nor encoding.
+func (t *Timings) Header() string {
+	if t == nil {
+		return ""
+	}
+	db := time.Duration(t.db.Load())
+	encode := time.Duration(t.encode.Load())
+	app := max(time.Since(t.start)-db-encode, 0)
+	return fmt.Sprintf("db;dur=%s, encode;dur=%s, app;dur=%s", millis(db), millis(encode), millis(app))
+}
+
+// millis formats a duration in milliseconds with microsecond precision
+func millis(d time.Duration) string {
+	return fmt.Sprintf("%.3f", float64(d.Microseconds())/1000)
+}
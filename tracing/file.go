@@ -0,0 +1,200 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// FileExporter appends spans to a file, one OTLP/JSON export request per
+// line, which the OpenTelemetry Collector's otlpjsonfile receiver reads. It
+// lets traces be recorded without a collector running.
+type FileExporter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileExporter opens the file for appending, creating it if needed
+func NewFileExporter(path string) (*FileExporter, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file: %w", err)
+	}
+	return &FileExporter{file: file}, nil
+}
+
+// ExportSpans writes the spans as one line, implementing
+// sdktrace.SpanExporter
+func (e *FileExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	line, err := json.Marshal(newExportRequest(spans))
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.file.Write(line)
+	return err
+}
+
+// Shutdown closes the file, implementing sdktrace.SpanExporter
+func (e *FileExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.file.Close()
+}
+
+// The types below are the OTLP/JSON encoding of an ExportTraceServiceRequest:
+// IDs are hex, enums are numbers and 64-bit integers are strings.
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resourceJSON `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resourceJSON struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []spanJSON `json:"spans"`
+}
+
+type scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type spanJSON struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              int         `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []keyValue  `json:"attributes,omitempty"`
+	Events            []eventJSON `json:"events,omitempty"`
+	Status            status      `json:"status"`
+}
+
+type eventJSON struct {
+	TimeUnixNano string     `json:"timeUnixNano"`
+	Name         string     `json:"name"`
+	Attributes   []keyValue `json:"attributes,omitempty"`
+}
+
+type status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+// OTLP status codes, which number OK and error the other way around from
+// the codes package
+const (
+	statusOK    = 1
+	statusError = 2
+)
+
+// newExportRequest encodes spans, grouped by their instrumentation scope.
+// All spans of a tracer provider share its resource.
+func newExportRequest(spans []sdktrace.ReadOnlySpan) *exportRequest {
+	var scopes []scopeSpans
+	index := map[scope]int{}
+	for _, span := range spans {
+		s := scope{Name: span.InstrumentationScope().Name, Version: span.InstrumentationScope().Version}
+		i, ok := index[s]
+		if !ok {
+			i = len(scopes)
+			index[s] = i
+			scopes = append(scopes, scopeSpans{Scope: s})
+		}
+		scopes[i].Spans = append(scopes[i].Spans, encodeSpan(span))
+	}
+	return &exportRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resourceJSON{Attributes: encodeAttributes(spans[0].Resource().Attributes())},
+		ScopeSpans: scopes,
+	}}}
+}
+
+func encodeSpan(span sdktrace.ReadOnlySpan) spanJSON {
+	encoded := spanJSON{
+		TraceID:           span.SpanContext().TraceID().String(),
+		SpanID:            span.SpanContext().SpanID().String(),
+		Name:              span.Name(),
+		Kind:              int(span.SpanKind()),
+		StartTimeUnixNano: strconv.FormatInt(span.StartTime().UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.EndTime().UnixNano(), 10),
+		Attributes:        encodeAttributes(span.Attributes()),
+	}
+	if span.Parent().HasSpanID() {
+		encoded.ParentSpanID = span.Parent().SpanID().String()
+	}
+	for _, event := range span.Events() {
+		encoded.Events = append(encoded.Events, eventJSON{
+			TimeUnixNano: strconv.FormatInt(event.Time.UnixNano(), 10),
+			Name:         event.Name,
+			Attributes:   encodeAttributes(event.Attributes),
+		})
+	}
+	switch span.Status().Code {
+	case codes.Ok:
+		encoded.Status.Code = statusOK
+	case codes.Error:
+		encoded.Status = status{Code: statusError, Message: span.Status().Description}
+	}
+	return encoded
+}
+
+// encodeAttributes encodes scalar attributes as such and others, such as
+// slices, in their string form
+func encodeAttributes(attributes []attribute.KeyValue) []keyValue {
+	encoded := make([]keyValue, 0, len(attributes))
+	for _, attr := range attributes {
+		var value anyValue
+		switch attr.Value.Type() {
+		case attribute.BOOL:
+			v := attr.Value.AsBool()
+			value.BoolValue = &v
+		case attribute.INT64:
+			s := strconv.FormatInt(attr.Value.AsInt64(), 10)
+			value.IntValue = &s
+		case attribute.FLOAT64:
+			v := attr.Value.AsFloat64()
+			value.DoubleValue = &v
+		default:
+			s := attr.Value.Emit()
+			value.StringValue = &s
+		}
+		encoded = append(encoded, keyValue{Key: string(attr.Key), Value: value})
+	}
+	return encoded
+}
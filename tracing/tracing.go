@@ -0,0 +1,69 @@
+// Package tracing sets up OpenTelemetry tracing. Spans are exported over
+// OTLP/HTTP or to a file, and trace context is propagated with the W3C
+// traceparent header.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/seenthis-ab/content-api/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// NewTracerProvider creates a tracer provider exporting spans as configured
+// and installs it as the global one, with the W3C trace context propagator,
+// for the HTTP and database instrumentation. Without an exporter, trace IDs
+// are still propagated and logged but no spans are kept. Shut the provider
+// down to export the spans still queued.
+func NewTracerProvider(ctx context.Context, cfg *config.TracingConfig) (*sdktrace.TracerProvider, error) {
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return nil, fmt.Errorf("invalid TRACING_SAMPLE_RATIO %v, expected 0 to 1", cfg.SampleRatio)
+	}
+
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case "", "none":
+	case "file":
+		fileExporter, err := NewFileExporter(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		exporter = fileExporter
+	case "otlp":
+		// Reads the endpoint and headers from the standard
+		// OTEL_EXPORTER_OTLP_* variables
+		otlpExporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		exporter = otlpExporter
+	default:
+		return nil, fmt.Errorf("unknown TRACING_EXPORTER %q, expected otlp, file or none", cfg.Exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	// The sampled flag of a traceparent is respected, new traces are
+	// sampled at the configured ratio
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	}
+	if exporter != nil {
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+	provider := sdktrace.NewTracerProvider(options...)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider, nil
+}